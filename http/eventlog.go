@@ -0,0 +1,202 @@
+package http
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/nwidger/nintengo/m65go2"
+	"github.com/nwidger/nintengo/nes"
+	"github.com/nwidger/nintengo/rp2ago3"
+	"github.com/nwidger/nintengo/rp2cgo2"
+)
+
+// A kind of event recorded by an EventLog.
+type EventKind int
+
+const (
+	PPURegisterWrite EventKind = iota
+	MapperRegisterWrite
+	IRQ
+	NMI
+)
+
+func (kind EventKind) String() string {
+	switch kind {
+	case PPURegisterWrite:
+		return "PPU register write"
+	case MapperRegisterWrite:
+		return "Mapper register write"
+	case IRQ:
+		return "IRQ"
+	case NMI:
+		return "NMI"
+	}
+
+	return fmt.Sprintf("EventKind(%d)", int(kind))
+}
+
+var ppuRegisterNames = []string{
+	"PPUCTRL", "PPUMASK", "PPUSTATUS", "OAMADDR",
+	"OAMDATA", "PPUSCROLL", "PPUADDR", "PPUDATA",
+}
+
+// A CPU write or interrupt and the PPU scanline and cycle at which it
+// happened.  The PPU only catches up with the CPU after each
+// instruction, so writes are placed on the last cycle of their
+// instruction, where the 6502 makes them, counting from the PPU's
+// position when the instruction started.
+type Event struct {
+	Kind     EventKind
+	Scanline uint16
+	Cycle    uint16
+	// the instruction executing when the event happened
+	PC      uint16
+	Address uint16
+	Value   uint8
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case PPURegisterWrite:
+		return fmt.Sprintf("%s ($%04x) = $%02x", ppuRegisterNames[e.Address&0x0007], e.Address, e.Value)
+	case MapperRegisterWrite:
+		return fmt.Sprintf("Mapper $%04x = $%02x", e.Address, e.Value)
+	}
+
+	return e.Kind.String() + " asserted"
+}
+
+// Records the writes the CPU makes to the PPU's and the mapper's
+// registers and the IRQ and NMI assertions of each frame, for the
+// event viewer.  Mapper registers are written at $4020-$5fff and
+// $8000-$ffff.
+type EventLog struct {
+	nes     *nes.NES
+	ppu     *rp2cgo2.RP2C02
+	divisor float32
+	start   sync.Once
+	lock    sync.Mutex
+
+	// the instruction executing, the CPU cycles from the start of
+	// its Execute to its writes and the cycles taken by an interrupt
+	// performed before it
+	pc          uint16
+	cycles      uint16
+	interrupted uint16
+
+	// the frame being recorded and the frame before it
+	frame    uint16
+	events   []Event
+	previous []Event
+}
+
+// Returns a new EventLog that will record events in n.
+func NewEventLog(n *nes.NES) *EventLog {
+	el := &EventLog{
+		nes:     n,
+		ppu:     n.PPU,
+		divisor: rp2ago3.NTSC_CPU_CLOCK_DIVISOR,
+		frame:   n.PPU.Frame,
+	}
+
+	if n.ROM.Region() == nes.PAL {
+		el.divisor = rp2ago3.PAL_CPU_CLOCK_DIVISOR
+	}
+
+	return el
+}
+
+// Registers the hooks that record events the first time it is
+// called, so that instructions and writes don't pay for them until
+// the event viewer is used.  The hooks are registered with Call,
+// between instructions on the goroutine that runs them.
+func (el *EventLog) Start() {
+	el.start.Do(func() {
+		el.nes.Call(el.hook)
+	})
+}
+
+func (el *EventLog) hook() {
+	cpu := el.nes.CPU
+
+	// an interrupt performed before the instruction delays it
+	cpu.M6502.OnInterrupt(func(which m65go2.Interrupt) {
+		el.interrupted = 7
+	})
+
+	cpu.M6502.OnExecute(func(pc uint16) {
+		opcode := m65go2.OpCode(cpu.Memory.Peek(pc))
+
+		el.pc = pc
+		el.cycles = el.interrupted + cpu.M6502.Instructions.Cycles(opcode) - 1
+		el.interrupted = 0
+	})
+
+	cpu.Memory.OnWrite(func(address uint16, value uint8) {
+		switch {
+		case address >= 0x2000 && address <= 0x2007:
+			el.record(PPURegisterWrite, address, value, el.cycles)
+		case address >= 0x4020 && address <= 0x5fff, address >= 0x8000:
+			el.record(MapperRegisterWrite, address, value, el.cycles)
+		}
+	})
+
+	cpu.M6502.OnInterruptLine(func(which m65go2.Interrupt, state bool) {
+		switch {
+		case which == m65go2.Irq && state:
+			el.record(IRQ, 0, 0, 0)
+		case which == m65go2.Nmi && state:
+			el.record(NMI, 0, 0, 0)
+		}
+	})
+}
+
+// Starts recording the frame the PPU is on if it has moved on from
+// the frame being recorded.
+func (el *EventLog) advance() {
+	if frame := el.ppu.Frame; frame != el.frame {
+		if frame == el.frame+1 {
+			el.previous, el.events = el.events, el.previous[:0]
+		} else {
+			el.previous, el.events = el.previous[:0], el.events[:0]
+		}
+
+		el.frame = frame
+	}
+}
+
+// Records an event that happened the given number of CPU cycles after
+// the PPU's current position.
+func (el *EventLog) record(kind EventKind, address uint16, value uint8, cycles uint16) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	el.advance()
+
+	dot := int(el.ppu.Cycle) + int(float32(cycles)*el.divisor)
+	scanline := (int(el.ppu.Scanline) + dot/int(rp2cgo2.CYCLES_PER_SCANLINE)) % rp2cgo2.NUM_SCANLINES
+
+	el.events = append(el.events, Event{
+		Kind:     kind,
+		Scanline: uint16(scanline),
+		Cycle:    uint16(dot % int(rp2cgo2.CYCLES_PER_SCANLINE)),
+		PC:       el.pc,
+		Address:  address,
+		Value:    value,
+	})
+}
+
+// Returns the events of the last frame the PPU finished and that
+// frame's number.  A frame runs from scanline 0 to the pre-render
+// scanline 261.
+func (el *EventLog) Frame() (frame uint16, events []Event) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	el.advance()
+
+	events = make([]Event, len(el.previous))
+	copy(events, el.previous)
+
+	return el.frame - 1, events
+}
@@ -0,0 +1,205 @@
+package http
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/nwidger/nintengo/nes"
+	"github.com/nwidger/nintengo/rp2ago3"
+)
+
+// A kind of memory access counted by a Heatmap.
+type Access int
+
+const (
+	Read Access = iota
+	Write
+	Execute
+	NUM_ACCESSES
+)
+
+// Counts every read, write and execute of each byte of the CPU's and
+// PPU's address spaces and of OAM.  Addresses are counted after
+// mirroring has been applied.  OAM accesses are those the CPU makes
+// through OAMData, including OAM DMA, and not the PPU's own sprite
+// evaluation.  Counting only starts once Start is called, so that
+// memory accesses don't pay for it until the memory viewer is used.
+// The counts are updated and read atomically.
+type Heatmap struct {
+	CPU [NUM_ACCESSES][0x10000]uint32
+	PPU [NUM_ACCESSES][0x10000]uint32
+	OAM [NUM_ACCESSES][0x100]uint32
+
+	nes   *nes.NES
+	start sync.Once
+}
+
+// Returns a new Heatmap that will count accesses made by nes.
+func NewHeatmap(nes *nes.NES) *Heatmap {
+	return &Heatmap{
+		nes: nes,
+	}
+}
+
+// Registers the hooks that count accesses the first time it is
+// called.  The hooks are registered with Call, between instructions
+// on the goroutine that runs them.
+func (hm *Heatmap) Start() {
+	hm.start.Do(func() {
+		hm.nes.Call(hm.hook)
+	})
+}
+
+func (hm *Heatmap) hook() {
+	cpu, ppu := hm.nes.CPU, hm.nes.PPU
+
+	cpu.M6502.OnExecute(func(pc uint16) {
+		atomic.AddUint32(&hm.CPU[Execute][pc], 1)
+	})
+
+	cpu.Memory.OnRead(func(address uint16) {
+		atomic.AddUint32(&hm.CPU[Read][address], 1)
+
+		if address == 0x2004 {
+			atomic.AddUint32(&hm.OAM[Read][ppu.Registers.OAMAddress], 1)
+		}
+	})
+
+	cpu.Memory.OnWrite(func(address uint16, value uint8) {
+		atomic.AddUint32(&hm.CPU[Write][address], 1)
+
+		if address == 0x2004 {
+			atomic.AddUint32(&hm.OAM[Write][ppu.Registers.OAMAddress], 1)
+		}
+	})
+
+	ppu.Memory.OnRead(func(address uint16) {
+		atomic.AddUint32(&hm.PPU[Read][address], 1)
+	})
+
+	ppu.Memory.OnWrite(func(address uint16, value uint8) {
+		atomic.AddUint32(&hm.PPU[Write][address], 1)
+	})
+}
+
+// Resets every count to 0.
+func (hm *Heatmap) Clear() {
+	for access := Read; access < NUM_ACCESSES; access++ {
+		for i := range hm.CPU[access] {
+			atomic.StoreUint32(&hm.CPU[access][i], 0)
+			atomic.StoreUint32(&hm.PPU[access][i], 0)
+		}
+
+		for i := range hm.OAM[access] {
+			atomic.StoreUint32(&hm.OAM[access][i], 0)
+		}
+	}
+}
+
+// A range of memory shown by the memory viewer.
+type Region struct {
+	Name   string
+	Title  string
+	Start  uint16
+	Size   int
+	counts [NUM_ACCESSES][]uint32
+	peek   func(address uint16) uint8
+	poke   func(address uint16, value uint8)
+}
+
+// Returns the regions of nes's memory shown by the memory viewer,
+// with counts taken from hm.
+func Regions(nes *nes.NES, hm *Heatmap) []*Region {
+	cpu, ppu := nes.CPU.Memory, nes.PPU.Memory
+	oam := nes.PPU.OAM.BasicMemory
+
+	region := func(name, title string, start uint16, size int, counts *[NUM_ACCESSES][0x10000]uint32, mem *rp2ago3.MappedMemory) *Region {
+		r := &Region{
+			Name:  name,
+			Title: title,
+			Start: start,
+			Size:  size,
+			peek:  mem.Peek,
+			poke: func(address uint16, value uint8) {
+				mem.Poke(address, value)
+			},
+		}
+
+		for access := Read; access < NUM_ACCESSES; access++ {
+			r.counts[access] = counts[access][int(start) : int(start)+size]
+		}
+
+		return r
+	}
+
+	oamRegion := &Region{
+		Name:  "oam",
+		Title: "OAM",
+		Size:  len(hm.OAM[Read]),
+		peek:  oam.Fetch,
+		poke: func(address uint16, value uint8) {
+			oam.Store(address, value)
+		},
+	}
+
+	for access := Read; access < NUM_ACCESSES; access++ {
+		oamRegion.counts[access] = hm.OAM[access][:]
+	}
+
+	return []*Region{
+		region("cpu-ram", "CPU RAM", 0x0000, 0x0800, &hm.CPU, cpu),
+		region("wram", "WRAM", 0x6000, 0x2000, &hm.CPU, cpu),
+		region("vram", "PPU VRAM", 0x2000, 0x1000, &hm.PPU, ppu),
+		region("palette", "Palette", 0x3f00, 0x0020, &hm.PPU, ppu),
+		oamRegion,
+	}
+}
+
+// Returns the value of each byte in the region without side effects.
+func (r *Region) Values() (values []uint8) {
+	values = make([]uint8, r.Size)
+
+	for i := range values {
+		values[i] = r.peek(r.Start + uint16(i))
+	}
+
+	return
+}
+
+// Returns the number of accesses of the given kind made to each byte
+// in the region.
+func (r *Region) Counts(access Access) (counts []uint32) {
+	counts = make([]uint32, r.Size)
+
+	for i := range counts {
+		counts[i] = atomic.LoadUint32(&r.counts[access][i])
+	}
+
+	return
+}
+
+// Stores value to the byte at offset from the start of the region
+// without counting it as a write.  Since it changes memory the
+// emulation uses it must only be called through NES.Call.
+func (r *Region) Poke(offset int, value uint8) {
+	r.poke(r.Start+uint16(offset), value)
+}
+
+// Returns the offset of each column of bytes in the memory viewer.
+func (r *Region) Columns() (columns []int) {
+	for i := 0; i < 16 && i < r.Size; i++ {
+		columns = append(columns, i)
+	}
+
+	return
+}
+
+// Returns the address of the first byte of each row in the memory
+// viewer.
+func (r *Region) Rows() (rows []uint16) {
+	for i := 0; i < r.Size; i += 16 {
+		rows = append(rows, r.Start+uint16(i))
+	}
+
+	return
+}
@@ -3,40 +3,420 @@ package http
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
+	"strconv"
+	"time"
 
 	"html/template"
 
+	"image/color"
 	"image/png"
 
 	"encoding/hex"
 
-	"github.com/nwidger/nintengo/m65go2"
 	"github.com/nwidger/nintengo/nes"
+	"github.com/nwidger/nintengo/rp2cgo2"
 )
 
 type Page struct {
 	NES             *nes.NES
-	PTLeft          string
-	PTRight         string
-	CPUMemory       string
-	PPUMemory       string
+	CHRPalette      int
+	CHRPalettes     []int
+	CHRBanks        []nes.CHRBank
+	Scanline        int
 	PPUPalette      string
 	OAMMemory       string
 	OAMBufferMemory string
 }
 
+type MemoryPage struct {
+	NES     *nes.NES
+	Regions []*Region
+	Region  *Region
+}
+
+type SpritesPage struct {
+	NES       *nes.NES
+	Sprites   []SpriteRow
+	Scanlines []ScanlineRow
+}
+
+// A sprite in OAM and its image as a base64 encoded PNG.
+type SpriteRow struct {
+	rp2cgo2.OAMSprite
+	Image string
+}
+
+// The sprites selected for a scanline by sprite evaluation, which
+// happens on the scanline before.
+type ScanlineRow struct {
+	Scanline int
+	Sprites  []uint8
+	Overflow int
+}
+
+type EventsPage struct {
+	NES    *nes.NES
+	Frame  uint16
+	Events []EventRow
+}
+
+// An event as drawn by the event viewer.  Register is the PPU register
+// written, or -1 for other events.
+type EventRow struct {
+	Kind     EventKind `json:"kind"`
+	Register int       `json:"register"`
+	Scanline uint16    `json:"scanline"`
+	Cycle    uint16    `json:"cycle"`
+	PC       string    `json:"pc"`
+	Text     string    `json:"text"`
+}
+
+// Sent over the memory viewer's stream each time it refreshes.
+type MemoryUpdate struct {
+	Values   string   `json:"values"`
+	Reads    []uint32 `json:"reads"`
+	Writes   []uint32 `json:"writes"`
+	Executes []uint32 `json:"executes"`
+}
+
 type NEServer struct {
 	*nes.NES
-	address string
+	address  string
+	heatmap  *Heatmap
+	regions  []*Region
+	eventLog *EventLog
 }
 
+// Returns a new NEServer serving nes on addr.  Since it records
+// events with hooks it must be called before nes starts running.
 func NewNEServer(nes *nes.NES, addr string) *NEServer {
+	heatmap := NewHeatmap(nes)
+
 	return &NEServer{
-		NES:     nes,
-		address: addr,
+		NES:      nes,
+		address:  addr,
+		heatmap:  heatmap,
+		regions:  Regions(nes, heatmap),
+		eventLog: NewEventLog(nes),
+	}
+}
+
+func (neserv *NEServer) region(name string) *Region {
+	for _, r := range neserv.regions {
+		if r.Name == name {
+			return r
+		}
 	}
+
+	return nil
+}
+
+// Streams the values and access counts of the region named in the
+// request as server-sent events until the client disconnects.
+func (neserv *NEServer) stream(w http.ResponseWriter, req *http.Request) {
+	r := neserv.region(req.FormValue("region"))
+
+	if r == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	neserv.heatmap.Start()
+
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	interval := 250 * time.Millisecond
+
+	if ms, err := strconv.Atoi(req.FormValue("interval")); err == nil && ms > 0 {
+		interval = time.Duration(ms) * time.Millisecond
+	}
+
+	var closed <-chan bool
+
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closed = notifier.CloseNotify()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		buf, err := json.Marshal(MemoryUpdate{
+			Values:   hex.EncodeToString(r.Values()),
+			Reads:    r.Counts(Read),
+			Writes:   r.Counts(Write),
+			Executes: r.Counts(Execute),
+		})
+
+		if err != nil {
+			fmt.Printf("*** Error encoding memory update: %s\n", err)
+			return
+		}
+
+		if _, err = fmt.Fprintf(w, "data: %s\n\n", buf); err != nil {
+			return
+		}
+
+		flusher.Flush()
+
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stores the value given in the request to the given offset in the
+// given region.
+func (neserv *NEServer) poke(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r := neserv.region(req.FormValue("region"))
+
+	if r == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	offset, err := strconv.ParseUint(req.FormValue("offset"), 16, 16)
+
+	if err != nil || int(offset) >= r.Size {
+		http.Error(w, fmt.Sprintf("Invalid offset '%s'", req.FormValue("offset")), http.StatusBadRequest)
+		return
+	}
+
+	value, err := strconv.ParseUint(req.FormValue("value"), 16, 8)
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid value '%s'", req.FormValue("value")), http.StatusBadRequest)
+		return
+	}
+
+	neserv.NES.Call(func() {
+		r.Poke(int(offset), uint8(value))
+	})
+}
+
+// Serves a PNG of the nametables captured at the scanline given in
+// the request, or immediately if there is none, with the area shown
+// on screen outlined unless scroll is 0.
+func (neserv *NEServer) nametables(w http.ResponseWriter, req *http.Request) {
+	scanline := -1
+
+	if s := req.FormValue("scanline"); s != "" {
+		var err error
+
+		if scanline, err = strconv.Atoi(s); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid scanline '%s'", s), http.StatusBadRequest)
+			return
+		}
+	}
+
+	capture := neserv.NES.CaptureNametables(scanline)
+
+	if req.FormValue("scroll") != "0" {
+		capture.DrawScroll(color.RGBA{0xff, 0x00, 0xff, 0xff})
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if err := png.Encode(w, capture.Frame); err != nil {
+		fmt.Printf("*** Error encoding nametables: %s\n", err)
+	}
+}
+
+// Shows every sprite in OAM and the sprites selected for each
+// scanline.
+func (neserv *NEServer) sprites(w http.ResponseWriter, req *http.Request) {
+	page := SpritesPage{
+		NES: neserv.NES,
+	}
+
+	for _, sprite := range neserv.NES.PPU.OAMSprites() {
+		buf := new(bytes.Buffer)
+		png.Encode(buf, neserv.NES.SpriteImage(sprite))
+
+		page.Sprites = append(page.Sprites, SpriteRow{
+			OAMSprite: sprite,
+			Image:     base64.StdEncoding.EncodeToString(buf.Bytes()),
+		})
+	}
+
+	for scanline, e := range neserv.NES.PPU.OAM.Evaluations {
+		if e.Count == 0 && e.Overflow < 0 {
+			continue
+		}
+
+		page.Scanlines = append(page.Scanlines, ScanlineRow{
+			Scanline: scanline + 1,
+			Sprites:  e.Sprites[:e.Count],
+			Overflow: e.Overflow,
+		})
+	}
+
+	t, err := template.New("sprites").Parse(sprites)
+
+	if err != nil {
+		fmt.Printf("*** Error parsing template: %s\n", err)
+		return
+	}
+
+	if err = t.Execute(w, page); err != nil {
+		fmt.Printf("*** Error executing template: %s\n", err)
+		return
+	}
+}
+
+// Shows the events of the last frame at the scanline and cycle at
+// which they happened, over the picture the PPU is drawing.
+func (neserv *NEServer) events(w http.ResponseWriter, req *http.Request) {
+	neserv.eventLog.Start()
+
+	frame, log := neserv.eventLog.Frame()
+
+	page := EventsPage{
+		NES:    neserv.NES,
+		Frame:  frame,
+		Events: []EventRow{},
+	}
+
+	for _, e := range log {
+		row := EventRow{
+			Kind:     e.Kind,
+			Register: -1,
+			Scanline: e.Scanline,
+			Cycle:    e.Cycle,
+			PC:       fmt.Sprintf("$%04x", e.PC),
+			Text:     e.String(),
+		}
+
+		if e.Kind == PPURegisterWrite {
+			row.Register = int(e.Address & 0x0007)
+		}
+
+		page.Events = append(page.Events, row)
+	}
+
+	t, err := template.New("events").Parse(events)
+
+	if err != nil {
+		fmt.Printf("*** Error parsing template: %s\n", err)
+		return
+	}
+
+	if err = t.Execute(w, page); err != nil {
+		fmt.Printf("*** Error executing template: %s\n", err)
+		return
+	}
+}
+
+// Serves a PNG of the picture the PPU is drawing.
+func (neserv *NEServer) screen(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if err := png.Encode(w, neserv.NES.Screen()); err != nil {
+		fmt.Printf("*** Error encoding screen: %s\n", err)
+	}
+}
+
+// Serves a PNG of the pattern tables drawn with the palette given in
+// the request, as an attachment if download is set.
+func (neserv *NEServer) chr(w http.ResponseWriter, req *http.Request) {
+	palette, err := strconv.Atoi(req.FormValue("palette"))
+
+	if err != nil || palette < -1 || palette > 7 {
+		palette = 0
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if req.FormValue("download") != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-chr.png\"", path.Base(neserv.NES.ROM.GameName())))
+	}
+
+	if err = png.Encode(w, neserv.NES.PatternTables(palette)); err != nil {
+		fmt.Printf("*** Error encoding pattern tables: %s\n", err)
+	}
+}
+
+// Imports the PNG uploaded in the request into the pattern tables,
+// saving a patched ROM if any CHR ROM was changed.
+func (neserv *NEServer) importCHR(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	palette, err := strconv.Atoi(req.FormValue("palette"))
+
+	if err != nil || palette < -1 || palette > 7 {
+		http.Error(w, fmt.Sprintf("Invalid palette '%s'", req.FormValue("palette")), http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := req.FormFile("file")
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer file.Close()
+
+	img, err := png.Decode(file)
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid PNG: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var patched bool
+	var filename string
+	var saveErr error
+
+	// import between instructions on the emulation goroutine since
+	// it changes CHR the PPU draws with
+	neserv.NES.Call(func() {
+		if patched, err = neserv.NES.ImportPatternTables(img, palette); err == nil && patched {
+			filename, saveErr = neserv.NES.SavePatchedROM()
+		}
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !patched {
+		fmt.Fprintln(w, "Imported pattern tables into CHR RAM")
+		return
+	}
+
+	if err = saveErr; err != nil {
+		http.Error(w, fmt.Sprintf("Error saving patched ROM: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, "Imported pattern tables into CHR ROM, saved patched ROM to", filename)
 }
 
 func (neserv *NEServer) Run() (err error) {
@@ -72,26 +452,87 @@ func (neserv *NEServer) Run() (err error) {
 		neserv.NES.SaveState()
 	})
 
-	http.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
-		page := Page{
-			NES: neserv.NES,
+	http.HandleFunc("/audio-stats", func(w http.ResponseWriter, req *http.Request) {
+		if neserv.NES.RateControl == nil {
+			http.Error(w, "Audio rate control is not running", http.StatusNotFound)
+			return
+		}
+
+		buf, err := json.Marshal(neserv.NES.RateControl.Stats())
+
+		if err != nil {
+			fmt.Printf("*** Error encoding audio stats: %s\n", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf)
+	})
+
+	http.HandleFunc("/palette", func(w http.ResponseWriter, req *http.Request) {
+		e := &nes.PaletteEvent{
+			Name: req.FormValue("name"),
+			Err:  make(chan error, 1),
+		}
+
+		neserv.NES.Send(e)
+
+		if err := <-e.Err; err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+
+	http.HandleFunc("/nametables.png", neserv.nametables)
+	http.HandleFunc("/sprites", neserv.sprites)
+	http.HandleFunc("/events", neserv.events)
+	http.HandleFunc("/screen.png", neserv.screen)
+	http.HandleFunc("/chr.png", neserv.chr)
+	http.HandleFunc("/chr/import", neserv.importCHR)
+
+	http.HandleFunc("/memory/stream", neserv.stream)
+	http.HandleFunc("/memory/poke", neserv.poke)
+
+	http.HandleFunc("/memory/clear", func(w http.ResponseWriter, req *http.Request) {
+		neserv.heatmap.Clear()
+	})
+
+	http.HandleFunc("/memory", func(w http.ResponseWriter, req *http.Request) {
+		page := MemoryPage{
+			NES:     neserv.NES,
+			Regions: neserv.regions,
+			Region:  neserv.region(req.FormValue("region")),
+		}
+
+		if page.Region == nil {
+			page.Region = neserv.regions[0]
 		}
 
-		cpuMemory := make([]byte, m65go2.DEFAULT_MEMORY_SIZE)
+		neserv.heatmap.Start()
+
+		t, err := template.New("memory").Parse(memory)
 
-		for i := uint32(0); i < m65go2.DEFAULT_MEMORY_SIZE; i++ {
-			cpuMemory[i] = neserv.NES.CPU.Memory.Memory.Fetch(uint16(i))
+		if err != nil {
+			fmt.Printf("*** Error parsing template: %s\n", err)
+			return
 		}
 
-		page.CPUMemory = hex.Dump(cpuMemory)
+		err = t.Execute(w, page)
 
-		ppuMemory := make([]byte, m65go2.DEFAULT_MEMORY_SIZE)
+		if err != nil {
+			fmt.Printf("*** Error executing template: %s\n", err)
+			return
+		}
+	})
 
-		for i := uint32(0); i < m65go2.DEFAULT_MEMORY_SIZE; i++ {
-			ppuMemory[i] = neserv.NES.PPU.Memory.Memory.Fetch(uint16(i))
+	http.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		page := Page{
+			NES:      neserv.NES,
+			Scanline: -1,
 		}
 
-		page.PPUMemory = hex.Dump(ppuMemory)
+		if scanline, err := strconv.Atoi(req.FormValue("scanline")); err == nil {
+			page.Scanline = scanline
+		}
 
 		ppuPalette := make([]byte, 32)
 
@@ -117,15 +558,12 @@ func (neserv *NEServer) Run() (err error) {
 
 		page.OAMBufferMemory = hex.Dump(oamBufferMemory)
 
-		left, right := neserv.NES.PPU.GetPatternTables()
+		page.CHRPalettes = []int{0, 1, 2, 3, 4, 5, 6, 7}
+		page.CHRBanks = neserv.NES.CHRBanks()
 
-		buf := new(bytes.Buffer)
-		png.Encode(buf, left)
-		page.PTLeft = base64.StdEncoding.EncodeToString(buf.Bytes())
-
-		buf = new(bytes.Buffer)
-		png.Encode(buf, right)
-		page.PTRight = base64.StdEncoding.EncodeToString(buf.Bytes())
+		if palette, err := strconv.Atoi(req.FormValue("chr-palette")); err == nil && palette >= -1 && palette <= 7 {
+			page.CHRPalette = palette
+		}
 
 		t, err = template.New("index").Parse(index)
 
@@ -45,6 +45,9 @@ var index = `
 		<li><a href='#' id='save-state-link'>Save State</a></li>
 		<li><a href='#' id='load-state-link'>Load State</a></li>
 		<li><a href='#' id='reset-link'>Reset</a></li>
+		<li><a href='/memory'>Memory</a></li>
+		<li><a href='/sprites'>Sprites</a></li>
+		<li><a href='/events'>Events</a></li>
 	      </ul>
 	      <ul class="nav navbar-nav navbar-right">
 		<li><a href='#' id='run-state'></a></li>
@@ -81,6 +84,16 @@ var index = `
 	      <tr><td><kbd>Status</kbd></td>    <td><code>{{printf "$%02x" .NES.CPU.APU.Registers.Status}}</code></td></tr>
 	    </tbody>
 
+	    {{with .NES.RateControl}}{{with .Stats}}
+	    <thead><tr><td><strong>Audio Variable</strong></td><td><strong>Value</strong></td></tr></thead>
+	    <tbody>
+	      <tr><td><kbd>Level</kbd></td>     <td><code>{{printf "%.3f" .Level}}</code></td></tr>
+	      <tr><td><kbd>Underruns</kbd></td> <td><code>{{.Underruns}}</code></td></tr>
+	      <tr><td><kbd>Ratio</kbd></td>     <td><code>{{printf "%.5f" .Ratio}}</code></td></tr>
+	      <tr><td><kbd>Drift</kbd></td>     <td><code>{{printf "%+.5f" .Drift}}</code></td></tr>
+	    </tbody>
+	    {{end}}{{end}}
+
 	    <thead><tr><td><strong>PPU Variable</strong></td><td><strong>Value</strong></td></tr></thead>
 	    <tbody>
 	      <tr><td><kbd>Frame</kbd></td>    <td><code>{{.NES.PPU.Frame}}</code></td></tr>
@@ -120,12 +133,6 @@ var index = `
 
 	  </table>
 
-	  <h4>CPU Memory</h4>
-	  <pre style='font-size: 11px' class='pre-scrollable'>{{.CPUMemory}}</pre>
-
-	  <h4>PPU Memory</h4>
-	  <pre style='font-size: 11px' class='pre-scrollable'>{{.PPUMemory}}</pre>
-
 	  <h4>PPU Palette</h4>
 	  <pre style='font-size: 11px' class='pre-scrollable'>{{.PPUPalette}}</pre>
 
@@ -159,14 +166,57 @@ var index = `
 
 	<div class='col-md-8'>
 	  <h4>PPU Pattern Tables</h4>
+	  <ul class='nav nav-pills'>
+	    <li {{if eq .CHRPalette -1}}class='active'{{end}}><a href='/?chr-palette=-1&scanline={{.Scanline}}'>Grey</a></li>
+	    {{range $i, $p := .CHRPalettes}}
+	    <li {{if eq $p $.CHRPalette}}class='active'{{end}}><a href='/?chr-palette={{$p}}&scanline={{$.Scanline}}'>{{if lt $p 4}}BG {{$p}}{{else}}Sprite {{$p}}{{end}}</a></li>
+	    {{end}}
+	  </ul>
 	</div>
 
-	<div class='col-md-6'>
-          <img alt='left'  style='width:100%;' src='data:image/png;base64,{{.PTLeft}}'  class='img-thumbnail img-responsive' />
+	<div class='col-md-8'>
+          <img alt='pattern tables' style='width:100%; image-rendering:pixelated;' src='/chr.png?palette={{.CHRPalette}}' class='img-thumbnail img-responsive' />
+	  <p><a href='/chr.png?palette={{.CHRPalette}}&download=1'>Export PNG</a></p>
+
+	  <form class='form-inline' method='post' action='/chr/import' enctype='multipart/form-data'>
+	    <input type='hidden' name='palette' value='{{.CHRPalette}}' />
+	    <label for='chr-file'>Import PNG</label>
+	    <input type='file' id='chr-file' name='file' accept='image/png' class='form-control input-sm' />
+	    <button type='submit' class='btn btn-default btn-sm'>Import</button>
+	    <span class='help-block'>
+	      Pixels are matched to the colours of the selected palette.
+	      CHR RAM is written directly, CHR ROM is patched and saved
+	      as a new .nes file.
+	    </span>
+	  </form>
 	</div>
 
-	<div class='col-md-6'>
-          <img alt='right' style='width:100%;' src='data:image/png;base64,{{.PTRight}}' class='img-thumbnail img-responsive' />
+	<div class='col-md-4'>
+	  <table class='table table-striped table-condensed'>
+	    <thead><tr><td><strong>Bank</strong></td></tr></thead>
+	    <tbody>
+	      {{range .CHRBanks}}
+	      <tr><td><code>{{.}}</code></td></tr>
+	      {{end}}
+	    </tbody>
+	  </table>
+	</div>
+
+      </div>
+      <div class='row'>
+
+	<div class='col-md-8'>
+	  <h4>PPU Nametables</h4>
+	  <form class='form-inline' method='get' action='/'>
+	    <label for='scanline'>Capture at scanline</label>
+	    <input type='number' id='scanline' name='scanline' min='-1' max='261' value='{{.Scanline}}' class='form-control input-sm' />
+	    <button type='submit' class='btn btn-default btn-sm'>Capture</button>
+	    <span class='help-block'>-1 captures immediately, the outline shows the area on screen</span>
+	  </form>
+	</div>
+
+	<div class='col-md-12'>
+          <img alt='nametables' style='width:100%; max-width:1024px; image-rendering:pixelated;' src='/nametables.png?scanline={{.Scanline}}' class='img-thumbnail img-responsive' />
 	</div>
 
       </div>
@@ -239,3 +289,371 @@ var index = `
   </body>
 </html>
 `
+
+var memory = `
+<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta http-equiv="X-UA-Compatible" content="IE=edge">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>nintengo - {{.NES.ROM.GameName}} - {{.Region.Title}}</title>
+
+    <!-- Latest compiled and minified CSS -->
+    <link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/bootstrap/3.2.0/css/bootstrap.min.css">
+
+    <!-- Optional theme -->
+    <link href="//maxcdn.bootstrapcdn.com/bootswatch/3.2.0/darkly/bootstrap.min.css" rel="stylesheet">
+
+    <style>
+     body { padding-top: 70px; }
+     table.memory { font-family: monospace; font-size: 11px; }
+     table.memory td { padding: 1px 4px; text-align: center; }
+     table.memory td.byte { cursor: pointer; }
+     table.memory th { padding: 1px 4px; color: #888; }
+    </style>
+  </head>
+  <body>
+    <div class='container'>
+      <div class='row'>
+	<nav class="navbar navbar-default navbar-fixed-top" role="navigation">
+	  <div class="container-fluid">
+	    <div class="navbar-header">
+	      <a class="navbar-brand" href="/">nintengo</a>
+	    </div>
+
+	    <ul class="nav navbar-nav">
+	      {{range .Regions}}
+	      <li {{if eq .Name $.Region.Name}}class='active'{{end}}><a href='/memory?region={{.Name}}'>{{.Title}}</a></li>
+	      {{end}}
+	    </ul>
+	    <ul class="nav navbar-nav navbar-right">
+	      <li><a href='#' id='clear-link'>Clear Counts</a></li>
+	    </ul>
+	  </div>
+	</nav>
+
+	<div class='col-md-12'>
+	  <p>
+	    Background colour shows accesses since the counts were last
+	    cleared: <span style='color: #f44'>writes</span> in red,
+	    <span style='color: #4f4'>reads</span> in green and
+	    <span style='color: #44f'>executes</span> in blue.  Click a
+	    byte to change its value.
+	  </p>
+
+	  <table class='memory' id='memory'>
+	    <thead>
+	      <tr><th></th>{{range $i := .Region.Columns}}<th>{{printf "%x" $i}}</th>{{end}}</tr>
+	    </thead>
+	    <tbody>
+	      {{range $row := .Region.Rows}}
+	      <tr>
+		<th>{{printf "$%04x" $row}}</th>
+		{{range $i := $.Region.Columns}}<td class='byte'></td>{{end}}
+	      </tr>
+	      {{end}}
+	    </tbody>
+	  </table>
+	</div>
+      </div>
+    </div>
+
+    <!-- jQuery (necessary for Bootstrap's JavaScript plugins) -->
+    <script src="https://ajax.googleapis.com/ajax/libs/jquery/1.11.1/jquery.min.js"></script>
+    <!-- Latest compiled and minified JavaScript -->
+    <script src="https://maxcdn.bootstrapcdn.com/bootstrap/3.2.0/js/bootstrap.min.js"></script>
+
+    <script>
+     var region = '{{.Region.Name}}';
+     var cells = $('#memory td.byte');
+
+     // scale each count logarithmically against the largest count of
+     // its kind so that rarely accessed bytes remain visible
+     function shade(count, max) {
+       if (count == 0) {
+	 return 0;
+       }
+
+       return Math.round(64 + 191 * Math.log(count + 1) / Math.log(max + 1));
+     }
+
+     var source = new EventSource('/memory/stream?region=' + region);
+
+     source.onmessage = function(e) {
+       var update = JSON.parse(e.data);
+       var maxReads = Math.max.apply(null, update.reads);
+       var maxWrites = Math.max.apply(null, update.writes);
+       var maxExecutes = Math.max.apply(null, update.executes);
+
+       cells.each(function(i) {
+	 var r = shade(update.writes[i], maxWrites);
+	 var g = shade(update.reads[i], maxReads);
+	 var b = shade(update.executes[i], maxExecutes);
+
+	 $(this).text(update.values.substr(2 * i, 2));
+	 $(this).css('background-color', 'rgb(' + r + ',' + g + ',' + b + ')');
+	 $(this).attr('title', 'reads: ' + update.reads[i] + ', writes: ' + update.writes[i] + ', executes: ' + update.executes[i]);
+       });
+     };
+
+     cells.click(function() {
+       var offset = cells.index(this);
+       var value = prompt('New value (hex)', $(this).text());
+
+       if (value != null) {
+	 $.post('/memory/poke', {region: region, offset: offset.toString(16), value: value});
+       }
+     });
+
+     $('#clear-link').click(function(e) {
+       e.preventDefault();
+       $.get('/memory/clear');
+     });
+    </script>
+  </body>
+</html>
+`
+
+var sprites = `
+<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta http-equiv="X-UA-Compatible" content="IE=edge">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>nintengo - {{.NES.ROM.GameName}} - Sprites</title>
+
+    <!-- Latest compiled and minified CSS -->
+    <link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/bootstrap/3.2.0/css/bootstrap.min.css">
+
+    <!-- Optional theme -->
+    <link href="//maxcdn.bootstrapcdn.com/bootswatch/3.2.0/darkly/bootstrap.min.css" rel="stylesheet">
+
+    <style>
+     body { padding-top: 70px; }
+     table.sprites { font-family: monospace; font-size: 11px; }
+     table.sprites td { padding: 1px 4px; vertical-align: middle; }
+     img.sprite { width: 32px; image-rendering: pixelated; background: #444; }
+    </style>
+  </head>
+  <body>
+    <div class='container'>
+      <div class='row'>
+	<nav class="navbar navbar-default navbar-fixed-top" role="navigation">
+	  <div class="container-fluid">
+	    <div class="navbar-header">
+	      <a class="navbar-brand" href="/">nintengo</a>
+	    </div>
+
+	    <ul class="nav navbar-nav">
+	      <li><a href='/memory'>Memory</a></li>
+	      <li class='active'><a href='/sprites'>Sprites</a></li>
+	      <li><a href='/events'>Events</a></li>
+	    </ul>
+	  </div>
+	</nav>
+
+	<div class='col-md-7'>
+	  <h4>OAM</h4>
+	  <table class='table table-striped table-condensed sprites'>
+	    <thead><tr><th>#</th><th>Sprite</th><th>X</th><th>Y</th><th>Tile</th><th>Address</th><th>Palette</th><th>Priority</th><th>Flip</th></tr></thead>
+	    <tbody>
+	      {{range .Sprites}}
+	      <tr>
+		<td>{{.Index}}</td>
+		<td><img class='sprite' alt='sprite {{.Index}}' src='data:image/png;base64,{{.Image}}' /></td>
+		<td>{{.X}}</td>
+		<td>{{.Y}}</td>
+		<td>{{printf "$%02x" .Tile}}</td>
+		<td>{{printf "$%04x" .Address}}</td>
+		<td>{{.Palette}}</td>
+		<td>{{if .Behind}}behind{{else}}front{{end}}</td>
+		<td>{{if .FlipHorizontally}}H{{end}}{{if .FlipVertically}}V{{end}}</td>
+	      </tr>
+	      {{end}}
+	    </tbody>
+	  </table>
+	</div>
+
+	<div class='col-md-5'>
+	  <h4>Scanlines</h4>
+	  <p>
+	    The sprites sprite evaluation selected for each scanline of
+	    the last frame, and the OAM address at which it set the
+	    sprite overflow flag.
+	  </p>
+	  <table class='table table-striped table-condensed sprites'>
+	    <thead><tr><th>Scanline</th><th>Sprites</th><th>Overflow</th></tr></thead>
+	    <tbody>
+	      {{range .Scanlines}}
+	      <tr>
+		<td>{{.Scanline}}</td>
+		<td>{{range .Sprites}}{{.}} {{end}}</td>
+		<td>{{if ge .Overflow 0}}{{printf "$%02x" .Overflow}}{{end}}</td>
+	      </tr>
+	      {{end}}
+	    </tbody>
+	  </table>
+	</div>
+
+      </div>
+    </div>
+  </body>
+</html>
+`
+
+var events = `
+<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta http-equiv="X-UA-Compatible" content="IE=edge">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>nintengo - {{.NES.ROM.GameName}} - Events</title>
+
+    <!-- Latest compiled and minified CSS -->
+    <link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/bootstrap/3.2.0/css/bootstrap.min.css">
+
+    <!-- Optional theme -->
+    <link href="//maxcdn.bootstrapcdn.com/bootswatch/3.2.0/darkly/bootstrap.min.css" rel="stylesheet">
+
+    <style>
+     body { padding-top: 70px; }
+     canvas#grid { cursor: crosshair; image-rendering: pixelated; }
+     pre#details { min-height: 120px; font-size: 11px; }
+     table.events { font-family: monospace; font-size: 11px; }
+     table.events td { padding: 1px 4px; }
+     span.swatch { display: inline-block; width: 10px; height: 10px; margin-right: 4px; }
+     div.events { max-height: 400px; overflow-y: auto; }
+    </style>
+  </head>
+  <body>
+    <div class='container'>
+      <div class='row'>
+	<nav class="navbar navbar-default navbar-fixed-top" role="navigation">
+	  <div class="container-fluid">
+	    <div class="navbar-header">
+	      <a class="navbar-brand" href="/">nintengo</a>
+	    </div>
+
+	    <ul class="nav navbar-nav">
+	      <li><a href='/memory'>Memory</a></li>
+	      <li><a href='/sprites'>Sprites</a></li>
+	      <li class='active'><a href='/events'>Events</a></li>
+	    </ul>
+	  </div>
+	</nav>
+
+	<div class='col-md-8'>
+	  <h4>Frame {{.Frame}} <small><a href='/events'>Refresh</a></small></h4>
+	  <canvas id='grid' width='682' height='524'></canvas>
+	</div>
+
+	<div class='col-md-4'>
+	  <h4>Legend</h4>
+	  <ul id='legend' class='list-unstyled'></ul>
+	  <h4>Details</h4>
+	  <pre id='details'>Hover over the grid to see the events near a scanline and cycle.</pre>
+	</div>
+
+	<div class='col-md-12'>
+	  <h4>Events</h4>
+	  <div class='events'>
+	    <table class='table table-striped table-condensed events'>
+	      <thead><tr><th>Scanline</th><th>Cycle</th><th>PC</th><th>Event</th></tr></thead>
+	      <tbody>
+		{{range .Events}}
+		<tr>
+		  <td>{{.Scanline}}</td>
+		  <td>{{.Cycle}}</td>
+		  <td>{{.PC}}</td>
+		  <td>{{.Text}}</td>
+		</tr>
+		{{end}}
+	      </tbody>
+	    </table>
+	  </div>
+	</div>
+
+      </div>
+    </div>
+
+    <!-- jQuery (necessary for Bootstrap's JavaScript plugins) -->
+    <script src="https://ajax.googleapis.com/ajax/libs/jquery/1.11.1/jquery.min.js"></script>
+    <!-- Include all compiled plugins (include this after jQuery) -->
+    <script src="https://maxcdn.bootstrapcdn.com/bootstrap/3.2.0/js/bootstrap.min.js"></script>
+
+    <script>
+     var events = {{.Events}};
+     var scale = 2;
+
+     // colours of the PPU registers $2000-$2007, then mapper
+     // writes, IRQs and NMIs
+     var types = [
+       { name: 'PPUCTRL ($2000)', color: '#ff4040' },
+       { name: 'PPUMASK ($2001)', color: '#ff9f40' },
+       { name: 'PPUSTATUS ($2002)', color: '#ffff40' },
+       { name: 'OAMADDR ($2003)', color: '#9fff40' },
+       { name: 'OAMDATA ($2004)', color: '#40ff9f' },
+       { name: 'PPUSCROLL ($2005)', color: '#40ffff' },
+       { name: 'PPUADDR ($2006)', color: '#409fff' },
+       { name: 'PPUDATA ($2007)', color: '#9f40ff' },
+       { name: 'Mapper register', color: '#ff40ff' },
+       { name: 'IRQ', color: '#ffffff' },
+       { name: 'NMI', color: '#808080' }
+     ];
+
+     function type(e) {
+       return e.register >= 0 ? e.register : 7 + e.kind;
+     }
+
+     $.each(types, function(i, t) {
+       $('#legend').append($('<li>').append($('<span class="swatch">').css('background', t.color)).append(document.createTextNode(t.name)));
+     });
+
+     var canvas = document.getElementById('grid');
+     var ctx = canvas.getContext('2d');
+     var screen = new Image();
+
+     // cycles 1-256 of scanlines 0-239 draw the picture
+     screen.onload = function() {
+       ctx.imageSmoothingEnabled = false;
+       ctx.drawImage(screen, scale, 0, 256 * scale, 240 * scale);
+       draw();
+     };
+
+     function draw() {
+       ctx.fillStyle = 'rgba(0, 0, 0, 0.6)';
+       ctx.fillRect(0, 0, scale, 240 * scale);
+       ctx.fillRect(257 * scale, 0, 84 * scale, 240 * scale);
+       ctx.fillRect(0, 240 * scale, 341 * scale, 22 * scale);
+
+       $.each(events, function(i, e) {
+	 ctx.fillStyle = types[type(e)].color;
+	 ctx.fillRect((e.cycle - 1) * scale, (e.scanline - 1) * scale, 3 * scale, 3 * scale);
+       });
+     }
+
+     ctx.fillStyle = '#000';
+     ctx.fillRect(0, 0, canvas.width, canvas.height);
+     screen.src = '/screen.png?' + Date.now();
+
+     $(canvas).mousemove(function(ev) {
+       var offset = $(canvas).offset();
+       var cycle = Math.floor((ev.pageX - offset.left) / scale);
+       var scanline = Math.floor((ev.pageY - offset.top) / scale);
+       var text = 'Scanline ' + scanline + ', cycle ' + cycle + '\n';
+
+       $.each(events, function(i, e) {
+	 if (Math.abs(e.cycle - cycle) <= 2 && Math.abs(e.scanline - scanline) <= 2) {
+	   text += '\n' + e.scanline + ':' + e.cycle + ' ' + e.text + ' at ' + e.pc;
+	 }
+       });
+
+       $('#details').text(text);
+     });
+    </script>
+  </body>
+</html>
+`
@@ -0,0 +1,738 @@
+package m65go2
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Replaces the NMOS 6502's unofficial opcodes in the InstructionTable
+// with the WDC 65C02's additional instructions, addressing modes and
+// NOPs and updates the cycle counts that the 65C02 changed.
+func (instructions InstructionTable) InitCMOSInstructions() {
+	for opcode, inst := range instructions.opcodes {
+		if inst != nil && strings.HasPrefix(inst.Mneumonic, "*") {
+			instructions.RemoveInstruction(OpCode(opcode))
+		}
+	}
+
+	// ORA, AND, EOR, ADC, STA, LDA, CMP, SBC
+
+	//     (Zero Page)
+	for _, i := range []struct {
+		mneumonic string
+		opcode    OpCode
+		exec      func(cpu *M6502, address uint16)
+	}{
+		{"ORA", 0x12, (*M6502).Ora},
+		{"AND", 0x32, (*M6502).And},
+		{"EOR", 0x52, (*M6502).Eor},
+		{"ADC", 0x72, (*M6502).Adc},
+		{"STA", 0x92, (*M6502).Sta},
+		{"LDA", 0xb2, (*M6502).Lda},
+		{"CMP", 0xd2, (*M6502).Cmp},
+		{"SBC", 0xf2, (*M6502).Sbc},
+	} {
+		exec := i.exec
+
+		instructions.AddInstruction(&Instruction{
+			Mneumonic: i.mneumonic,
+			OpCode:    i.opcode,
+			Exec: func(cpu *M6502) (status InstructionStatus) {
+				exec(cpu, cpu.zeroPageIndirectAddress())
+				return
+			}})
+
+		instructions.setTiming(i.opcode, 2, 5, 5)
+	}
+
+	// ADC, SBC
+
+	//     Decimal mode takes an extra cycle
+	for _, o := range []OpCode{
+		0x61, 0x65, 0x69, 0x6d, 0x71, 0x72, 0x75, 0x79, 0x7d,
+		0xe1, 0xe5, 0xe9, 0xed, 0xf1, 0xf2, 0xf5, 0xf9, 0xfd,
+	} {
+		inst := instructions.opcodes[o]
+		exec := inst.Exec
+
+		instructions.AddInstruction(&Instruction{
+			Mneumonic: inst.Mneumonic,
+			OpCode:    inst.OpCode,
+			Exec: func(cpu *M6502) (status InstructionStatus) {
+				status = exec(cpu)
+
+				if cpu.Registers.P&D != 0 {
+					status |= DecimalPenalty
+				}
+
+				return
+			}})
+	}
+
+	// BIT
+
+	//     Immediate
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "BIT",
+		OpCode:    0x89,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.BitImmediate(cpu.immediateAddress())
+			return
+		}})
+
+	instructions.setTiming(0x89, 2, 2, 2)
+
+	//     Zero Page,X
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "BIT",
+		OpCode:    0x34,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Bit(cpu.zeroPageIndexedAddress(X))
+			return
+		}})
+
+	instructions.setTiming(0x34, 2, 4, 4)
+
+	//     Absolute,X
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "BIT",
+		OpCode:    0x3c,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Bit(cpu.absoluteIndexedAddress(X, &status))
+			return
+		}})
+
+	instructions.setTiming(0x3c, 3, 4, 5)
+
+	// INC
+
+	//     Accumulator
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "INC",
+		OpCode:    0x1a,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.IncA()
+			return
+		}})
+
+	instructions.setTiming(0x1a, 1, 2, 2)
+
+	// DEC
+
+	//     Accumulator
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "DEC",
+		OpCode:    0x3a,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.DecA()
+			return
+		}})
+
+	instructions.setTiming(0x3a, 1, 2, 2)
+
+	// ASL, ROL, LSR, ROR
+
+	//     Absolute,X only takes an extra cycle on a page cross
+	for _, o := range []OpCode{0x1e, 0x3e, 0x5e, 0x7e} {
+		instructions.setTiming(o, 3, 6, 7)
+	}
+
+	// JMP
+
+	//     Indirect takes an extra cycle to fix the page wrap bug
+	instructions.setTiming(0x6c, 3, 6, 6)
+
+	//     (Absolute,X)
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "JMP",
+		OpCode:    0x7c,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Jmp(cpu.absoluteIndexedIndirectAddress())
+			return
+		}})
+
+	instructions.setTiming(0x7c, 3, 6, 6)
+
+	// BRA
+
+	//     Relative
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "BRA",
+		OpCode:    0x80,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Bra(cpu.relativeAddress(), &status)
+			return
+		}})
+
+	instructions.setTiming(0x80, 2, 2, 3)
+
+	// PHX, PHY, PLX, PLY
+
+	//     Implied
+	for _, i := range []struct {
+		mneumonic string
+		opcode    OpCode
+		cycles    uint16
+		exec      func(cpu *M6502)
+	}{
+		{"PHX", 0xda, 3, (*M6502).Phx},
+		{"PHY", 0x5a, 3, (*M6502).Phy},
+		{"PLX", 0xfa, 4, (*M6502).Plx},
+		{"PLY", 0x7a, 4, (*M6502).Ply},
+	} {
+		exec := i.exec
+
+		instructions.AddInstruction(&Instruction{
+			Mneumonic: i.mneumonic,
+			OpCode:    i.opcode,
+			Exec: func(cpu *M6502) (status InstructionStatus) {
+				exec(cpu)
+				return
+			}})
+
+		instructions.setTiming(i.opcode, 1, i.cycles, i.cycles)
+	}
+
+	// STZ
+
+	//     Zero Page
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "STZ",
+		OpCode:    0x64,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Stz(cpu.zeroPageAddress())
+			return
+		}})
+
+	instructions.setTiming(0x64, 2, 3, 3)
+
+	//     Zero Page,X
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "STZ",
+		OpCode:    0x74,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Stz(cpu.zeroPageIndexedAddress(X))
+			return
+		}})
+
+	instructions.setTiming(0x74, 2, 4, 4)
+
+	//     Absolute
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "STZ",
+		OpCode:    0x9c,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Stz(cpu.absoluteAddress())
+			return
+		}})
+
+	instructions.setTiming(0x9c, 3, 4, 4)
+
+	//     Absolute,X
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "STZ",
+		OpCode:    0x9e,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Stz(cpu.absoluteIndexedAddress(X, nil))
+			return
+		}})
+
+	instructions.setTiming(0x9e, 3, 5, 5)
+
+	// TSB
+
+	//     Zero Page
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "TSB",
+		OpCode:    0x04,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Tsb(cpu.zeroPageAddress())
+			return
+		}})
+
+	instructions.setTiming(0x04, 2, 5, 5)
+
+	//     Absolute
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "TSB",
+		OpCode:    0x0c,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Tsb(cpu.absoluteAddress())
+			return
+		}})
+
+	instructions.setTiming(0x0c, 3, 6, 6)
+
+	// TRB
+
+	//     Zero Page
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "TRB",
+		OpCode:    0x14,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Trb(cpu.zeroPageAddress())
+			return
+		}})
+
+	instructions.setTiming(0x14, 2, 5, 5)
+
+	//     Absolute
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "TRB",
+		OpCode:    0x1c,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Trb(cpu.absoluteAddress())
+			return
+		}})
+
+	instructions.setTiming(0x1c, 3, 6, 6)
+
+	// RMB, SMB, BBR, BBS
+
+	for b := uint8(0); b < 8; b++ {
+		bit := b
+
+		//     Zero Page
+		instructions.AddInstruction(&Instruction{
+			Mneumonic: fmt.Sprintf("RMB%d", bit),
+			OpCode:    OpCode(bit<<4 | 0x07),
+			Exec: func(cpu *M6502) (status InstructionStatus) {
+				cpu.Rmb(bit, cpu.zeroPageAddress())
+				return
+			}})
+
+		instructions.setTiming(OpCode(bit<<4|0x07), 2, 5, 5)
+
+		instructions.AddInstruction(&Instruction{
+			Mneumonic: fmt.Sprintf("SMB%d", bit),
+			OpCode:    OpCode(bit<<4 | 0x87),
+			Exec: func(cpu *M6502) (status InstructionStatus) {
+				cpu.Smb(bit, cpu.zeroPageAddress())
+				return
+			}})
+
+		instructions.setTiming(OpCode(bit<<4|0x87), 2, 5, 5)
+
+		//     Zero Page,Relative
+		instructions.AddInstruction(&Instruction{
+			Mneumonic: fmt.Sprintf("BBR%d", bit),
+			OpCode:    OpCode(bit<<4 | 0x0f),
+			Exec: func(cpu *M6502) (status InstructionStatus) {
+				address, target := cpu.zeroPageRelativeAddress()
+				cpu.Bbr(bit, address, target, &status)
+				return
+			}})
+
+		instructions.setTiming(OpCode(bit<<4|0x0f), 3, 5, 6)
+
+		instructions.AddInstruction(&Instruction{
+			Mneumonic: fmt.Sprintf("BBS%d", bit),
+			OpCode:    OpCode(bit<<4 | 0x8f),
+			Exec: func(cpu *M6502) (status InstructionStatus) {
+				address, target := cpu.zeroPageRelativeAddress()
+				cpu.Bbs(bit, address, target, &status)
+				return
+			}})
+
+		instructions.setTiming(OpCode(bit<<4|0x8f), 3, 5, 6)
+	}
+
+	// WAI
+
+	//     Implied
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "WAI",
+		OpCode:    0xcb,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Wai()
+			return
+		}})
+
+	instructions.setTiming(0xcb, 1, 3, 3)
+
+	// STP
+
+	//     Implied
+	instructions.AddInstruction(&Instruction{
+		Mneumonic: "STP",
+		OpCode:    0xdb,
+		Exec: func(cpu *M6502) (status InstructionStatus) {
+			cpu.Stp()
+			return
+		}})
+
+	instructions.setTiming(0xdb, 1, 3, 3)
+
+	// NOP
+
+	//     Every remaining opcode is a NOP that skips its operands
+	for o := range instructions.opcodes {
+		opcode := OpCode(o)
+
+		if instructions.opcodes[opcode] != nil {
+			continue
+		}
+
+		var size, cycles uint16
+
+		switch {
+		case opcode&0x0f == 0x02:
+			size, cycles = 2, 2
+		case opcode == 0x44:
+			size, cycles = 2, 3
+		case opcode == 0x54, opcode == 0xd4, opcode == 0xf4:
+			size, cycles = 2, 4
+		case opcode == 0x5c:
+			size, cycles = 3, 8
+		case opcode == 0xdc, opcode == 0xfc:
+			size, cycles = 3, 4
+		default:
+			size, cycles = 1, 1
+		}
+
+		n := size
+
+		instructions.AddInstruction(&Instruction{
+			Mneumonic: "NOP",
+			OpCode:    opcode,
+			Exec: func(cpu *M6502) (status InstructionStatus) {
+				cpu.Registers.PC += n - 1
+				cpu.Nop()
+				return
+			}})
+
+		instructions.setTiming(opcode, size, cycles, cycles)
+	}
+}
+
+// Sets the size and cycle counts of an opcode.
+func (instructions InstructionTable) setTiming(opcode OpCode, size, cycles, cyclesPageCross uint16) {
+	instructions.sizes[opcode] = size
+	instructions.cycles[opcode] = cycles
+	instructions.cyclesPageCross[opcode] = cyclesPageCross
+}
+
+// Returns whether a CPU halted by WAI or STP should resume executing
+// instructions.  WAI is ended by any interrupt, even a masked IRQ, and
+// STP only by a reset.
+func (cpu *M6502) resume() bool {
+	switch {
+	case cpu.Rst:
+	case cpu.waiting && (cpu.Irq || cpu.Nmi):
+	default:
+		return false
+	}
+
+	cpu.waiting = false
+	cpu.stopped = false
+
+	return true
+}
+
+func (cpu *M6502) zeroPageIndirectAddress() (result uint16) {
+	value := cpu.Memory.Fetch(cpu.Registers.PC)
+	address := uint16(value)
+	cpu.Registers.PC++
+
+	low := cpu.Memory.Fetch(address)
+	high := cpu.Memory.Fetch((address + 1) & 0x00ff)
+
+	result = (uint16(high) << 8) | uint16(low)
+
+	if cpu.decode.decoding {
+		cpu.decode.args = fmt.Sprintf("%02X", value)
+		cpu.decode.decodedArgs = fmt.Sprintf("($%02X) = %04X = ", value, result)
+	}
+
+	return
+}
+
+func (cpu *M6502) absoluteIndexedIndirectAddress() (result uint16) {
+	low := cpu.Memory.Fetch(cpu.Registers.PC)
+	high := cpu.Memory.Fetch(cpu.Registers.PC + 1)
+	cpu.Registers.PC += 2
+
+	address := ((uint16(high) << 8) | uint16(low)) + uint16(cpu.Registers.X)
+
+	result = (uint16(cpu.Memory.Fetch(address+1)) << 8) | uint16(cpu.Memory.Fetch(address))
+
+	if cpu.decode.decoding {
+		cpu.decode.args = fmt.Sprintf("%02X %02X", low, high)
+		cpu.decode.decodedArgs = fmt.Sprintf("($%02X%02X,X) @ %04X = %04X", high, low, address, result)
+	}
+
+	return
+}
+
+func (cpu *M6502) zeroPageRelativeAddress() (address uint16, target uint16) {
+	value := cpu.Memory.Fetch(cpu.Registers.PC)
+	offset := uint16(cpu.Memory.Fetch(cpu.Registers.PC + 1))
+	cpu.Registers.PC += 2
+
+	if offset > 0x7f {
+		offset = -(0x0100 - offset)
+	}
+
+	address = uint16(value)
+	target = cpu.Registers.PC + offset
+
+	if cpu.decode.decoding {
+		cpu.decode.args = fmt.Sprintf("%02X %02X", value, uint8(offset))
+		cpu.decode.decodedArgs = fmt.Sprintf("$%02X,$%04X", value, target)
+	}
+
+	return
+}
+
+// Performs a BIT with an immediate value, which only affects the zero
+// flag.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Set if the result if the AND is zero
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) BitImmediate(address uint16) {
+	value := cpu.Memory.Fetch(address)
+
+	if cpu.decode.decoding {
+		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
+	}
+
+	cpu.setZFlag(value & cpu.Registers.A)
+}
+
+// Adds one to the accumulator setting the zero and negative flags as
+// appropriate.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Set if A is zero
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Set if bit 7 of A is set
+func (cpu *M6502) IncA() {
+	cpu.increment(&cpu.Registers.A)
+}
+
+// Subtracts one from the accumulator setting the zero and negative
+// flags as appropriate.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Set if A is zero
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Set if bit 7 of A is set
+func (cpu *M6502) DecA() {
+	cpu.decrement(&cpu.Registers.A)
+}
+
+// Always adds the relative displacement to the program counter to
+// cause a branch to a new location.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Bra(address uint16, status *InstructionStatus) {
+	cpu.branch(address, func() bool { return true }, status)
+}
+
+// Pushes a copy of the X register on to the stack.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Phx() {
+	cpu.push(cpu.Registers.X)
+}
+
+// Pushes a copy of the Y register on to the stack.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Phy() {
+	cpu.push(cpu.Registers.Y)
+}
+
+// Pulls an 8 bit value from the stack and into the X register. The
+// zero and negative flags are set as appropriate.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Set if X = 0
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Set if bit 7 of X is set
+func (cpu *M6502) Plx() {
+	cpu.Registers.X = cpu.setZNFlags(cpu.pull())
+}
+
+// Pulls an 8 bit value from the stack and into the Y register. The
+// zero and negative flags are set as appropriate.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Set if Y = 0
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Set if bit 7 of Y is set
+func (cpu *M6502) Ply() {
+	cpu.Registers.Y = cpu.setZNFlags(cpu.pull())
+}
+
+// Stores zero into memory.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Stz(address uint16) {
+	cpu.store(address, 0)
+}
+
+// Sets the bits of a memory location that are set in the accumulator.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Set if A AND the memory value is zero
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Tsb(address uint16) {
+	value := cpu.Memory.Fetch(address)
+
+	if cpu.decode.decoding {
+		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
+	}
+
+	cpu.setZFlag(value & cpu.Registers.A)
+	cpu.Memory.Store(address, value|cpu.Registers.A)
+}
+
+// Clears the bits of a memory location that are set in the
+// accumulator.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Set if A AND the memory value is zero
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Trb(address uint16) {
+	value := cpu.Memory.Fetch(address)
+
+	if cpu.decode.decoding {
+		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
+	}
+
+	cpu.setZFlag(value & cpu.Registers.A)
+	cpu.Memory.Store(address, value&^cpu.Registers.A)
+}
+
+// Clears a bit of a zero page memory location.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Rmb(bit uint8, address uint16) {
+	cpu.Memory.Store(address, cpu.Memory.Fetch(address)&^(1<<bit))
+}
+
+// Sets a bit of a zero page memory location.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Smb(bit uint8, address uint16) {
+	cpu.Memory.Store(address, cpu.Memory.Fetch(address)|(1<<bit))
+}
+
+// If a bit of a zero page memory location is clear then branch to the
+// target location.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Bbr(bit uint8, address uint16, target uint16, status *InstructionStatus) {
+	value := cpu.Memory.Fetch(address)
+	cpu.branch(target, func() bool { return value&(1<<bit) == 0 }, status)
+}
+
+// If a bit of a zero page memory location is set then branch to the
+// target location.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Bbs(bit uint8, address uint16, target uint16, status *InstructionStatus) {
+	value := cpu.Memory.Fetch(address)
+	cpu.branch(target, func() bool { return value&(1<<bit) != 0 }, status)
+}
+
+// Halts the CPU until an interrupt occurs.  A masked IRQ resumes
+// execution at the next instruction without being serviced.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Wai() {
+	cpu.waiting = true
+}
+
+// Halts the CPU until it is reset.
+//
+//	C 	Carry Flag 	  Not affected
+//	Z 	Zero Flag 	  Not affected
+//	I 	Interrupt Disable Not affected
+//	D 	Decimal Mode Flag Not affected
+//	B 	Break Command 	  Not affected
+//	V 	Overflow Flag 	  Not affected
+//	N 	Negative Flag 	  Not affected
+func (cpu *M6502) Stp() {
+	cpu.stopped = true
+}
@@ -51,11 +51,28 @@ func (reg *Registers) Reset() {
 	reg.PC = 0xfffc
 }
 
-// Prints the values of each register to os.Stderr.
+// Prints the values of each register to os.Stderr.  The unused bit
+// of P is always shown as set since that is how the 6502 pushes it.
 func (reg *Registers) String() string {
-	return fmt.Sprintf("A:%02X X:%02X Y:%02X P:%02X SP:%02X", reg.A, reg.X, reg.Y, reg.P, reg.SP)
+	return fmt.Sprintf("A:%02X X:%02X Y:%02X P:%02X SP:%02X", reg.A, reg.X, reg.Y, reg.P|U, reg.SP)
 }
 
+// Identifies which member of the 6502 family an M6502 simulates.
+type Variant uint8
+
+const (
+	// The NMOS 6502, including its decimal mode and unofficial
+	// opcodes
+	MOS6502 Variant = iota
+	// The Ricoh 2A03 used in the NES, an NMOS 6502 whose decimal
+	// mode has been disconnected
+	RP2A03
+	// The WDC 65C02, with its additional opcodes and addressing
+	// modes, single and multi-byte NOPs in place of the NMOS
+	// unofficial opcodes and fixed JMP ($xxFF)
+	WDC65C02
+)
+
 type Interrupt uint8
 
 const (
@@ -74,6 +91,9 @@ const (
 
 type decode struct {
 	enabled     bool
+	active      func(pc uint16) bool
+	trace       func(pc uint16, line string, ticks uint64)
+	decoding    bool
 	pc          uint16
 	opcode      OpCode
 	args        string
@@ -91,27 +111,44 @@ func (d *decode) String() string {
 // Represents the 6502 CPU.
 type M6502 struct {
 	decode       decode
+	hooks        hooks
+	profiler     *Profiler
 	Nmi          bool
 	Irq          bool
 	Rst          bool
 	Registers    Registers
 	Memory       Memory
+	Cycles       uint64
 	Instructions InstructionTable `json:"-"`
+	variant      Variant
 	decimalMode  bool
 	breakError   bool
+	waiting      bool
+	stopped      bool
 }
 
-// Returns a pointer to a new CPU with the given Memory.
+// Returns a pointer to a new NMOS 6502 CPU with the given Memory.
 func NewM6502(mem Memory) *M6502 {
+	return NewM6502Variant(mem, MOS6502)
+}
+
+// Returns a pointer to a new CPU of the given variant with the given
+// Memory.
+func NewM6502Variant(mem Memory, variant Variant) *M6502 {
 	instructions := NewInstructionTable()
 	instructions.InitInstructions()
 
+	if variant == WDC65C02 {
+		instructions.InitCMOSInstructions()
+	}
+
 	return &M6502{
 		decode:       decode{},
 		Registers:    NewRegisters(),
 		Memory:       mem,
 		Instructions: instructions,
-		decimalMode:  true,
+		variant:      variant,
+		decimalMode:  variant != RP2A03,
 		breakError:   false,
 		Nmi:          false,
 		Irq:          false,
@@ -119,6 +156,11 @@ func NewM6502(mem Memory) *M6502 {
 	}
 }
 
+// Returns the member of the 6502 family the CPU simulates.
+func (cpu *M6502) Variant() Variant {
+	return cpu.variant
+}
+
 // Resets the CPU by resetting both the registers and memory.
 func (cpu *M6502) Reset() {
 	cpu.Registers.Reset()
@@ -127,6 +169,10 @@ func (cpu *M6502) Reset() {
 }
 
 func (cpu *M6502) Interrupt(which Interrupt, state bool) {
+	if len(cpu.hooks.interruptLine) != 0 && cpu.GetInterrupt(which) != state {
+		cpu.interruptLineHooks(which, state)
+	}
+
 	switch which {
 	case Irq:
 		cpu.Irq = state
@@ -180,34 +226,75 @@ func (cpu *M6502) PerformInterrupts() (cycles uint16) {
 }
 
 func (cpu *M6502) PerformIrq() {
+	pc := cpu.Registers.PC
+
 	cpu.push16(cpu.Registers.PC)
 	cpu.push(uint8((cpu.Registers.P | U) & ^B))
 
 	cpu.Registers.P |= I
 
+	if cpu.variant == WDC65C02 {
+		cpu.Registers.P &^= D
+	}
+
 	low := cpu.Memory.Fetch(0xfffe)
 	high := cpu.Memory.Fetch(0xffff)
 
 	cpu.Registers.PC = (uint16(high) << 8) | uint16(low)
+
+	if cpu.profiler != nil {
+		cpu.profiler.interrupt(Irq, pc, cpu)
+	}
+
+	if len(cpu.hooks.interrupt) != 0 {
+		cpu.interruptHooks(Irq)
+	}
 }
 
 func (cpu *M6502) PerformNmi() {
+	pc := cpu.Registers.PC
+
 	cpu.push16(cpu.Registers.PC)
 	cpu.push(uint8((cpu.Registers.P | U) & ^B))
 
 	cpu.Registers.P |= I
 
+	if cpu.variant == WDC65C02 {
+		cpu.Registers.P &^= D
+	}
+
 	low := cpu.Memory.Fetch(0xfffa)
 	high := cpu.Memory.Fetch(0xfffb)
 
 	cpu.Registers.PC = (uint16(high) << 8) | uint16(low)
+
+	if cpu.profiler != nil {
+		cpu.profiler.interrupt(Nmi, pc, cpu)
+	}
+
+	if len(cpu.hooks.interrupt) != 0 {
+		cpu.interruptHooks(Nmi)
+	}
 }
 
 func (cpu *M6502) PerformRst() {
+	pc := cpu.Registers.PC
+
+	cpu.waiting = false
+	cpu.stopped = false
+
 	low := cpu.Memory.Fetch(0xfffc)
 	high := cpu.Memory.Fetch(0xfffd)
 
 	cpu.Registers.PC = (uint16(high) << 8) | uint16(low)
+
+	if cpu.profiler != nil {
+		cpu.profiler.interrupt(Rst, pc, cpu)
+	}
+
+	if len(cpu.hooks.interrupt) != 0 {
+		cpu.interruptHooks(Rst)
+	}
 }
 
 func (cpu *M6502) DisableDecimalMode() {
@@ -223,12 +310,29 @@ func (cpu *M6502) ToggleDecode() bool {
 	return cpu.decode.enabled
 }
 
+// Sets the function that traces decoded instructions, whether or not
+// decode is enabled.  Each instruction whose address active returns
+// true for is passed to trace along with its address and the value of
+// Cycles at the start of the instruction, and instructions are only
+// decoded while decode is enabled or they are traced.  A nil active
+// traces every instruction and a nil trace stops tracing.
+func (cpu *M6502) SetTrace(active func(pc uint16) bool, trace func(pc uint16, line string, ticks uint64)) {
+	cpu.decode.active = active
+	cpu.decode.trace = trace
+}
+
+// Attributes the cycles of every instruction executed from now on
+// to the routines in profiler.  A nil profiler disables profiling.
+func (cpu *M6502) SetProfiler(profiler *Profiler) {
+	cpu.profiler = profiler
+}
+
 // Error type used to indicate that the CPU attempted to execute an
 // invalid opcode
 type BadOpCodeError OpCode
 
 func (b BadOpCodeError) Error() string {
-	return fmt.Sprintf("No such opcode %#02x", b)
+	return fmt.Sprintf("No such opcode %#02x", uint8(b))
 }
 
 // Error type used to indicate that the CPU executed a BRK instruction
@@ -243,9 +347,19 @@ func (b BrkOpCodeError) Error() string {
 // Returns the number of cycles executed and any error (such as
 // BadOpCodeError).
 func (cpu *M6502) Execute() (cycles uint16, error error) {
+	// WAI and STP
+	if (cpu.waiting || cpu.stopped) && !cpu.resume() {
+		cpu.Cycles++
+		return 1, nil
+	}
+
 	// check interrupts
 	cycles += cpu.PerformInterrupts()
 
+	if len(cpu.hooks.execute) != 0 {
+		cpu.executeHooks(cpu.Registers.PC)
+	}
+
 	// fetch
 	opcode := OpCode(cpu.Memory.Fetch(cpu.Registers.PC))
 	inst := cpu.Instructions.opcodes[opcode]
@@ -254,21 +368,42 @@ func (cpu *M6502) Execute() (cycles uint16, error error) {
 		return 0, BadOpCodeError(opcode)
 	}
 
+	tracing := cpu.decode.trace != nil &&
+		(cpu.decode.active == nil || cpu.decode.active(cpu.Registers.PC))
+
+	cpu.decode.decoding = cpu.decode.enabled || tracing
+
 	// execute
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.pc = cpu.Registers.PC
 		cpu.decode.opcode = opcode
 		cpu.decode.args = ""
 		cpu.decode.mneumonic = inst.Mneumonic
 		cpu.decode.decodedArgs = ""
 		cpu.decode.registers = cpu.Registers.String()
+		cpu.decode.ticks = cpu.Cycles + uint64(cycles)
 	}
 
+	pc := cpu.Registers.PC
+
 	cpu.Registers.PC++
 	cycles += cpu.Instructions.Execute(cpu, opcode)
+	cpu.Cycles += uint64(cycles)
 
-	if cpu.decode.enabled {
-		fmt.Println(cpu.decode.String())
+	if cpu.profiler != nil {
+		cpu.profiler.execute(pc, opcode, cycles, cpu)
+	}
+
+	if cpu.decode.decoding {
+		line := cpu.decode.String()
+
+		if cpu.decode.enabled {
+			fmt.Println(line)
+		}
+
+		if tracing {
+			cpu.decode.trace(cpu.decode.pc, line, cpu.decode.ticks)
+		}
 	}
 
 	if cpu.breakError && opcode == 0x00 {
@@ -480,7 +615,7 @@ func (cpu *M6502) immediateAddress() (result uint16) {
 	result = cpu.Registers.PC
 	cpu.Registers.PC++
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		value := cpu.Memory.Fetch(result)
 		cpu.decode.args = fmt.Sprintf("%02X", value)
 		cpu.decode.decodedArgs = fmt.Sprintf("#$")
@@ -493,7 +628,7 @@ func (cpu *M6502) zeroPageAddress() (result uint16) {
 	result = uint16(cpu.Memory.Fetch(cpu.Registers.PC))
 	cpu.Registers.PC++
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.args = fmt.Sprintf("%02X", result)
 		cpu.decode.decodedArgs = fmt.Sprintf("$%02X", result)
 	}
@@ -519,7 +654,7 @@ func (cpu *M6502) zeroPageIndexedAddress(index Index) (result uint16) {
 	result = uint16(value + cpu.IndexToRegister(index))
 	cpu.Registers.PC++
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.args = fmt.Sprintf("%02X", value)
 		cpu.decode.decodedArgs = fmt.Sprintf("$%02X,%s @ %02X",
 			value, index.String(), result)
@@ -542,7 +677,7 @@ func (cpu *M6502) relativeAddress() (result uint16) {
 
 	result = cpu.Registers.PC + offset
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.args = fmt.Sprintf("%02X", value)
 		cpu.decode.decodedArgs = fmt.Sprintf("$%04X", result)
 	}
@@ -557,7 +692,7 @@ func (cpu *M6502) absoluteAddress() (result uint16) {
 
 	result = (uint16(high) << 8) | uint16(low)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.args = fmt.Sprintf("%02X %02X", low, high)
 		cpu.decode.decodedArgs = fmt.Sprintf("$%04X = ", result)
 	}
@@ -570,7 +705,7 @@ func (cpu *M6502) indirectAddress() (result uint16) {
 	high := cpu.Memory.Fetch(cpu.Registers.PC + 1)
 	cpu.Registers.PC += 2
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.args = fmt.Sprintf("%02X %02X", low, high)
 	}
 
@@ -584,13 +719,18 @@ func (cpu *M6502) indirectAddress() (result uint16) {
 	aHigh := (uint16(high) << 8) | uint16(low+1)
 	aLow := (uint16(high) << 8) | uint16(low)
 
+	// which the 65C02 fixed
+	if cpu.variant == WDC65C02 {
+		aHigh = aLow + 1
+	}
+
 	low = cpu.Memory.Fetch(aLow)
 	high = cpu.Memory.Fetch(aHigh)
 
 	result = (uint16(high) << 8) | uint16(low)
 	badResult := (uint16(cpu.Memory.Fetch(aLow+1)) << 8) | uint16(low)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.decodedArgs = fmt.Sprintf("($%04X) = %04X", aLow, badResult)
 	}
 
@@ -609,7 +749,7 @@ func (cpu *M6502) absoluteIndexedAddress(index Index, status *InstructionStatus)
 		*status |= PageCross
 	}
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.args = fmt.Sprintf("%02X %02X", low, high)
 		cpu.decode.decodedArgs = fmt.Sprintf("$%04X,%s @ %04X = ", address, index.String(), result)
 	}
@@ -627,7 +767,7 @@ func (cpu *M6502) indexedIndirectAddress() (result uint16) {
 
 	result = (uint16(high) << 8) | uint16(low)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.args = fmt.Sprintf("%02X", value)
 		cpu.decode.decodedArgs = fmt.Sprintf("($%02X,X) @ %02X = %04X = ", value, address, result)
 	}
@@ -651,7 +791,7 @@ func (cpu *M6502) indirectIndexedAddress(status *InstructionStatus) (result uint
 		*status |= PageCross
 	}
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.args = fmt.Sprintf("%02X", value)
 		cpu.decode.decodedArgs = fmt.Sprintf("($%02X),Y = %04X @ %04X = ", value, address, result)
 	}
@@ -663,7 +803,7 @@ func (cpu *M6502) load(address uint16, register *uint8) {
 	value := cpu.setZNFlags(cpu.Memory.Fetch(address))
 	*register = value
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -735,7 +875,7 @@ func (cpu *M6502) Ldy(address uint16) {
 func (cpu *M6502) store(address uint16, value uint8) {
 	oldValue := cpu.Memory.Store(address, value)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
 		}
@@ -969,7 +1109,7 @@ func (cpu *M6502) Plp() {
 func (cpu *M6502) And(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -994,7 +1134,7 @@ func (cpu *M6502) And(address uint16) {
 func (cpu *M6502) Eor(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1019,7 +1159,7 @@ func (cpu *M6502) Eor(address uint16) {
 func (cpu *M6502) Ora(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1047,7 +1187,7 @@ func (cpu *M6502) Ora(address uint16) {
 func (cpu *M6502) Bit(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1062,26 +1202,87 @@ func (cpu *M6502) Bit(address uint16) {
 
 func (cpu *M6502) addition(value uint16) {
 	orig := uint16(cpu.Registers.A)
+	result := cpu.setCFlagAddition(orig + value + uint16(cpu.Registers.P&C))
+	cpu.Registers.A = cpu.setZNFlags(uint8(cpu.setVFlagAddition(orig, value, result)))
+}
 
-	if !cpu.decimalMode || cpu.Registers.P&D == 0 {
-		result := cpu.setCFlagAddition(orig + value + uint16(cpu.Registers.P&C))
-		cpu.Registers.A = cpu.setZNFlags(uint8(cpu.setVFlagAddition(orig, value, result)))
-	} else {
-		low := uint16(orig&0x000f) + uint16(value&0x000f) + uint16(cpu.Registers.P&C)
-		high := uint16(orig&0x00f0) + uint16(value&0x00f0)
+// Adds value to the accumulator in BCD.  See
+// http://www.6502.org/tutorials/decimal_mode.html for how each
+// variant sets the flags.
+func (cpu *M6502) decimalAddition(value uint16) {
+	orig := uint16(cpu.Registers.A)
+	carry := uint16(cpu.Registers.P & C)
+
+	low := (orig & 0x000f) + (value & 0x000f) + carry
+
+	if low >= 0x000a {
+		low = ((low + 0x0006) & 0x000f) + 0x0010
+	}
+
+	result := (orig & 0x00f0) + (value & 0x00f0) + low
+
+	// N and V are set before the high digit is adjusted
+	cpu.setVFlagAddition(orig, value, result)
+	cpu.setNFlag(uint8(result))
+
+	if result >= 0x00a0 {
+		result += 0x0060
+	}
+
+	cpu.setCFlagAddition(result)
+	cpu.Registers.A = uint8(result)
 
-		if low >= 0x000a {
-			low -= 0x000a
-			high += 0x0010
+	switch cpu.variant {
+	case WDC65C02:
+		cpu.setZNFlags(cpu.Registers.A)
+	default:
+		cpu.setZFlag(uint8(orig + value + carry))
+	}
+}
+
+// Subtracts value from the accumulator in BCD.  See
+// http://www.6502.org/tutorials/decimal_mode.html for how each
+// variant sets the flags.
+func (cpu *M6502) decimalSubtraction(value uint16) {
+	orig := int(cpu.Registers.A)
+	borrow := 1 - int(cpu.Registers.P&C)
+
+	// the flags are set as if by a binary subtraction, except for N
+	// and Z on the 65C02
+	binary := cpu.setCFlagAddition(uint16(orig) + (value ^ 0x00ff) + uint16(cpu.Registers.P&C))
+	cpu.setVFlagAddition(uint16(orig), value^0x00ff, binary)
+
+	var result int
+	low := (orig & 0x0f) - int(value&0x000f) - borrow
+
+	switch cpu.variant {
+	case WDC65C02:
+		result = orig - int(value) - borrow
+
+		if result < 0 {
+			result -= 0x60
+		}
+
+		if low < 0 {
+			result -= 0x06
 		}
 
-		if high >= 0x00a0 {
-			high -= 0x00a0
+		cpu.setZNFlags(uint8(result))
+	default:
+		if low < 0 {
+			low = ((low - 0x06) & 0x0f) - 0x10
 		}
 
-		result := cpu.setCFlagAddition(high | (low & 0x000f))
-		cpu.Registers.A = cpu.setZNFlags(uint8(cpu.setVFlagAddition(orig, value, result)))
+		result = (orig & 0xf0) - int(value&0x00f0) + low
+
+		if result < 0 {
+			result -= 0x60
+		}
+
+		cpu.setZNFlags(uint8(binary))
 	}
+
+	cpu.Registers.A = uint8(result)
 }
 
 // This instruction adds the contents of a memory location to the
@@ -1099,7 +1300,7 @@ func (cpu *M6502) addition(value uint16) {
 func (cpu *M6502) Adc(address uint16) {
 	value := uint16(cpu.Memory.Fetch(address))
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1108,7 +1309,11 @@ func (cpu *M6502) Adc(address uint16) {
 		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
 	}
 
-	cpu.addition(value)
+	if cpu.decimalMode && cpu.Registers.P&D != 0 {
+		cpu.decimalAddition(value)
+	} else {
+		cpu.addition(value)
+	}
 }
 
 // This instruction subtracts the contents of a memory location to the
@@ -1126,7 +1331,7 @@ func (cpu *M6502) Adc(address uint16) {
 func (cpu *M6502) Sbc(address uint16) {
 	value := uint16(cpu.Memory.Fetch(address))
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1135,17 +1340,15 @@ func (cpu *M6502) Sbc(address uint16) {
 		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
 	}
 
-	if !cpu.decimalMode || cpu.Registers.P&D == 0 {
-		value ^= 0xff
+	if cpu.decimalMode && cpu.Registers.P&D != 0 {
+		cpu.decimalSubtraction(value)
 	} else {
-		value = 0x99 - value
+		cpu.addition(value ^ 0xff)
 	}
-
-	cpu.addition(value)
 }
 
 func (cpu *M6502) compare(value uint16, register uint8) {
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1162,7 +1365,7 @@ func (cpu *M6502) compare(value uint16, register uint8) {
 func (cpu *M6502) Dcp(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1171,18 +1374,18 @@ func (cpu *M6502) Dcp(address uint16) {
 		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
 	}
 
-	enabled := cpu.decode.enabled
-	cpu.decode.enabled = false
+	decoding := cpu.decode.decoding
+	cpu.decode.decoding = false
 	cpu.Dec(address)
 	cpu.Cmp(address)
-	cpu.decode.enabled = enabled
+	cpu.decode.decoding = decoding
 }
 
 // Unofficial
 func (cpu *M6502) Isb(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1191,18 +1394,18 @@ func (cpu *M6502) Isb(address uint16) {
 		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
 	}
 
-	enabled := cpu.decode.enabled
-	cpu.decode.enabled = false
+	decoding := cpu.decode.decoding
+	cpu.decode.decoding = false
 	cpu.Inc(address)
 	cpu.Sbc(address)
-	cpu.decode.enabled = enabled
+	cpu.decode.decoding = decoding
 }
 
 // Unofficial
 func (cpu *M6502) Slo(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1211,18 +1414,18 @@ func (cpu *M6502) Slo(address uint16) {
 		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
 	}
 
-	enabled := cpu.decode.enabled
-	cpu.decode.enabled = false
+	decoding := cpu.decode.decoding
+	cpu.decode.decoding = false
 	cpu.Asl(address)
 	cpu.Ora(address)
-	cpu.decode.enabled = enabled
+	cpu.decode.decoding = decoding
 }
 
 // Unofficial
 func (cpu *M6502) Rla(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1231,18 +1434,18 @@ func (cpu *M6502) Rla(address uint16) {
 		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
 	}
 
-	enabled := cpu.decode.enabled
-	cpu.decode.enabled = false
+	decoding := cpu.decode.decoding
+	cpu.decode.decoding = false
 	cpu.Rol(address)
 	cpu.And(address)
-	cpu.decode.enabled = enabled
+	cpu.decode.decoding = decoding
 }
 
 // Unofficial
 func (cpu *M6502) Sre(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1251,18 +1454,18 @@ func (cpu *M6502) Sre(address uint16) {
 		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
 	}
 
-	enabled := cpu.decode.enabled
-	cpu.decode.enabled = false
+	decoding := cpu.decode.decoding
+	cpu.decode.decoding = false
 	cpu.Lsr(address)
 	cpu.Eor(address)
-	cpu.decode.enabled = enabled
+	cpu.decode.decoding = decoding
 }
 
 // Unofficial
 func (cpu *M6502) Rra(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1271,11 +1474,11 @@ func (cpu *M6502) Rra(address uint16) {
 		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
 	}
 
-	enabled := cpu.decode.enabled
-	cpu.decode.enabled = false
+	decoding := cpu.decode.decoding
+	cpu.decode.decoding = false
 	cpu.Ror(address)
 	cpu.Adc(address)
-	cpu.decode.enabled = enabled
+	cpu.decode.decoding = decoding
 }
 
 // This instruction compares the contents of the accumulator with
@@ -1339,7 +1542,7 @@ func (cpu *M6502) Cpy(address uint16) {
 func (cpu *M6502) Inc(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1396,7 +1599,7 @@ func (cpu *M6502) Iny() {
 func (cpu *M6502) Dec(address uint16) {
 	value := cpu.Memory.Fetch(address)
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1448,7 +1651,7 @@ const (
 )
 
 func (cpu *M6502) shift(direction direction, value uint8, store func(uint8)) {
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1490,7 +1693,7 @@ func (cpu *M6502) shift(direction direction, value uint8, store func(uint8)) {
 func (cpu *M6502) AslA() {
 	cpu.shift(left, cpu.Registers.A, func(value uint8) { cpu.Registers.A = value })
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.decodedArgs = fmt.Sprintf("A")
 	}
 }
@@ -1525,7 +1728,7 @@ func (cpu *M6502) Asl(address uint16) {
 func (cpu *M6502) LsrA() {
 	cpu.shift(right, cpu.Registers.A, func(value uint8) { cpu.Registers.A = value })
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.decodedArgs = fmt.Sprintf("A")
 	}
 }
@@ -1545,7 +1748,7 @@ func (cpu *M6502) Lsr(address uint16) {
 }
 
 func (cpu *M6502) rotate(direction direction, value uint8, store func(uint8)) {
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
 			!strings.HasSuffix(cpu.decode.decodedArgs, " = ") {
 			cpu.decode.decodedArgs += fmt.Sprintf(" = ")
@@ -1585,7 +1788,7 @@ func (cpu *M6502) rotate(direction direction, value uint8, store func(uint8)) {
 func (cpu *M6502) RolA() {
 	cpu.rotate(left, cpu.Registers.A, func(value uint8) { cpu.Registers.A = value })
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.decodedArgs = fmt.Sprintf("A")
 	}
 }
@@ -1619,7 +1822,7 @@ func (cpu *M6502) Rol(address uint16) {
 func (cpu *M6502) RorA() {
 	cpu.rotate(right, cpu.Registers.A, func(value uint8) { cpu.Registers.A = value })
 
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.decodedArgs = fmt.Sprintf("A")
 	}
 }
@@ -1649,7 +1852,7 @@ func (cpu *M6502) Ror(address uint16) {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Not affected
 func (cpu *M6502) Jmp(address uint16) {
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		if strings.HasPrefix(cpu.decode.decodedArgs, "$") {
 			// delete ' = '
 			cpu.decode.decodedArgs = cpu.decode.decodedArgs[:len(cpu.decode.decodedArgs)-3]
@@ -1671,7 +1874,7 @@ func (cpu *M6502) Jmp(address uint16) {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Not affected
 func (cpu *M6502) Jsr(address uint16) {
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		cpu.decode.decodedArgs = fmt.Sprintf("$%04X", address)
 	}
 
@@ -1934,6 +2137,10 @@ func (cpu *M6502) Brk() {
 
 	cpu.Registers.P |= I
 
+	if cpu.variant == WDC65C02 {
+		cpu.Registers.P &^= D
+	}
+
 	low := cpu.Memory.Fetch(0xfffe)
 	high := cpu.Memory.Fetch(0xffff)
 
@@ -1968,7 +2175,7 @@ func (cpu *M6502) Nop() {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Not affected
 func (cpu *M6502) NopAddress(address uint16) {
-	if cpu.decode.enabled {
+	if cpu.decode.decoding {
 		value := cpu.Memory.Fetch(address)
 
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
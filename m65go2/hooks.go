@@ -0,0 +1,101 @@
+package m65go2
+
+// Identifies a registered hook so that it can later be removed.
+// Hooks are called synchronously from the goroutine running the CPU,
+// so they should be registered and removed before it starts running,
+// while it is paused or between instructions on that goroutine.
+type Hook uint32
+
+type executeHook struct {
+	id   Hook
+	hook func(pc uint16)
+}
+
+type interruptHook struct {
+	id   Hook
+	hook func(which Interrupt)
+}
+
+type interruptLineHook struct {
+	id   Hook
+	hook func(which Interrupt, state bool)
+}
+
+type hooks struct {
+	next          Hook
+	execute       []executeHook
+	interrupt     []interruptHook
+	interruptLine []interruptLineHook
+}
+
+// Registers a hook that is called with the address of each
+// instruction just before its opcode is fetched.
+func (cpu *M6502) OnExecute(hook func(pc uint16)) Hook {
+	cpu.hooks.next++
+	cpu.hooks.execute = append(cpu.hooks.execute, executeHook{cpu.hooks.next, hook})
+
+	return cpu.hooks.next
+}
+
+// Registers a hook that is called with the kind of each interrupt the
+// CPU performs, once the PC has been loaded from the interrupt's
+// vector.
+func (cpu *M6502) OnInterrupt(hook func(which Interrupt)) Hook {
+	cpu.hooks.next++
+	cpu.hooks.interrupt = append(cpu.hooks.interrupt, interruptHook{cpu.hooks.next, hook})
+
+	return cpu.hooks.next
+}
+
+// Registers a hook that is called with the kind and new state of an
+// interrupt line each time it is set to a different state, before
+// the CPU sees the change.
+func (cpu *M6502) OnInterruptLine(hook func(which Interrupt, state bool)) Hook {
+	cpu.hooks.next++
+	cpu.hooks.interruptLine = append(cpu.hooks.interruptLine, interruptLineHook{cpu.hooks.next, hook})
+
+	return cpu.hooks.next
+}
+
+// Removes a hook registered with OnExecute, OnInterrupt or
+// OnInterruptLine.
+func (cpu *M6502) RemoveHook(id Hook) {
+	for i, h := range cpu.hooks.execute {
+		if h.id == id {
+			cpu.hooks.execute = append(cpu.hooks.execute[:i:i], cpu.hooks.execute[i+1:]...)
+			return
+		}
+	}
+
+	for i, h := range cpu.hooks.interrupt {
+		if h.id == id {
+			cpu.hooks.interrupt = append(cpu.hooks.interrupt[:i:i], cpu.hooks.interrupt[i+1:]...)
+			return
+		}
+	}
+
+	for i, h := range cpu.hooks.interruptLine {
+		if h.id == id {
+			cpu.hooks.interruptLine = append(cpu.hooks.interruptLine[:i:i], cpu.hooks.interruptLine[i+1:]...)
+			return
+		}
+	}
+}
+
+func (cpu *M6502) executeHooks(pc uint16) {
+	for _, h := range cpu.hooks.execute {
+		h.hook(pc)
+	}
+}
+
+func (cpu *M6502) interruptHooks(which Interrupt) {
+	for _, h := range cpu.hooks.interrupt {
+		h.hook(which)
+	}
+}
+
+func (cpu *M6502) interruptLineHooks(which Interrupt, state bool) {
+	for _, h := range cpu.hooks.interruptLine {
+		h.hook(which, state)
+	}
+}
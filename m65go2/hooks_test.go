@@ -0,0 +1,95 @@
+package m65go2
+
+import "testing"
+
+func TestHooks(t *testing.T) {
+	Setup()
+
+	executed := []uint16{}
+	interrupts := []Interrupt{}
+
+	execute := cpu.OnExecute(func(pc uint16) {
+		executed = append(executed, pc)
+	})
+
+	cpu.OnInterrupt(func(which Interrupt) {
+		interrupts = append(interrupts, which)
+	})
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xea)
+	cpu.Memory.Store(0x0101, 0xea)
+	cpu.Memory.Store(0xfffa, 0x00)
+	cpu.Memory.Store(0xfffb, 0x02)
+	cpu.Memory.Store(0x0200, 0xea)
+
+	cpu.Execute()
+	cpu.Nmi = true
+	cpu.Execute()
+
+	if len(executed) != 2 || executed[0] != 0x0100 || executed[1] != 0x0200 {
+		t.Errorf("Execute hook received %v, expected [0x0100 0x0200]", executed)
+	}
+
+	if len(interrupts) != 1 || interrupts[0] != Nmi {
+		t.Errorf("Interrupt hook received %v, expected [Nmi]", interrupts)
+	}
+
+	lines := []bool{}
+
+	cpu.OnInterruptLine(func(which Interrupt, state bool) {
+		if which == Irq {
+			lines = append(lines, state)
+		}
+	})
+
+	cpu.Interrupt(Irq, true)
+	cpu.Interrupt(Irq, true)
+	cpu.Interrupt(Irq, false)
+
+	if len(lines) != 2 || !lines[0] || lines[1] {
+		t.Errorf("Interrupt line hook received %v, expected [true false]", lines)
+	}
+
+	cpu.RemoveHook(execute)
+	cpu.Execute()
+
+	if len(executed) != 2 {
+		t.Error("Execute hook called after being removed")
+	}
+
+	Teardown()
+}
+
+func benchmarkExecute(b *testing.B, hooked bool) {
+	Setup()
+
+	if hooked {
+		cpu.OnExecute(func(pc uint16) {})
+	}
+
+	for i := uint16(0x0000); i < 0x1000; i++ {
+		cpu.Memory.Store(i, 0xea)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if cpu.Registers.PC >= 0x0fff {
+			cpu.Registers.PC = 0x0000
+		}
+
+		cpu.Execute()
+	}
+
+	Teardown()
+}
+
+func BenchmarkExecute(b *testing.B) {
+	benchmarkExecute(b, false)
+}
+
+func BenchmarkExecuteHooked(b *testing.B) {
+	benchmarkExecute(b, true)
+}
@@ -15,6 +15,7 @@ type Instruction struct {
 // Stores instructions understood by the 6502 CPU, indexed by opcode.
 type InstructionTable struct {
 	opcodes         []*Instruction
+	sizes           []uint16
 	cycles          []uint16
 	cyclesPageCross []uint16
 }
@@ -24,12 +25,31 @@ type InstructionStatus uint16
 const (
 	PageCross InstructionStatus = 1 << iota
 	Branched
+	DecimalPenalty
 )
 
 // Returns a new, empty InstructionTable
 func NewInstructionTable() InstructionTable {
 	instructions := InstructionTable{
 		opcodes: make([]*Instruction, 0x100),
+		sizes: []uint16{
+			1, 2, 1, 2, 2, 2, 2, 2, 1, 2, 1, 2, 3, 3, 3, 3,
+			2, 2, 1, 2, 2, 2, 2, 2, 1, 3, 1, 3, 3, 3, 3, 3,
+			3, 2, 1, 2, 2, 2, 2, 2, 1, 2, 1, 2, 3, 3, 3, 3,
+			2, 2, 1, 2, 2, 2, 2, 2, 1, 3, 1, 3, 3, 3, 3, 3,
+			1, 2, 1, 2, 2, 2, 2, 2, 1, 2, 1, 2, 3, 3, 3, 3,
+			2, 2, 1, 2, 2, 2, 2, 2, 1, 3, 1, 3, 3, 3, 3, 3,
+			1, 2, 1, 2, 2, 2, 2, 2, 1, 2, 1, 2, 3, 3, 3, 3,
+			2, 2, 1, 2, 2, 2, 2, 2, 1, 3, 1, 3, 3, 3, 3, 3,
+			2, 2, 2, 2, 2, 2, 2, 2, 1, 2, 1, 2, 3, 3, 3, 3,
+			2, 2, 1, 2, 2, 2, 2, 2, 1, 3, 1, 3, 3, 3, 3, 3,
+			2, 2, 2, 2, 2, 2, 2, 2, 1, 2, 1, 2, 3, 3, 3, 3,
+			2, 2, 1, 2, 2, 2, 2, 2, 1, 3, 1, 3, 3, 3, 3, 3,
+			2, 2, 2, 2, 2, 2, 2, 2, 1, 2, 1, 2, 3, 3, 3, 3,
+			2, 2, 1, 2, 2, 2, 2, 2, 1, 3, 1, 3, 3, 3, 3, 3,
+			2, 2, 2, 2, 2, 2, 2, 2, 1, 2, 1, 2, 3, 3, 3, 3,
+			2, 2, 1, 2, 2, 2, 2, 2, 1, 3, 1, 3, 3, 3, 3, 3,
+		},
 		cycles: []uint16{
 			7, 6, 0, 8, 3, 3, 5, 5, 3, 2, 2, 2, 4, 4, 6, 6,
 			2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
@@ -71,6 +91,18 @@ func NewInstructionTable() InstructionTable {
 	return instructions
 }
 
+// Returns the size in bytes of the instruction with the given opcode,
+// including its operands
+func (instructions InstructionTable) Size(opcode OpCode) uint16 {
+	return instructions.sizes[opcode]
+}
+
+// Returns the number of cycles the instruction with the given opcode
+// takes without the penalties for crossing a page or branching
+func (instructions InstructionTable) Cycles(opcode OpCode) uint16 {
+	return instructions.cycles[opcode]
+}
+
 // Executes an instruction in the InstructionTable, returns number of
 // cycles taken to execute
 func (instructions InstructionTable) Execute(cpu *M6502, opcode OpCode) (cycles uint16) {
@@ -92,6 +124,10 @@ func (instructions InstructionTable) Execute(cpu *M6502, opcode OpCode) (cycles
 		cycles++
 	}
 
+	if status&DecimalPenalty != 0 {
+		cycles++
+	}
+
 	return
 }
 
@@ -5682,3 +5682,43 @@ func TestRst(t *testing.T) {
 
 	Teardown()
 }
+
+// Trace
+
+func TestTrace(t *testing.T) {
+	Setup()
+
+	traced := []uint16{}
+
+	cpu.SetTrace(func(pc uint16) bool {
+		return pc != 0x0101
+	}, func(pc uint16, line string, ticks uint64) {
+		traced = append(traced, pc)
+	})
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xea)
+	cpu.Memory.Store(0x0101, 0xea)
+	cpu.Memory.Store(0x0102, 0xea)
+
+	cpu.Execute()
+	cpu.Execute()
+
+	// instructions that aren't traced aren't decoded
+	if cpu.decode.pc != 0x0100 {
+		t.Errorf("Decoded %04X last, expected 0100", cpu.decode.pc)
+	}
+
+	// and toggling decode doesn't change what is traced
+	cpu.ToggleDecode()
+	cpu.ToggleDecode()
+
+	cpu.Execute()
+
+	if len(traced) != 2 || traced[0] != 0x0100 || traced[1] != 0x0102 {
+		t.Errorf("Trace received %v, expected [0x0100 0x0102]", traced)
+	}
+
+	Teardown()
+}
@@ -1 +1,154 @@
-package m65go2
+package m65go2_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nwidger/nintengo/m65go2"
+	"github.com/nwidger/nintengo/rp2ago3"
+)
+
+// Maps nestest's single 16KB PRG bank at both $8000 and $c000.
+type nestestROM struct {
+	prg []uint8
+}
+
+func (rom *nestestROM) Reset() {
+
+}
+
+func (rom *nestestROM) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
+	switch which {
+	case rp2ago3.CPU:
+		for i := uint32(0x8000); i <= 0xffff; i++ {
+			fetch = append(fetch, uint16(i))
+		}
+	}
+
+	return
+}
+
+func (rom *nestestROM) Fetch(address uint16) (value uint8) {
+	return rom.prg[address&0x3fff]
+}
+
+func (rom *nestestROM) Store(address uint16, value uint8) (oldValue uint8) {
+	return
+}
+
+// Nintendulator shows the write-only APU and I/O registers at
+// $4000-$4017 as open bus, which nestest doesn't depend on.
+var ioRegister = regexp.MustCompile(`(\$40(0[0-9A-F]|1[0-7])) = [0-9A-F]{2}`)
+
+func normalize(line string) string {
+	return ioRegister.ReplaceAllString(line, "$1 = --")
+}
+
+func sideBySide(expected, actual []string) string {
+	lines := []string{}
+
+	for i := range expected {
+		marker := " "
+
+		if expected[i] != actual[i] {
+			marker = "|"
+		}
+
+		lines = append(lines, fmt.Sprintf("%-81s %s %s", expected[i], marker, actual[i]))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestNestest(t *testing.T) {
+	buf, err := ioutil.ReadFile("test-roms/nestest/nestest.nes")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buf) < 16+0x4000 || string(buf[0:3]) != "NES" {
+		t.Fatal("nestest.nes is not a valid iNES ROM")
+	}
+
+	log, err := os.Open("test-roms/nestest/nestest.log")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer log.Close()
+
+	cpu := rp2ago3.NewRP2A03(rp2ago3.NTSC_CPU_FREQUENCY, 44100)
+	cpu.Memory.AddMappings(&nestestROM{prg: buf[16 : 16+0x4000]}, rp2ago3.CPU)
+	cpu.Reset()
+
+	// nestest.log was generated with internal RAM cleared to zero
+	for i := uint16(0x0000); i <= 0x07ff; i++ {
+		cpu.Memory.Store(i, 0x00)
+	}
+
+	// automation mode
+	cpu.M6502.Registers.PC = 0xc000
+	cpu.M6502.Registers.P = m65go2.I | m65go2.U
+	cpu.M6502.Registers.SP = 0xfd
+
+	// nestest.log starts 241 scanlines into the frame
+	start := uint64(241) * 341
+	line := ""
+
+	cpu.SetTrace(nil, func(pc uint16, decoded string, ticks uint64) {
+		dot := start + (ticks * 3)
+		scanline := int((dot / 341) % 262)
+
+		if scanline == 261 {
+			scanline = -1
+		}
+
+		line = fmt.Sprintf("%s CYC:%3d SL:%d", decoded, dot%341, scanline)
+	})
+
+	expected := []string{}
+	actual := []string{}
+
+	scanner := bufio.NewScanner(log)
+
+	for n := 1; scanner.Scan(); n++ {
+		want := strings.TrimRight(scanner.Text(), "\r")
+
+		if _, err = cpu.Execute(); err != nil {
+			t.Fatalf("nestest.log line %d: %v", n, err)
+		}
+
+		expected = append(expected, want)
+		actual = append(actual, line)
+
+		if len(expected) > 8 {
+			expected = expected[1:]
+			actual = actual[1:]
+		}
+
+		if normalize(line) != normalize(want) {
+			t.Fatalf("nestest.log diverges at line %d (expected | actual):\n%s",
+				n, sideBySide(expected, actual))
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// official and unofficial opcode results
+	if result := cpu.Memory.Fetch(0x0002); result != 0x00 {
+		t.Errorf("Official opcode test failed with result %02X", result)
+	}
+
+	if result := cpu.Memory.Fetch(0x0003); result != 0x00 {
+		t.Errorf("Unofficial opcode test failed with result %02X", result)
+	}
+}
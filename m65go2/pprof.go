@@ -0,0 +1,146 @@
+package m65go2
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// Builds a profile in the protocol buffer format read by 'go tool
+// pprof' (see github.com/google/pprof/proto/profile.proto), encoding
+// only the fields a profile of 6502 routines needs.
+type pprof struct {
+	strings   []string
+	stringIDs map[string]int64
+	locations map[*Routine]uint64
+	order     []*Routine
+	samples   [][]byte
+}
+
+func newPprof() *pprof {
+	p := &pprof{
+		strings:   []string{},
+		stringIDs: map[string]int64{},
+		locations: map[*Routine]uint64{},
+		order:     []*Routine{},
+		samples:   [][]byte{},
+	}
+
+	p.string("")
+
+	return p
+}
+
+func (p *pprof) string(s string) int64 {
+	id, ok := p.stringIDs[s]
+
+	if !ok {
+		id = int64(len(p.strings))
+		p.strings = append(p.strings, s)
+		p.stringIDs[s] = id
+	}
+
+	return id
+}
+
+// Returns the location ID of routine, which is also the ID of the
+// function it contains.
+func (p *pprof) location(routine *Routine) uint64 {
+	id, ok := p.locations[routine]
+
+	if !ok {
+		id = uint64(len(p.order) + 1)
+		p.locations[routine] = id
+		p.order = append(p.order, routine)
+	}
+
+	return id
+}
+
+// Adds a sample for the given stack of location IDs, leaf first.
+func (p *pprof) sample(stack []uint64, cycles uint64) {
+	ids := []byte{}
+
+	for _, id := range stack {
+		ids = appendVarint(ids, id)
+	}
+
+	sample := appendBytes([]byte{}, 1, ids)
+	sample = appendBytes(sample, 2, appendVarint([]byte{}, cycles))
+
+	p.samples = append(p.samples, sample)
+}
+
+func (p *pprof) valueType(typ, unit string) []byte {
+	buf := appendField([]byte{}, 1, uint64(p.string(typ)))
+	return appendField(buf, 2, uint64(p.string(unit)))
+}
+
+func (p *pprof) write(w io.Writer) (err error) {
+	buf := []byte{}
+
+	// sample_type
+	buf = appendBytes(buf, 1, p.valueType("cycles", "count"))
+
+	// sample
+	for _, sample := range p.samples {
+		buf = appendBytes(buf, 2, sample)
+	}
+
+	for _, routine := range p.order {
+		id := p.locations[routine]
+
+		// location
+		line := appendField([]byte{}, 1, id)
+		location := appendField([]byte{}, 1, id)
+		location = appendField(location, 3, uint64(routine.Address))
+		location = appendBytes(location, 4, line)
+		buf = appendBytes(buf, 4, location)
+
+		// function
+		function := appendField([]byte{}, 1, id)
+		function = appendField(function, 2, uint64(p.string(routine.Name)))
+		function = appendField(function, 3, uint64(p.string(routine.Name)))
+		buf = appendBytes(buf, 5, function)
+	}
+
+	// string_table
+	for _, s := range p.strings {
+		buf = appendBytes(buf, 6, []byte(s))
+	}
+
+	// period_type and period
+	buf = appendBytes(buf, 11, p.valueType("cycles", "count"))
+	buf = appendField(buf, 12, 1)
+
+	gz := gzip.NewWriter(w)
+
+	if _, err = gz.Write(buf); err != nil {
+		return
+	}
+
+	err = gz.Close()
+
+	return
+}
+
+func appendVarint(buf []byte, value uint64) []byte {
+	for value >= 0x80 {
+		buf = append(buf, uint8(value)|0x80)
+		value >>= 7
+	}
+
+	return append(buf, uint8(value))
+}
+
+// Appends a varint field.
+func appendField(buf []byte, field uint64, value uint64) []byte {
+	buf = appendVarint(buf, field<<3)
+	return appendVarint(buf, value)
+}
+
+// Appends a length-delimited field.
+func appendBytes(buf []byte, field uint64, value []byte) []byte {
+	buf = appendVarint(buf, field<<3|2)
+	buf = appendVarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
@@ -0,0 +1,316 @@
+package m65go2
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Cycle counts for a subroutine or interrupt handler, keyed by its
+// entry address.  Inclusive counts include the cycles of every
+// routine it called, exclusive counts only the cycles of its own
+// instructions.
+type Routine struct {
+	Address      uint16
+	Name         string
+	Calls        uint64
+	Frames       uint64
+	Inclusive    uint64
+	Exclusive    uint64
+	MaxInclusive uint64
+	MaxExclusive uint64
+
+	frameInclusive uint64
+	frameExclusive uint64
+	stamp          uint64
+}
+
+type byInclusive []*Routine
+
+func (routines byInclusive) Len() int      { return len(routines) }
+func (routines byInclusive) Swap(i, j int) { routines[i], routines[j] = routines[j], routines[i] }
+
+func (routines byInclusive) Less(i, j int) bool {
+	if routines[i].Inclusive != routines[j].Inclusive {
+		return routines[i].Inclusive > routines[j].Inclusive
+	}
+
+	return routines[i].Address < routines[j].Address
+}
+
+type callNode struct {
+	routine  *Routine
+	parent   *callNode
+	children map[*Routine]*callNode
+	cycles   uint64
+}
+
+func (node *callNode) child(routine *Routine) *callNode {
+	if node.children == nil {
+		node.children = map[*Routine]*callNode{}
+	}
+
+	child, ok := node.children[routine]
+
+	if !ok {
+		child = &callNode{routine: routine, parent: node}
+		node.children[routine] = child
+	}
+
+	return child
+}
+
+type callFrame struct {
+	node  *callNode
+	sp    int
+	kind  string
+	start uint64
+}
+
+// Attributes the cycles executed by an M6502 to the subroutines and
+// interrupt handlers that executed them by following JSR/RTS, BRK,
+// NMI/IRQ and RTI.  A routine is returned from once the stack pointer
+// has been unwound past the point it was entered at, so jump tables
+// that push an address and RTS to it are not mistaken for returns.
+//
+// Frame should be called at the end of every video frame.  Frames in
+// which the NMI handler ran for more than VBlankCycles are recorded in
+// Overruns.
+type Profiler struct {
+	lock         sync.Mutex
+	Routines     map[uint16]*Routine
+	Frames       uint64
+	Cycles       uint64
+	VBlankCycles uint64
+	Overruns     []uint64
+	root         callNode
+	stack        []callFrame
+	instructions uint64
+}
+
+// Returns a new, empty Profiler.
+func NewProfiler(vblankCycles uint64) *Profiler {
+	return &Profiler{
+		Routines:     map[uint16]*Routine{},
+		VBlankCycles: vblankCycles,
+		Overruns:     []uint64{},
+	}
+}
+
+func (profiler *Profiler) routine(address uint16, kind string) *Routine {
+	routine, ok := profiler.Routines[address]
+
+	if !ok {
+		routine = &Routine{
+			Address: address,
+			Name:    strings.TrimSpace(fmt.Sprintf("%s $%04X", kind, address)),
+		}
+
+		profiler.Routines[address] = routine
+	}
+
+	return routine
+}
+
+func (profiler *Profiler) enter(address uint16, sp int, kind string) {
+	routine := profiler.routine(address, kind)
+	routine.Calls++
+
+	node := &profiler.root
+
+	if len(profiler.stack) > 0 {
+		node = profiler.stack[len(profiler.stack)-1].node
+	}
+
+	profiler.stack = append(profiler.stack, callFrame{
+		node:  node.child(routine),
+		sp:    sp,
+		kind:  kind,
+		start: profiler.Cycles,
+	})
+}
+
+func (profiler *Profiler) leave(sp int) {
+	for len(profiler.stack) > 1 {
+		frame := profiler.stack[len(profiler.stack)-1]
+
+		if frame.sp > sp {
+			break
+		}
+
+		if frame.kind == "NMI" && profiler.Cycles-frame.start > profiler.VBlankCycles {
+			if n := len(profiler.Overruns); n == 0 || profiler.Overruns[n-1] != profiler.Frames {
+				profiler.Overruns = append(profiler.Overruns, profiler.Frames)
+			}
+		}
+
+		profiler.stack = profiler.stack[:len(profiler.stack)-1]
+	}
+}
+
+func (profiler *Profiler) interrupt(which Interrupt, pc uint16, cpu *M6502) {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	if len(profiler.stack) == 0 && which != Rst {
+		profiler.enter(pc, 0x200, "")
+	}
+
+	switch which {
+	case Irq:
+		profiler.enter(cpu.Registers.PC, int(cpu.Registers.SP)+3, "IRQ")
+	case Nmi:
+		profiler.enter(cpu.Registers.PC, int(cpu.Registers.SP)+3, "NMI")
+	case Rst:
+		profiler.stack = profiler.stack[:0]
+	}
+}
+
+func (profiler *Profiler) execute(pc uint16, opcode OpCode, cycles uint16, cpu *M6502) {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	if len(profiler.stack) == 0 {
+		// the bottom of the stack is never returned from
+		profiler.enter(pc, 0x200, "")
+	}
+
+	c := uint64(cycles)
+
+	profiler.Cycles += c
+	profiler.instructions++
+
+	top := profiler.stack[len(profiler.stack)-1].node
+	top.cycles += c
+	top.routine.Exclusive += c
+	top.routine.frameExclusive += c
+
+	// count each routine only once no matter how deeply it recursed
+	for node := top; node != &profiler.root; node = node.parent {
+		if routine := node.routine; routine.stamp != profiler.instructions {
+			routine.stamp = profiler.instructions
+			routine.Inclusive += c
+			routine.frameInclusive += c
+		}
+	}
+
+	sp := int(cpu.Registers.SP)
+
+	switch opcode {
+	// JSR
+	case 0x20:
+		profiler.enter(cpu.Registers.PC, sp+2, "")
+	// BRK
+	case 0x00:
+		profiler.enter(cpu.Registers.PC, sp+3, "BRK")
+	// RTS, RTI
+	case 0x60, 0x40:
+		profiler.leave(sp)
+	}
+}
+
+// Ends the current frame, updating each routine's per-frame maximums.
+func (profiler *Profiler) Frame() {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	for _, routine := range profiler.Routines {
+		if routine.frameInclusive == 0 {
+			continue
+		}
+
+		routine.Frames++
+
+		if routine.frameInclusive > routine.MaxInclusive {
+			routine.MaxInclusive = routine.frameInclusive
+		}
+
+		if routine.frameExclusive > routine.MaxExclusive {
+			routine.MaxExclusive = routine.frameExclusive
+		}
+
+		routine.frameInclusive = 0
+		routine.frameExclusive = 0
+	}
+
+	profiler.Frames++
+}
+
+// Writes a table of every routine's inclusive and exclusive cycles per
+// frame, sorted by inclusive cycles, followed by the frames in which
+// the NMI handler overran vblank.
+func (profiler *Profiler) WriteReport(w io.Writer) (err error) {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	frames := profiler.Frames
+
+	if frames == 0 {
+		frames = 1
+	}
+
+	routines := []*Routine{}
+
+	for _, routine := range profiler.Routines {
+		routines = append(routines, routine)
+	}
+
+	sort.Sort(byInclusive(routines))
+
+	fmt.Fprintf(w, "Frames: %v\n", profiler.Frames)
+	fmt.Fprintf(w, "Cycles: %v\n\n", profiler.Cycles)
+
+	fmt.Fprintf(w, "%-10s %10s %8s %12s %12s %12s %12s\n",
+		"Routine", "Calls", "Frames", "Incl/Frame", "Excl/Frame", "Max Incl", "Max Excl")
+
+	for _, routine := range routines {
+		fmt.Fprintf(w, "%-10s %10v %8v %12v %12v %12v %12v\n",
+			routine.Name, routine.Calls, routine.Frames,
+			routine.Inclusive/frames, routine.Exclusive/frames,
+			routine.MaxInclusive, routine.MaxExclusive)
+	}
+
+	fmt.Fprintf(w, "\nNMI overruns (more than %v cycles): %v frames\n",
+		profiler.VBlankCycles, len(profiler.Overruns))
+
+	for _, frame := range profiler.Overruns {
+		if _, err = fmt.Fprintf(w, "  frame %v\n", frame); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Writes the call tree as a gzip-compressed pprof profile, with one
+// sample of cycles per call stack, for use with 'go tool pprof'.
+func (profiler *Profiler) WritePprof(w io.Writer) (err error) {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	p := newPprof()
+
+	var walk func(node *callNode, stack []uint64)
+
+	walk = func(node *callNode, stack []uint64) {
+		if node.routine != nil {
+			stack = append([]uint64{p.location(node.routine)}, stack...)
+
+			if node.cycles > 0 {
+				p.sample(stack, node.cycles)
+			}
+		}
+
+		for _, child := range node.children {
+			walk(child, stack)
+		}
+	}
+
+	walk(&profiler.root, []uint64{})
+
+	err = p.write(w)
+
+	return
+}
@@ -0,0 +1,99 @@
+package m65go2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+)
+
+func TestProfiler(t *testing.T) {
+	Setup()
+
+	profiler := NewProfiler(10)
+	cpu.SetProfiler(profiler)
+
+	program := map[uint16][]uint8{
+		0x0200: {0x20, 0x00, 0x03, 0x20, 0x00, 0x03, 0xea}, // JSR $0300, JSR $0300, NOP
+		0x0300: {0x20, 0x00, 0x04, 0x60},                   // JSR $0400, RTS
+		0x0400: {0xea, 0x60},                               // NOP, RTS
+		0x0500: {0xea, 0x40},                               // NOP, RTI
+		0xfffa: {0x00, 0x05},                               // NMI vector
+	}
+
+	for address, code := range program {
+		for i, value := range code {
+			cpu.Memory.Store(address+uint16(i), value)
+		}
+	}
+
+	cpu.Registers.PC = 0x0200
+
+	for i := 0; i < 11; i++ {
+		cpu.Execute()
+	}
+
+	profiler.Frame()
+
+	cpu.Nmi = true
+
+	for i := 0; i < 2; i++ {
+		cpu.Execute()
+	}
+
+	profiler.Frame()
+
+	expected := []struct {
+		address                       uint16
+		name                          string
+		calls, inclusive, exclusive   uint64
+		frames, maxInclusive, maxExcl uint64
+	}{
+		{0x0200, "$0200", 1, 69, 14, 2, 54, 14},
+		{0x0300, "$0300", 2, 40, 24, 1, 40, 24},
+		{0x0400, "$0400", 2, 16, 16, 1, 16, 16},
+		{0x0500, "NMI $0500", 1, 15, 15, 1, 15, 15},
+	}
+
+	for _, e := range expected {
+		routine := profiler.Routines[e.address]
+
+		if routine == nil {
+			t.Errorf("No routine at $%04X", e.address)
+			continue
+		}
+
+		if routine.Name != e.name || routine.Calls != e.calls ||
+			routine.Inclusive != e.inclusive || routine.Exclusive != e.exclusive ||
+			routine.Frames != e.frames || routine.MaxInclusive != e.maxInclusive ||
+			routine.MaxExclusive != e.maxExcl {
+			t.Errorf("Routine $%04X is %+v, expected %+v", e.address, *routine, e)
+		}
+	}
+
+	if profiler.Frames != 2 {
+		t.Errorf("Frames is %v, expected 2", profiler.Frames)
+	}
+
+	if len(profiler.Overruns) != 1 || profiler.Overruns[0] != 1 {
+		t.Errorf("Overruns is %v, expected [1]", profiler.Overruns)
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := profiler.WritePprof(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if raw, err := ioutil.ReadAll(gz); err != nil || len(raw) == 0 {
+		t.Errorf("Invalid pprof profile: %v", err)
+	}
+
+	Teardown()
+}
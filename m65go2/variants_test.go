@@ -0,0 +1,243 @@
+package m65go2
+
+import "testing"
+
+func newVariant(variant Variant, program map[uint16][]uint8) *M6502 {
+	cpu := NewM6502Variant(NewBasicMemory(DEFAULT_MEMORY_SIZE), variant)
+	cpu.Reset()
+
+	for address, code := range program {
+		for i, value := range code {
+			cpu.Memory.Store(address+uint16(i), value)
+		}
+	}
+
+	cpu.Registers.PC = 0x0200
+
+	return cpu
+}
+
+func TestVariantDecimal(t *testing.T) {
+	// A, operand, carry in, opcode => A, P
+	vectors := []struct {
+		variant Variant
+		opcode  OpCode
+		a, m    uint8
+		carry   bool
+		result  uint8
+		flags   Status
+	}{
+		// ADC
+		{MOS6502, 0x69, 0x99, 0x01, false, 0x00, C | N},
+		{WDC65C02, 0x69, 0x99, 0x01, false, 0x00, C | Z},
+		{RP2A03, 0x69, 0x99, 0x01, false, 0x9a, N},
+		{MOS6502, 0x69, 0x29, 0x11, false, 0x40, 0},
+		{MOS6502, 0x69, 0x58, 0x46, true, 0x05, C | N | V},
+		{MOS6502, 0x69, 0x79, 0x00, true, 0x80, N | V},
+		{WDC65C02, 0x69, 0x79, 0x00, true, 0x80, N | V},
+		{MOS6502, 0x69, 0x0f, 0x0f, false, 0x14, 0},
+
+		// SBC
+		{MOS6502, 0xe9, 0x29, 0x11, true, 0x18, C},
+		{MOS6502, 0xe9, 0x00, 0x01, true, 0x99, N},
+		{WDC65C02, 0xe9, 0x00, 0x01, true, 0x99, N},
+		{RP2A03, 0xe9, 0x00, 0x01, true, 0xff, N},
+		{MOS6502, 0xe9, 0x01, 0x01, true, 0x00, C | Z},
+		{WDC65C02, 0xe9, 0x01, 0x01, true, 0x00, C | Z},
+		{MOS6502, 0xe9, 0x40, 0x13, false, 0x26, C},
+	}
+
+	for _, v := range vectors {
+		cpu := newVariant(v.variant, map[uint16][]uint8{
+			0x0200: {uint8(v.opcode), v.m},
+		})
+
+		cpu.Registers.A = v.a
+		cpu.Registers.P = D
+
+		if v.carry {
+			cpu.Registers.P |= C
+		}
+
+		cpu.Execute()
+
+		flags := cpu.Registers.P & (C | Z | V | N)
+
+		if cpu.Registers.A != v.result || flags != v.flags {
+			t.Errorf("Variant %v opcode %#02x of %#02x and %#02x is %#02x with flags %#02x, expected %#02x with flags %#02x",
+				v.variant, v.opcode, v.a, v.m, cpu.Registers.A, flags, v.result, v.flags)
+		}
+	}
+}
+
+func TestVariantJmpIndirect(t *testing.T) {
+	program := map[uint16][]uint8{
+		0x0200: {0x6c, 0xff, 0x02}, // JMP ($02FF)
+		0x02ff: {0x00, 0x04},
+	}
+
+	for _, v := range []struct {
+		variant Variant
+		pc      uint16
+		cycles  uint16
+	}{
+		{MOS6502, 0x6c00, 5},
+		{WDC65C02, 0x0400, 6},
+	} {
+		cpu := newVariant(v.variant, program)
+		cycles, _ := cpu.Execute()
+
+		if cpu.Registers.PC != v.pc || cycles != v.cycles {
+			t.Errorf("Variant %v jumped to %#04x in %v cycles, expected %#04x in %v cycles",
+				v.variant, cpu.Registers.PC, cycles, v.pc, v.cycles)
+		}
+	}
+}
+
+func TestVariantCMOSOpCodes(t *testing.T) {
+	cpu := newVariant(WDC65C02, map[uint16][]uint8{
+		0x0200: {
+			0xa2, 0x12, // LDX #$12
+			0xda,       // PHX
+			0x64, 0x10, // STZ $10
+			0x7a,       // PLY
+			0xa9, 0x81, // LDA #$81
+			0x04, 0x11, // TSB $11
+			0x14, 0x12, // TRB $12
+			0xb2, 0x15, // LDA ($15)
+			0x87, 0x14, // SMB0 $14
+			0x77, 0x14, // RMB7 $14
+			0x1a,             // INC A
+			0x0f, 0x14, 0x01, // BBR0 $14,+1
+			0x8f, 0x14, 0x01, // BBS0 $14,+1
+			0xea,       // NOP
+			0x80, 0x01, // BRA +1
+			0xea,             // NOP
+			0x7c, 0x00, 0x03, // JMP ($0300,X)
+		},
+		0x0010: {0xff, 0x02, 0xc3, 0x00, 0x00, 0x00, 0x80},
+		0x0312: {0x00, 0x05},
+		0x8000: {0x42},
+	})
+
+	expected := []uint16{2, 3, 3, 4, 2, 5, 5, 5, 5, 5, 2, 5, 6, 3, 6}
+
+	for i, e := range expected {
+		if cycles, err := cpu.Execute(); err != nil || cycles != e {
+			t.Errorf("Instruction %v took %v cycles (%v), expected %v", i, cycles, err, e)
+		}
+	}
+
+	if cpu.Registers.PC != 0x0500 {
+		t.Errorf("PC is %#04x, expected 0x0500", cpu.Registers.PC)
+	}
+
+	if cpu.Registers.Y != 0x12 {
+		t.Errorf("Y is %#02x, expected 0x12", cpu.Registers.Y)
+	}
+
+	if cpu.Registers.A != 0x43 {
+		t.Errorf("A is %#02x, expected 0x43", cpu.Registers.A)
+	}
+
+	for address, value := range map[uint16]uint8{0x10: 0x00, 0x11: 0x83, 0x12: 0x42, 0x14: 0x01} {
+		if actual := cpu.Memory.Fetch(address); actual != value {
+			t.Errorf("Memory %#04x is %#02x, expected %#02x", address, actual, value)
+		}
+	}
+}
+
+func TestVariantCMOSNops(t *testing.T) {
+	for _, v := range []struct {
+		opcode       OpCode
+		size, cycles uint16
+	}{
+		{0x02, 2, 2},
+		{0x03, 1, 1},
+		{0x44, 2, 3},
+		{0x5c, 3, 8},
+		{0xdc, 3, 4},
+		{0xeb, 1, 1},
+	} {
+		cpu := newVariant(WDC65C02, map[uint16][]uint8{
+			0x0200: {uint8(v.opcode)},
+		})
+
+		cycles, err := cpu.Execute()
+
+		if err != nil || cpu.Registers.PC != 0x0200+v.size || cycles != v.cycles {
+			t.Errorf("NOP %#02x moved PC to %#04x in %v cycles (%v), expected %#04x in %v cycles",
+				v.opcode, cpu.Registers.PC, cycles, err, 0x0200+v.size, v.cycles)
+		}
+	}
+}
+
+func TestVariantCMOSCycles(t *testing.T) {
+	for _, v := range []struct {
+		variant Variant
+		code    []uint8
+		decimal bool
+		cycles  uint16
+	}{
+		{MOS6502, []uint8{0x1e, 0x00, 0x03}, false, 7},  // ASL $0300,X
+		{WDC65C02, []uint8{0x1e, 0x00, 0x03}, false, 6}, // ASL $0300,X
+		{WDC65C02, []uint8{0x1e, 0xff, 0x03}, false, 7}, // ASL $03FF,X
+		{MOS6502, []uint8{0x69, 0x01}, true, 2},         // ADC #$01
+		{WDC65C02, []uint8{0x69, 0x01}, true, 3},        // ADC #$01
+		{WDC65C02, []uint8{0x69, 0x01}, false, 2},       // ADC #$01
+	} {
+		cpu := newVariant(v.variant, map[uint16][]uint8{0x0200: v.code})
+		cpu.Registers.X = 0x01
+
+		if v.decimal {
+			cpu.Registers.P |= D
+		}
+
+		if cycles, _ := cpu.Execute(); cycles != v.cycles {
+			t.Errorf("Variant %v opcode %#02x took %v cycles, expected %v", v.variant, v.code[0], cycles, v.cycles)
+		}
+	}
+}
+
+func TestVariantWaiStp(t *testing.T) {
+	cpu := newVariant(WDC65C02, map[uint16][]uint8{
+		0x0200: {0xcb, 0xea, 0xdb, 0xea}, // WAI, NOP, STP, NOP
+		0xfffc: {0x00, 0x02},
+	})
+
+	cpu.Registers.P |= I
+	cpu.Execute()
+
+	for i := 0; i < 3; i++ {
+		cpu.Execute()
+	}
+
+	if cpu.Registers.PC != 0x0201 {
+		t.Errorf("PC is %#04x while waiting, expected 0x0201", cpu.Registers.PC)
+	}
+
+	// a masked IRQ ends WAI without being serviced
+	cpu.Irq = true
+	cpu.Execute()
+	cpu.Irq = false
+
+	if cpu.Registers.PC != 0x0202 {
+		t.Errorf("PC is %#04x after IRQ, expected 0x0202", cpu.Registers.PC)
+	}
+
+	cpu.Execute()
+	cpu.Nmi = true
+	cpu.Execute()
+	cpu.Nmi = false
+
+	if cpu.Registers.PC != 0x0203 {
+		t.Errorf("PC is %#04x after NMI while stopped, expected 0x0203", cpu.Registers.PC)
+	}
+
+	cpu.Rst = true
+	cpu.Execute()
+
+	if cpu.Registers.PC != 0x0201 {
+		t.Errorf("PC is %#04x after reset, expected 0x0201", cpu.Registers.PC)
+	}
+}
@@ -30,15 +30,42 @@ func LoadConfig(options *nes.Options, filename string) (err error) {
 
 func main() {
 	options := &nes.Options{}
+	ntsc := nes.DefaultNTSCParams
 
 	flag.BoolVar(&options.CPUDecode, "cpu-decode", false, "decode CPU instructions")
 	flag.StringVar(&options.Recorder, "recorder", "", "recorder to use: none | jpeg | gif")
 	flag.StringVar(&options.AudioRecorder, "audio-recorder", "", "recorder to use: none | wav")
+	flag.IntVar(&options.AudioFrequency, "audio-frequency", 44100, "audio sample rate in Hz (e.g., 44100, 48000 or 96000)")
+	flag.BoolVar(&options.Stereo, "stereo", false, "mix audio in stereo with the channel volumes and pans of ~/.nintengorc")
+	flag.StringVar(&options.Trace, "trace", "", "write CPU instruction trace to file, gzip-compressed if file ends in .gz")
+	flag.StringVar(&options.TraceFormat, "trace-format", "nestest", "trace format to use: nestest | nintendulator")
+	flag.IntVar(&options.TraceStart, "trace-start", 0, "first frame to trace")
+	flag.IntVar(&options.TraceStop, "trace-stop", -1, "last frame to trace, -1 to trace until exit")
+	flag.UintVar(&options.TraceLowPC, "trace-low-pc", 0x0000, "lowest PC to trace (e.g., 0x8000)")
+	flag.UintVar(&options.TraceHighPC, "trace-high-pc", 0xffff, "highest PC to trace (e.g., 0xbfff)")
+	flag.IntVar(&options.TraceTrigger, "trace-trigger", -1, "start tracing once PC reaches this address (e.g., 0xc000), -1 to start immediately")
+	flag.StringVar(&options.CDL, "cdl", "", "log PRG/CHR code and data usage to FCEUX .cdl file, merging with the file if it exists")
+	flag.StringVar(&options.RoutineProfile, "routine-profile", "", "write 6502 routine profile to file in pprof format")
+	flag.StringVar(&options.RoutineReport, "routine-report", "", "write 6502 per-routine cycles per frame and NMI overruns to file")
 	flag.StringVar(&options.CPUProfile, "cpu-profile", "", "write CPU profile to file")
 	flag.StringVar(&options.MemProfile, "mem-profile", "", "write memory profile to file")
 	flag.StringVar(&options.HTTPAddress, "http", "", "HTTP service address (e.g., ':6060')")
+	flag.StringVar(&options.Palette, "palette", "rp2c02", "palette to use: rp2c02 | ntsc | rp2c03 | rp2c04-0001 | rp2c04-0002 | rp2c04-0003 | rp2c04-0004 | rp2c05 | .pal file")
+	flag.Float64Var(&options.NTSC.Hue, "ntsc-hue", ntsc.Hue, "hue rotation in degrees for -palette=ntsc and NTSC filters")
+	flag.Float64Var(&options.NTSC.Saturation, "ntsc-saturation", ntsc.Saturation, "saturation for -palette=ntsc and NTSC filters")
+	flag.Float64Var(&options.NTSC.Contrast, "ntsc-contrast", ntsc.Contrast, "contrast for -palette=ntsc and NTSC filters")
+	flag.Float64Var(&options.NTSC.Brightness, "ntsc-brightness", ntsc.Brightness, "brightness for -palette=ntsc and NTSC filters")
+	flag.Float64Var(&options.NTSC.Gamma, "ntsc-gamma", ntsc.Gamma, "display gamma for -palette=ntsc and NTSC filters")
+	flag.StringVar(&options.Filter, "filter", "none", "video filter to use: none | ntsc-rf | ntsc-composite | ntsc-svideo | ntsc-rgb")
+	flag.StringVar(&options.Scaler, "scaler", "none", "pixel art scaler to use: none | nearest2x | nearest3x | nearest4x | scale2x | scale3x | hq2x | hq3x | hq4x | xbr2x")
+	flag.Float64Var(&options.Scanlines, "scanlines", 0.0, "darken the gaps between scanlines by this much, from 0 to 1")
+	flag.BoolVar(&options.Blend, "blend", false, "blend each frame with the one before it")
+	flag.BoolVar(&options.NoSpriteLimit, "no-sprite-limit", false, "draw every sprite on a scanline instead of only the first 8")
+	flag.StringVar(&options.HDPack, "hd-pack", "", "directory of an HD pack's hires.txt to replace tiles with higher resolution art")
 	flag.Parse()
 
+	options.Mixer = nes.DefaultMixerParams
+
 	filename, err := homedir.Expand("~/.nintengorc")
 
 	if err != nil {
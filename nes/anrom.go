@@ -35,38 +35,30 @@ func (anrom *ANROM) String() string {
 		fmt.Sprintf("Mapper: 7 (ANROM)")
 }
 
-func (anrom *ANROM) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
-	fetch = []uint16{}
-	store = []uint16{}
+func (anrom *ANROM) Ranges(which rp2ago3.Mapping) (fetch, store []rp2ago3.Range) {
+	fetch = []rp2ago3.Range{}
+	store = []rp2ago3.Range{}
 
 	switch which {
 	case rp2ago3.PPU:
 		if anrom.ROMFile.chrBanks > 0 {
 			// CHR bank 1
-			for i := uint32(0x0000); i <= 0x0fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
+			store = append(store, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
 
 			// CHR bank 2
-			for i := uint32(0x1000); i <= 0x1fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
+			store = append(store, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
 		}
 	case rp2ago3.CPU:
 		if anrom.ROMFile.prgBanks > 0 {
 			// PRG bank 1
-			for i := uint32(0x8000); i <= 0xbfff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x8000, End: 0xbfff})
+			store = append(store, rp2ago3.Range{Start: 0x8000, End: 0xbfff})
 
 			// PRG bank 2
-			for i := uint32(0xc000); i <= 0xffff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0xc000, End: 0xffff})
+			store = append(store, rp2ago3.Range{Start: 0xc000, End: 0xffff})
 		}
 	}
 
@@ -128,6 +120,35 @@ func (anrom *ANROM) Store(address uint16, value uint8) (oldValue uint8) {
 	return
 }
 
+func (anrom *ANROM) PRGOffset(address uint16) (offset int) {
+	offset = -1
+	index := address & 0x3fff
+	lower, upper := anrom.prgBanks()
+
+	switch {
+	// PRG bank 1
+	case address >= 0x8000 && address <= 0xbfff:
+		offset = anrom.ROMFile.prgOffset(int(lower), index)
+	// PRG bank 2
+	case address >= 0xc000 && address <= 0xffff:
+		offset = anrom.ROMFile.prgOffset(int(upper), index)
+	}
+
+	return
+}
+
+func (anrom *ANROM) CHROffset(address uint16) (offset int) {
+	offset = -1
+
+	switch {
+	// CHR banks 1 & 2
+	case address >= 0x0000 && address <= 0x1fff:
+		offset = anrom.ROMFile.chrOffset(0, address)
+	}
+
+	return
+}
+
 func (anrom *ANROM) mirroring() uint8 {
 	return (anrom.Registers.BankSelect >> 4) & 0x01
 }
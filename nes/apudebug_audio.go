@@ -9,20 +9,22 @@ import (
 
 type APUDebugAudio struct {
 	frequency  int
+	channels   int
 	sampleSize int
-	input      chan int16
+	input      chan []int16
 }
 
-func NewAudio(frequency int, sampleSize int) (audio *APUDebugAudio, err error) {
+func NewAudio(frequency, channels, sampleSize int) (audio *APUDebugAudio, err error) {
 	audio = &APUDebugAudio{
 		frequency:  frequency,
+		channels:   channels,
 		sampleSize: sampleSize,
-		input:      make(chan int16),
+		input:      make(chan []int16),
 	}
 	return
 }
 
-func (audio *APUDebugAudio) Input() chan int16 {
+func (audio *APUDebugAudio) Input() chan []int16 {
 	return audio.input
 }
 
@@ -32,8 +34,8 @@ func (audio *APUDebugAudio) Run() {
 	samples := 0
 	for {
 		select {
-		case <-audio.input:
-			samples++
+		case s := <-audio.input:
+			samples += len(s) / audio.channels
 		case <-print.C:
 			t := time.Since(start)
 			fmt.Println("\nAPU DEBUG:")
@@ -59,6 +61,10 @@ func (audio *APUDebugAudio) Run() {
 	*/
 }
 
+func (audio *APUDebugAudio) Buffered() (samples, size int) {
+	return 0, 0
+}
+
 func (audio *APUDebugAudio) TogglePaused() {
 }
 
@@ -7,16 +7,55 @@ import (
 	"os"
 
 	"github.com/cryptix/wav"
+	"github.com/nwidger/nintengo/rp2ago3"
 )
 
+// The volume and pan of each channel in the stereo mixer.
+type MixerParams struct {
+	Pulse1    rp2ago3.ChannelMix
+	Pulse2    rp2ago3.ChannelMix
+	Triangle  rp2ago3.ChannelMix
+	Noise     rp2ago3.ChannelMix
+	DMC       rp2ago3.ChannelMix
+	Expansion rp2ago3.ChannelMix
+}
+
+var DefaultMixerParams = MixerParams{
+	Pulse1:    rp2ago3.ChannelMix{Volume: 1.0, Pan: -0.5},
+	Pulse2:    rp2ago3.ChannelMix{Volume: 1.0, Pan: 0.5},
+	Triangle:  rp2ago3.ChannelMix{Volume: 1.0, Pan: 0.0},
+	Noise:     rp2ago3.ChannelMix{Volume: 1.0, Pan: 0.0},
+	DMC:       rp2ago3.ChannelMix{Volume: 1.0, Pan: 0.0},
+	Expansion: rp2ago3.ChannelMix{Volume: 1.0, Pan: 0.0},
+}
+
+func (params MixerParams) Channels() (channels [rp2ago3.AUDIO_CHANNELS]rp2ago3.ChannelMix) {
+	channels[rp2ago3.Pulse1Channel] = params.Pulse1
+	channels[rp2ago3.Pulse2Channel] = params.Pulse2
+	channels[rp2ago3.TriangleChannel] = params.Triangle
+	channels[rp2ago3.NoiseChannel] = params.Noise
+	channels[rp2ago3.DMCChannel] = params.DMC
+	channels[rp2ago3.ExpansionChannel] = params.Expansion
+
+	return
+}
+
+// Audio and audio recorders are sent the samples of each frame
+// together, and must not modify them.  Stereo samples are sent as
+// pairs of left and right samples.
 type Audio interface {
-	Input() chan int16
+	Input() chan []int16
+	// Returns the number of samples waiting to be played and the
+	// number the audio's buffer holds, counting a pair of stereo
+	// samples once, or a size of 0 if it can't tell.  It is called
+	// while Run is running.
+	Buffered() (samples, size int)
 	Run()
 	TogglePaused()
 }
 
 type AudioRecorder interface {
-	Input() chan int16
+	Input() chan []int16
 	Record()
 	Stop()
 	Quit()
@@ -24,23 +63,27 @@ type AudioRecorder interface {
 }
 
 type WAVRecorder struct {
+	frequency int
+	channels  int
 	file      *os.File
 	wavWriter *wav.Writer
-	input     chan int16
+	input     chan []int16
 	stop      chan uint8
 }
 
-func NewWAVRecorder() (wr *WAVRecorder, err error) {
+func NewWAVRecorder(frequency, channels int) (wr *WAVRecorder, err error) {
 	wr = &WAVRecorder{
+		frequency: frequency,
+		channels:  channels,
 		wavWriter: nil,
-		input:     make(chan int16),
+		input:     make(chan []int16),
 		stop:      make(chan uint8),
 	}
 
 	return
 }
 
-func (wr *WAVRecorder) Input() chan int16 {
+func (wr *WAVRecorder) Input() chan []int16 {
 	return wr.input
 }
 
@@ -54,8 +97,8 @@ func (wr *WAVRecorder) Record() {
 	}
 
 	meta := wav.File{
-		Channels:        1,
-		SampleRate:      44100 * 2,
+		Channels:        uint16(wr.channels),
+		SampleRate:      uint32(wr.frequency),
 		SignificantBits: 16,
 	}
 
@@ -90,11 +133,13 @@ func (wr *WAVRecorder) Run() {
 
 	for {
 		select {
-		case s := <-wr.input:
+		case samples := <-wr.input:
 			if wr.wavWriter != nil {
-				if err = wr.wavWriter.WriteInt32(int32(s)); err != nil {
-					fmt.Fprintf(os.Stderr, "%v\n", err)
-					break
+				for _, s := range samples {
+					if err = wr.wavWriter.WriteSample([]byte{uint8(s), uint8(uint16(s) >> 8)}); err != nil {
+						fmt.Fprintf(os.Stderr, "%v\n", err)
+						break
+					}
 				}
 			}
 		case <-wr.stop:
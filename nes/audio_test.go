@@ -0,0 +1,134 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/nwidger/nintengo/rp2ago3"
+)
+
+// Samples in a frame at 44.1kHz.
+const benchFrameSamples = 44100 / 60
+
+// Drains samples like an audio backend.
+type benchAudio struct {
+	input  chan []int16
+	sample chan int16
+	quit   chan bool
+	count  int
+}
+
+func (audio *benchAudio) Input() chan []int16 {
+	return audio.input
+}
+
+func (audio *benchAudio) Run() {
+	for {
+		select {
+		case samples := <-audio.input:
+			audio.count += len(samples)
+		case <-audio.sample:
+			audio.count++
+		case <-audio.quit:
+			audio.quit <- true
+			return
+		}
+	}
+}
+
+func (audio *benchAudio) Buffered() (samples, size int) {
+	return 0, 0
+}
+
+func (audio *benchAudio) TogglePaused() {}
+
+// A sample sent on its own, as every sample was before they were
+// sent by frame.
+type benchSampleEvent struct {
+	sample int16
+}
+
+func (e *benchSampleEvent) Process(nes *NES) {
+	nes.audio.(*benchAudio).sample <- e.sample
+}
+
+type benchQuitEvent struct{}
+
+func (e *benchQuitEvent) Process(nes *NES) {
+	nes.state = Quitting
+}
+
+// Returns an NES with just its events and audio running and a func
+// that stops them and returns the number of samples the audio got.
+func newBenchNES() (nes *NES, stop func() int) {
+	audio := &benchAudio{
+		input:  make(chan []int16),
+		sample: make(chan int16),
+		quit:   make(chan bool),
+	}
+
+	nes = &NES{
+		state:  Running,
+		events: make(chan Event),
+		CPU:    rp2ago3.NewRP2A03(rp2ago3.NTSC_CPU_FREQUENCY, 44100),
+		audio:  audio,
+	}
+
+	go audio.Run()
+	go nes.processEvents()
+
+	stop = func() int {
+		nes.events <- &benchQuitEvent{}
+		audio.quit <- true
+		<-audio.quit
+
+		return audio.count
+	}
+
+	return
+}
+
+func TestFlushSamples(t *testing.T) {
+	nes, stop := newBenchNES()
+
+	for i := 0; i < 10*benchFrameSamples+1; i++ {
+		if nes.sample(int16(i), int16(i)); len(nes.samples) == benchFrameSamples {
+			samples := nes.samples
+			nes.flushSamples()
+
+			if len(nes.samples) != 0 || &nes.samples[:1][0] == &samples[0] {
+				t.Fatal("Flushed samples are reused")
+			}
+		}
+	}
+
+	nes.flushSamples()
+
+	if count := stop(); count != 10*benchFrameSamples+1 {
+		t.Errorf("Audio got %v samples not %v", count, 10*benchFrameSamples+1)
+	}
+}
+
+func BenchmarkAudioPerSample(b *testing.B) {
+	nes, stop := newBenchNES()
+
+	for i := 0; i < b.N; i++ {
+		nes.events <- &benchSampleEvent{
+			sample: int16(i),
+		}
+	}
+
+	stop()
+}
+
+func BenchmarkAudioPerFrame(b *testing.B) {
+	nes, stop := newBenchNES()
+
+	for i := 0; i < b.N; i++ {
+		if nes.sample(int16(i), int16(i)); len(nes.samples) == benchFrameSamples {
+			nes.flushSamples()
+		}
+	}
+
+	nes.flushSamples()
+	stop()
+}
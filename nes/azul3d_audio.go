@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sync/atomic"
 	"unsafe"
 
 	"azul3d.org/native/al.v1-dev"
@@ -14,14 +15,21 @@ import (
 type Azul3DAudio struct {
 	paused     bool
 	frequency  int
+	channels   int
 	device     *al.Device
 	source     uint32
 	buffers    []uint32
 	sampleSize int
-	input      chan int16
+	input      chan []int16
+	schan      chan []int16
+
+	// the samples stream has not filled a buffer with yet and the
+	// buffers OpenAL has not finished playing, for Buffered
+	streaming int64
+	unplayed  int64
 }
 
-func NewAudio(frequency int, sampleSize int) (audio *Azul3DAudio, err error) {
+func NewAudio(frequency, channels, sampleSize int) (audio *Azul3DAudio, err error) {
 	var device *al.Device
 
 	device, err = al.OpenDevice("", nil)
@@ -32,10 +40,12 @@ func NewAudio(frequency int, sampleSize int) (audio *Azul3DAudio, err error) {
 
 	audio = &Azul3DAudio{
 		frequency:  frequency,
+		channels:   channels,
 		device:     device,
-		sampleSize: sampleSize,
+		sampleSize: sampleSize * channels,
 		buffers:    make([]uint32, 2),
-		input:      make(chan int16, sampleSize),
+		input:      make(chan []int16, 2),
+		schan:      make(chan []int16, 2),
 	}
 
 	al.SetErrorHandler(func(e error) {
@@ -63,7 +73,7 @@ func NewAudio(frequency int, sampleSize int) (audio *Azul3DAudio, err error) {
 	return
 }
 
-func (audio *Azul3DAudio) Input() chan int16 {
+func (audio *Azul3DAudio) Input() chan []int16 {
 	return audio.input
 }
 
@@ -71,21 +81,39 @@ func (audio *Azul3DAudio) stream(schan chan []int16) {
 	samples := []int16{}
 
 	for {
-		samples = append(samples, <-audio.input)
+		for _, s := range <-audio.input {
+			samples = append(samples, s)
 
-		if len(samples) == audio.sampleSize {
-			schan <- samples
-			samples = []int16{}
+			if len(samples) == audio.sampleSize {
+				schan <- samples
+				samples = []int16{}
+			}
 		}
+
+		atomic.StoreInt64(&audio.streaming, int64(len(samples)))
 	}
 }
 
+func (audio *Azul3DAudio) Buffered() (samples, size int) {
+	buffers := len(audio.schan) + int(atomic.LoadInt64(&audio.unplayed))
+	samples = int(atomic.LoadInt64(&audio.streaming)) + buffers*audio.sampleSize
+	size = (len(audio.buffers) + cap(audio.schan) + 1) * audio.sampleSize
+
+	return samples / audio.channels, size / audio.channels
+}
+
 func (audio *Azul3DAudio) bufferData(buffer uint32, samples []int16) (err error) {
 	al.SetErrorHandler(func(e error) {
 		err = e
 	})
 
-	audio.device.BufferData(buffer, al.FORMAT_MONO16, unsafe.Pointer(&samples[0]),
+	format := al.FORMAT_MONO16
+
+	if audio.channels == 2 {
+		format = al.FORMAT_STEREO16
+	}
+
+	audio.device.BufferData(buffer, format, unsafe.Pointer(&samples[0]),
 		int32(int(unsafe.Sizeof(samples[0]))*len(samples)), int32(audio.frequency))
 
 	return
@@ -103,7 +131,7 @@ func (audio *Azul3DAudio) Run() {
 
 	al.SetErrorHandler(handler)
 
-	schan := make(chan []int16, len(audio.buffers))
+	schan := audio.schan
 
 	go audio.stream(schan)
 
@@ -122,6 +150,7 @@ func (audio *Azul3DAudio) Run() {
 		// it.
 		for {
 			audio.device.GetSourcei(audio.source, al.BUFFERS_PROCESSED, &processed)
+			atomic.StoreInt64(&audio.unplayed, int64(len(audio.buffers))-int64(processed))
 			if processed > 0 {
 				break
 			}
@@ -159,6 +188,8 @@ func (audio *Azul3DAudio) Run() {
 			samples = nil
 		}
 
+		atomic.StoreInt64(&audio.unplayed, int64(len(audio.buffers)))
+
 		// Begin playing the source now that we've filled all the buffers.
 		if audio.device.GetSourcei(audio.source, al.SOURCE_STATE, &state); state != al.PLAYING {
 			audio.device.SourcePlay(audio.source)
@@ -14,9 +14,8 @@ import (
 )
 
 type Azul3DVideo struct {
-	input         chan []uint8
+	input         chan *image.RGBA
 	width, height int
-	palette       []color.Color
 	events        chan Event
 	overscan      bool
 	caption       string
@@ -24,9 +23,8 @@ type Azul3DVideo struct {
 
 func NewVideo(caption string, events chan Event) (video *Azul3DVideo, err error) {
 	video = &Azul3DVideo{
-		input:    make(chan []uint8, 128),
+		input:    make(chan *image.RGBA, 128),
 		events:   events,
-		palette:  RGBAPalette,
 		overscan: true,
 		caption:  caption,
 	}
@@ -49,7 +47,7 @@ func (video *Azul3DVideo) Events() chan Event {
 	return video.events
 }
 
-func (video *Azul3DVideo) Input() chan []uint8 {
+func (video *Azul3DVideo) Input() chan *image.RGBA {
 	return video.input
 }
 
@@ -132,6 +130,8 @@ func (video *Azul3DVideo) handleInput(ev keyboard.StateEvent, w *window.Window)
 			setSize(960, 1024)
 		case keyboard.Five:
 			setSize(1440, 2560)
+		case keyboard.C:
+			event = &PaletteEvent{}
 		case keyboard.P:
 			event = &PauseEvent{}
 		case keyboard.N:
@@ -159,6 +159,8 @@ func (video *Azul3DVideo) handleInput(ev keyboard.StateEvent, w *window.Window)
 			event = &ShowBackgroundEvent{}
 		case keyboard.Zero:
 			event = &ShowSpritesEvent{}
+		case keyboard.Eight:
+			event = &NoSpriteLimitEvent{}
 		case keyboard.F1:
 			event = &SaveStateEvent{}
 		case keyboard.F5:
@@ -222,7 +224,7 @@ func (video *Azul3DVideo) handleInput(ev keyboard.StateEvent, w *window.Window)
 }
 
 func (video *Azul3DVideo) Run() {
-	colors := []uint8{}
+	frame := image.NewRGBA(image.Rect(0, 0, 256, 240))
 	running := true
 
 	gfxLoop := func(w window.Window, r gfx.Renderer) {
@@ -281,30 +283,16 @@ func (video *Azul3DVideo) Run() {
 		card.Textures = []*gfx.Texture{nil}
 		card.Meshes = []*gfx.Mesh{cardMesh}
 
-		img := image.NewPaletted(image.Rect(0, 0, 256, 240), video.palette)
-
 		updateTex := func() {
-			x, y := 0, 0
-
-			for _, c := range colors {
-				img.Set(x, y, video.palette[c])
-
-				switch x {
-				case 255:
-					x = 0
-					y++
-				default:
-					x++
-				}
-			}
-
 			scale := gfx.Vec3{1.0, 1.0, 0.0}
 			shift := gfx.Vec3{0, 0, 0}
 			if video.overscan {
 				var cropPx float32 = 8.0
 
-				nx := 1.0 / float32(img.Bounds().Dx())
-				ny := 1.0 / float32(img.Bounds().Dy())
+				// crop the same fraction of the picture
+				// whatever width the filter outputs
+				nx := 1.0 / float32(256)
+				ny := 1.0 / float32(240)
 
 				scale = gfx.Vec3{
 					X: 1.0 - (nx * cropPx * 2),
@@ -322,7 +310,7 @@ func (video *Azul3DVideo) Run() {
 			// compression because those textures cannot be downloaded.
 			tex := gfx.NewTexture()
 
-			tex.Source = img
+			tex.Source = frame
 			tex.MinFilter = gfx.Nearest
 			tex.MagFilter = gfx.Nearest
 
@@ -350,14 +338,14 @@ func (video *Azul3DVideo) Run() {
 
 			for running {
 				select {
-				case colors = <-video.input:
+				case frame = <-video.input:
 					// We drop any pending frames and grab the most recent one. This is
 					// because frame display is tied to the runProcessors loop and can
 					// cause audio stuttering.
 				frameDrop:
 					for {
 						select {
-						case colors = <-video.input:
+						case frame = <-video.input:
 						default:
 							break frameDrop
 						}
@@ -0,0 +1,157 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/nwidger/nintengo/m65go2"
+	"github.com/nwidger/nintengo/rp2ago3"
+)
+
+// Flags recorded for each byte of PRG ROM.  Bits 2-3 hold which 8 KB
+// window of $8000-$ffff the byte was accessed through.
+const (
+	CDLCode uint8 = 0x01
+	CDLData uint8 = 0x02
+)
+
+// Flags recorded for each byte of CHR ROM.
+const (
+	CDLRendered uint8 = 0x01
+)
+
+// Logs which bytes of a ROM's PRG ROM were executed as code or read
+// as data and which bytes of its CHR ROM were rendered by the PPU.
+// Flags are recorded by offset into the ROM file's PRG and CHR data
+// rather than by CPU or PPU address so that they remain correct
+// across bank switches, and can be saved to and loaded from the
+// .cdl format used by FCEUX.
+//
+// A CDL sits in front of the ROM in the CPU's memory map and must
+// receive each instruction's address through M6502.OnExecute
+// and each pattern fetch through RP2C02.PatternFetch.
+type CDL struct {
+	PRG []uint8
+	CHR []uint8
+	rom ROM
+	cpu *m65go2.M6502
+	pc  uint16
+	end uint16
+}
+
+// Returns a new, empty CDL for the given ROM.
+func NewCDL(rom ROM, cpu *m65go2.M6502) *CDL {
+	return &CDL{
+		PRG: make([]uint8, rom.PRGSize()),
+		CHR: make([]uint8, rom.CHRSize()),
+		rom: rom,
+		cpu: cpu,
+	}
+}
+
+func (cdl *CDL) Ranges(which rp2ago3.Mapping) (fetch, store []rp2ago3.Range) {
+	return cdl.rom.Ranges(which)
+}
+
+func (cdl *CDL) Reset() {
+
+}
+
+// Marks the start of the instruction at pc, suitable for passing to
+// M6502.OnExecute.  The instruction's bytes are known once its
+// opcode has been fetched.
+func (cdl *CDL) Execute(pc uint16) {
+	cdl.pc = pc
+	cdl.end = pc
+}
+
+// Fetches from the ROM, marking the byte as code if it is part of the
+// current instruction and as data otherwise.
+func (cdl *CDL) Fetch(address uint16) (value uint8) {
+	value = cdl.rom.Fetch(address)
+
+	offset := cdl.rom.PRGOffset(address)
+
+	if offset < 0 {
+		return
+	}
+
+	flag := CDLData
+
+	switch {
+	// opcode
+	case address == cdl.pc && cdl.end == cdl.pc:
+		cdl.end = cdl.pc + cdl.cpu.Instructions.Size(m65go2.OpCode(value))
+		flag = CDLCode
+	// operands
+	case address-cdl.pc < cdl.end-cdl.pc:
+		flag = CDLCode
+	}
+
+	cdl.PRG[offset] |= flag | uint8((address>>13)&0x03)<<2
+
+	return
+}
+
+// Returns the value Fetch would return without logging the access.
+func (cdl *CDL) Peek(address uint16) (value uint8) {
+	if peeker, ok := cdl.rom.(rp2ago3.PeekableMemory); ok {
+		value = peeker.Peek(address)
+	} else {
+		value = cdl.rom.Fetch(address)
+	}
+
+	return
+}
+
+func (cdl *CDL) Store(address uint16, value uint8) (oldValue uint8) {
+	return cdl.rom.Store(address, value)
+}
+
+// Marks both planes of the tile row at address as rendered, suitable
+// for use as RP2C02.PatternFetch.
+func (cdl *CDL) Pattern(address uint16) {
+	for _, plane := range []uint16{address &^ 0x0008, address | 0x0008} {
+		if offset := cdl.rom.CHROffset(plane); offset >= 0 {
+			cdl.CHR[offset] |= CDLRendered
+		}
+	}
+}
+
+// Merges the flags in a .cdl file into the CDL.
+func (cdl *CDL) Load(filename string) (err error) {
+	var buf []byte
+
+	if buf, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	if len(buf) != len(cdl.PRG)+len(cdl.CHR) {
+		err = errors.New(fmt.Sprintf("Invalid CDL: %v is %v bytes, expected %v",
+			filename, len(buf), len(cdl.PRG)+len(cdl.CHR)))
+		return
+	}
+
+	for i := range cdl.PRG {
+		cdl.PRG[i] |= buf[i]
+	}
+
+	for i := range cdl.CHR {
+		cdl.CHR[i] |= buf[len(cdl.PRG)+i]
+	}
+
+	return
+}
+
+// Writes the CDL to a .cdl file, PRG ROM flags followed by CHR ROM
+// flags.
+func (cdl *CDL) Save(filename string) (err error) {
+	buf := make([]uint8, 0, len(cdl.PRG)+len(cdl.CHR))
+	buf = append(buf, cdl.PRG...)
+	buf = append(buf, cdl.CHR...)
+
+	err = ioutil.WriteFile(filename, buf, 0644)
+
+	return
+}
@@ -0,0 +1,117 @@
+package nes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nwidger/nintengo/m65go2"
+	"github.com/nwidger/nintengo/rp2ago3"
+)
+
+func TestCDL(t *testing.T) {
+	// UNROM, 3 PRG banks, 1 CHR bank
+	buf := make([]byte, 16+(3*0x4000)+0x2000)
+	copy(buf, []byte{0x4e, 0x45, 0x53, 0x1a, 0x03, 0x01, 0x20, 0x00})
+
+	prg := buf[16 : 16+(3*0x4000)]
+
+	copy(prg[0x8000:], []byte{
+		0xa9, 0x01, // $c000: LDA #$01
+		0x8d, 0x00, 0x80, // $c002: STA $8000 (select bank 1)
+		0xad, 0x34, 0x92, // $c005: LDA $9234
+		0x4c, 0x00, 0x80, // $c008: JMP $8000
+	})
+
+	prg[0x4000] = 0xea // $8000: NOP
+
+	romf, err := NewROMFile(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rom := NewUNROM(romf)
+
+	cpu := m65go2.NewM6502(rp2ago3.NewMappedMemory(m65go2.NewBasicMemory(m65go2.DEFAULT_MEMORY_SIZE)))
+	cdl := NewCDL(rom, cpu)
+
+	cpu.Memory.(*rp2ago3.MappedMemory).AddRanges(cdl, rp2ago3.CPU)
+	cpu.OnExecute(cdl.Execute)
+	cpu.Registers.PC = 0xc000
+
+	for i := 0; i < 5; i++ {
+		if _, err = cpu.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(cdl.PRG) != 3*0x4000 || len(cdl.CHR) != 0x2000 {
+		t.Fatalf("CDL is %v/%v bytes, expected %v/%v", len(cdl.PRG), len(cdl.CHR), 3*0x4000, 0x2000)
+	}
+
+	for i := 0x8000; i < 0x800b; i++ {
+		if cdl.PRG[i] != CDLCode|0x08 {
+			t.Errorf("PRG %#04x is %#02x, expected %#02x", i, cdl.PRG[i], CDLCode|0x08)
+		}
+	}
+
+	if cdl.PRG[0x4000] != CDLCode {
+		t.Errorf("PRG 0x4000 is %#02x, expected %#02x", cdl.PRG[0x4000], CDLCode)
+	}
+
+	if cdl.PRG[0x5234] != CDLData {
+		t.Errorf("PRG 0x5234 is %#02x, expected %#02x", cdl.PRG[0x5234], CDLData)
+	}
+
+	if cdl.PRG[0x0000] != 0x00 || cdl.PRG[0x1234] != 0x00 {
+		t.Error("Unmapped PRG bank was logged")
+	}
+
+	cdl.Pattern(0x0123)
+
+	if cdl.CHR[0x0123] != CDLRendered || cdl.CHR[0x012b] != CDLRendered {
+		t.Error("Tile row was not logged as rendered")
+	}
+
+	dir, err := ioutil.TempDir("", "nintengo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "test.cdl")
+
+	if err = cdl.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewCDL(rom, cpu)
+
+	if err = loaded.Load(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range cdl.PRG {
+		if loaded.PRG[i] != cdl.PRG[i] {
+			t.Fatalf("Loaded PRG %#04x is %#02x, expected %#02x", i, loaded.PRG[i], cdl.PRG[i])
+		}
+	}
+
+	for i := range cdl.CHR {
+		if loaded.CHR[i] != cdl.CHR[i] {
+			t.Fatalf("Loaded CHR %#04x is %#02x, expected %#02x", i, loaded.CHR[i], cdl.CHR[i])
+		}
+	}
+
+	if err = ioutil.WriteFile(filename, []byte{0x00}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = loaded.Load(filename); err == nil {
+		t.Error("No error loading CDL of the wrong size")
+	}
+}
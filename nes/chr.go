@@ -0,0 +1,163 @@
+package nes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+
+	"github.com/nwidger/nintengo/rp2cgo2"
+)
+
+// A 1 KB slice of the pattern tables and where it is mapped from.
+type CHRBank struct {
+	Address uint16
+	// the offset into the ROM file's CHR ROM, or -1 for CHR RAM
+	Offset int
+}
+
+func (bank CHRBank) String() string {
+	if bank.Offset < 0 {
+		return fmt.Sprintf("$%04x: CHR RAM", bank.Address)
+	}
+
+	return fmt.Sprintf("$%04x: CHR ROM $%05x (1 KB bank %v)", bank.Address, bank.Offset, bank.Offset/0x400)
+}
+
+// Returns where the mapper currently maps each 1 KB slice of the
+// pattern tables from.
+func (nes *NES) CHRBanks() (banks []CHRBank) {
+	for address := uint16(0x0000); address <= 0x1fff; address += 0x0400 {
+		banks = append(banks, CHRBank{
+			Address: address,
+			Offset:  nes.ROM.CHROffset(address),
+		})
+	}
+
+	return
+}
+
+// Returns the colours pattern tables are drawn with, one of the PPU's
+// 8 palettes in the current palette or a ramp of greys if palette is
+// negative.
+func (nes *NES) patternColors(palette int) (colors [4]color.RGBA) {
+	if palette < 0 {
+		for i := range colors {
+			colors[i] = color.RGBA{uint8(i * 0x55), uint8(i * 0x55), uint8(i * 0x55), 0xff}
+		}
+
+		return
+	}
+
+	for i, c := range nes.PPU.PaletteColors(palette) {
+		colors[i] = color.RGBAModel.Convert(nes.palette[c]).(color.RGBA)
+	}
+
+	return
+}
+
+// Returns a 256x128 image of both pattern tables drawn with one of
+// the PPU's 8 palettes, 0-3 being the background palettes and 4-7 the
+// sprite palettes, or a ramp of greys if palette is negative.
+func (nes *NES) PatternTables(palette int) *image.RGBA {
+	colors := nes.patternColors(palette)
+	frame := image.NewRGBA(image.Rect(0, 0, 256, 128))
+
+	for i, index := range nes.PPU.PatternTables() {
+		c := colors[index]
+		frame.Pix[i*4], frame.Pix[i*4+1], frame.Pix[i*4+2], frame.Pix[i*4+3] = c.R, c.G, c.B, c.A
+	}
+
+	return frame
+}
+
+// Saves the pattern tables drawn with the given palette, as for
+// PatternTables, to filename as a PNG.
+func (nes *NES) SavePatternTables(filename string, palette int) (err error) {
+	fo, err := os.Create(filename)
+
+	if err != nil {
+		return
+	}
+
+	defer fo.Close()
+
+	w := bufio.NewWriter(fo)
+
+	if err = png.Encode(w, nes.PatternTables(palette)); err != nil {
+		return
+	}
+
+	err = w.Flush()
+
+	return
+}
+
+// Replaces the pattern tables with a 256x128 image laid out as
+// PatternTables draws them.  Each pixel is matched to the closest of
+// the colours the given palette draws with, so the palette must have 4
+// distinct colours.  Slices of the pattern tables mapped from CHR RAM
+// are written to directly and slices mapped from CHR ROM are patched
+// in the loaded ROM, which SavePatchedROM can then save.  Returns
+// whether any CHR ROM was patched.
+func (nes *NES) ImportPatternTables(img image.Image, palette int) (patched bool, err error) {
+	bounds := img.Bounds()
+
+	if bounds.Dx() != 256 || bounds.Dy() != 128 {
+		err = errors.New(fmt.Sprintf("Pattern table image is %vx%v, expected 256x128", bounds.Dx(), bounds.Dy()))
+		return
+	}
+
+	colors := nes.patternColors(palette)
+
+	for i := range colors {
+		for j := range colors[:i] {
+			if colors[i] == colors[j] {
+				err = errors.New(fmt.Sprintf("Palette %v has duplicate colours, use a palette with 4 distinct colours", palette))
+				return
+			}
+		}
+	}
+
+	indexes := make([]uint8, 256*128)
+
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 256; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			closest := -1
+
+			for i, c := range colors {
+				dr, dg, db := int(r>>8)-int(c.R), int(g>>8)-int(c.G), int(b>>8)-int(c.B)
+
+				if d := dr*dr + dg*dg + db*db; closest < 0 || d < closest {
+					closest = d
+					indexes[y*256+x] = uint8(i)
+				}
+			}
+		}
+	}
+
+	for address, value := range rp2cgo2.EncodePatternTables(indexes) {
+		if offset := nes.ROM.CHROffset(uint16(address)); offset >= 0 {
+			nes.ROM.PatchCHR(offset, value)
+			patched = true
+		} else {
+			nes.PPU.Memory.Poke(uint16(address), value)
+		}
+	}
+
+	return
+}
+
+// Saves the loaded ROM, including any CHR ROM patched by
+// ImportPatternTables, next to the original as a .nes file.  Returns
+// the name of the file saved.
+func (nes *NES) SavePatchedROM() (filename string, err error) {
+	filename = nes.ROM.GameName() + "-patched.nes"
+	err = nes.ROM.SaveROM(filename)
+
+	return
+}
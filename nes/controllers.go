@@ -34,6 +34,11 @@ type Controller struct {
 type Controllers struct {
 	last        uint8
 	controllers [2]Controller
+
+	// Returns the value left on the CPU data bus, which bits 5-7
+	// of $4016 and $4017 read back.  If nil, those bits read as
+	// $40, the high byte of the address of a typical read.
+	OpenBus func() uint8 `json:"-"`
 }
 
 func NewControllers() *Controllers {
@@ -70,7 +75,34 @@ func (ctrls *Controllers) Fetch(address uint16) (value uint8) {
 			ctrl.strobe++
 		}
 
-		value |= 0x40
+		if ctrls.OpenBus != nil {
+			value |= ctrls.OpenBus() & 0xe0
+		} else {
+			value |= 0x40
+		}
+	}
+
+	return
+}
+
+// Returns the value Fetch would return without advancing the
+// controller's shift register.
+func (ctrls *Controllers) Peek(address uint16) (value uint8) {
+	switch address {
+	case 0x4016, 0x4017:
+		ctrl := &ctrls.controllers[address-0x4016]
+
+		if ctrl.strobe == One {
+			value = 1
+		} else {
+			value = (ctrl.buttons >> ctrl.strobe) & 0x01
+		}
+
+		if ctrls.OpenBus != nil {
+			value |= ctrls.OpenBus() & 0xe0
+		} else {
+			value |= 0x40
+		}
 	}
 
 	return
@@ -67,3 +67,14 @@ func TestControllers(t *testing.T) {
 		}
 	}
 }
+
+func TestControllersOpenBus(t *testing.T) {
+	ctrls := NewControllers()
+	ctrls.OpenBus = func() uint8 { return 0xbf }
+
+	ctrls.controllers[0].buttons = 0x01
+
+	if value := ctrls.Fetch(0x4016); value != 0xa1 {
+		t.Errorf("Memory is %#02x not 0xa1", value)
+	}
+}
@@ -1,13 +1,16 @@
 package nes
 
-import "fmt"
+import (
+	"fmt"
+	"image"
+)
 
 type Event interface {
 	Process(nes *NES)
 }
 
 type FrameEvent struct {
-	colors []uint8
+	frame *image.RGBA
 }
 
 func (e *FrameEvent) String() string {
@@ -20,30 +23,31 @@ func (e *FrameEvent) Process(nes *NES) {
 	}
 
 	if nes.recorder != nil {
-		nes.recorder.Input() <- e.colors
+		nes.recorder.Input() <- e.frame
 	}
 
-	nes.video.Input() <- e.colors
+	nes.video.Input() <- e.frame
 }
 
-type SampleEvent struct {
-	sample int16
+// The audio samples of a frame.
+type SamplesEvent struct {
+	samples []int16
 }
 
-func (e *SampleEvent) String() string {
-	return "SampleEvent"
+func (e *SamplesEvent) String() string {
+	return "SamplesEvent"
 }
 
-func (e *SampleEvent) Process(nes *NES) {
+func (e *SamplesEvent) Process(nes *NES) {
 	if nes.state != Running {
 		return
 	}
 
 	if nes.audioRecorder != nil {
-		nes.audioRecorder.Input() <- e.sample
+		nes.audioRecorder.Input() <- e.samples
 	}
 
-	nes.audio.Input() <- e.sample
+	nes.audio.Input() <- e.samples
 }
 
 type ControllerEvent struct {
@@ -182,6 +186,54 @@ func (e *QuitEvent) Process(nes *NES) {
 	nes.state = Quitting
 }
 
+// Switches palettes.  Name is the palette to switch to, or the
+// built-in palette after the current one if it is empty.  If Err is
+// set the result of switching is sent on it.
+type PaletteEvent struct {
+	Name string
+	Err  chan error
+}
+
+func (e *PaletteEvent) String() string {
+	return "PaletteEvent"
+}
+
+// The palette is switched through Call, so that it never changes while
+// a frame is being filtered, from a separate goroutine since the
+// processors may be waiting to send an event.
+func (e *PaletteEvent) Process(nes *NES) {
+	go nes.Call(func() {
+		e.switchPalette(nes)
+	})
+}
+
+func (e *PaletteEvent) switchPalette(nes *NES) {
+	name := e.Name
+
+	if name == "" {
+		name = PaletteNames[0]
+
+		for i, n := range PaletteNames {
+			if n == nes.options.Palette && i+1 < len(PaletteNames) {
+				name = PaletteNames[i+1]
+			}
+		}
+	}
+
+	err := nes.SetPalette(name)
+
+	if e.Err != nil {
+		e.Err <- err
+	}
+
+	if err != nil {
+		fmt.Printf("*** Error setting palette: %s\n", err)
+		return
+	}
+
+	fmt.Println("*** Setting palette to", name)
+}
+
 type ShowBackgroundEvent struct{}
 
 func (e *ShowBackgroundEvent) String() string {
@@ -204,6 +256,17 @@ func (e *ShowSpritesEvent) Process(nes *NES) {
 	fmt.Println("*** Toggling show sprites =", nes.PPU.ShowSprites)
 }
 
+type NoSpriteLimitEvent struct{}
+
+func (e *NoSpriteLimitEvent) String() string {
+	return "NoSpriteLimitEvent"
+}
+
+func (e *NoSpriteLimitEvent) Process(nes *NES) {
+	nes.PPU.NoSpriteLimit = !nes.PPU.NoSpriteLimit
+	fmt.Println("*** Toggling no sprite limit =", nes.PPU.NoSpriteLimit)
+}
+
 type CPUDecodeEvent struct{}
 
 func (e *CPUDecodeEvent) String() string {
@@ -328,8 +391,14 @@ func (e *SavePatternTablesEvent) String() string {
 }
 
 func (e *SavePatternTablesEvent) Process(nes *NES) {
-	fmt.Println("*** Saving PPU pattern tables")
-	nes.PPU.SavePatternTables()
+	filename := nes.ROM.GameName() + "-chr.png"
+
+	if err := nes.SavePatternTables(filename, 0); err != nil {
+		fmt.Printf("*** Error saving pattern tables: %s\n", err)
+		return
+	}
+
+	fmt.Println("*** Saving PPU pattern tables to", filename)
 }
 
 type MuteEvent struct{}
@@ -0,0 +1,263 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Converts the frames of 9-bit pixels the PPU outputs into the images
+// shown by the video backends and saved by the recorders.
+type Filter interface {
+	SetPalette(palette []color.Color)
+	Filter(colors []uint16) *image.RGBA
+}
+
+// Returns the filter with the given name, either none or one of the
+// names in NTSCPresets.  The NTSC filters decode the signal they
+// generate using params.
+func NewFilter(name string, palette []color.Color, params NTSCParams) (filter Filter, err error) {
+	switch name {
+	case "", "none":
+		filter = NewPaletteFilter(palette)
+	default:
+		preset, ok := NTSCPresets[name]
+
+		if !ok {
+			err = errors.New(fmt.Sprintf("Unknown filter '%s'", name))
+			return
+		}
+
+		filter = NewNTSCFilter(preset, palette, params)
+	}
+
+	return
+}
+
+// Looks each pixel up in a palette, giving a 256x240 image.
+type PaletteFilter struct {
+	palette [512]color.RGBA
+}
+
+func NewPaletteFilter(palette []color.Color) *PaletteFilter {
+	filter := &PaletteFilter{}
+	filter.SetPalette(palette)
+
+	return filter
+}
+
+func (filter *PaletteFilter) SetPalette(palette []color.Color) {
+	for i := range filter.palette {
+		filter.palette[i] = color.RGBAModel.Convert(palette[i]).(color.RGBA)
+	}
+}
+
+func (filter *PaletteFilter) Filter(colors []uint16) *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, 256, 240))
+
+	for i, c := range colors {
+		rgba := filter.palette[c]
+		frame.Pix[i*4], frame.Pix[i*4+1], frame.Pix[i*4+2], frame.Pix[i*4+3] = rgba.R, rgba.G, rgba.B, rgba.A
+	}
+
+	return frame
+}
+
+// How the NTSC filter transmits and decodes the video signal.  Luma
+// and chroma are each decoded by averaging a window of samples, 8 per
+// pixel and 12 per colour subcarrier cycle, so narrower windows are
+// sharper but let more of the subcarrier through as dot crawl and
+// wider windows are blurrier.  Luma and chroma share one signal
+// unless Separate is set, so luma edges are also decoded as colour
+// fringes.  RGB skips the signal entirely and only resamples the
+// palette.
+type NTSCPreset struct {
+	LumaWidth   int
+	ChromaWidth int
+	Separate    bool
+	RGB         bool
+}
+
+var NTSCPresets = map[string]NTSCPreset{
+	"ntsc-rf":        {LumaWidth: 4, ChromaWidth: 18},
+	"ntsc-composite": {LumaWidth: 6, ChromaWidth: 12},
+	"ntsc-svideo":    {LumaWidth: 3, ChromaWidth: 12, Separate: true},
+	"ntsc-rgb":       {RGB: true},
+}
+
+const (
+	NTSC_FRAME_WIDTH = 602
+	// samples of the video signal per scanline, 8 per pixel
+	NTSC_SAMPLES = 256 * 8
+	// gamma correction table entries
+	NTSC_GAMMA_LEVELS = 1024
+)
+
+// Generates the composite video signal of the pixels in each frame
+// and decodes it back into a 602x240 image, the width of the
+// subcarrier-aligned output of blargg's nes_ntsc, so that images show
+// the dot crawl, colour fringing and blending of a television.
+type NTSCFilter struct {
+	preset NTSCPreset
+	params NTSCParams
+	frames int
+
+	palette [512]color.RGBA
+	// the signal of each pixel at each phase, and its average
+	signal [512][12]float32
+	luma   [512]float32
+	cos    [12]float32
+	sin    [12]float32
+	gamma  [NTSC_GAMMA_LEVELS]uint8
+
+	// prefix sums of each scanline's luma and demodulated chroma
+	y, i, q [NTSC_SAMPLES + 1]float32
+	windows [NTSC_FRAME_WIDTH]int
+}
+
+func NewNTSCFilter(preset NTSCPreset, palette []color.Color, params NTSCParams) *NTSCFilter {
+	filter := &NTSCFilter{
+		preset: preset,
+		params: params,
+	}
+
+	filter.SetPalette(palette)
+
+	for pixel := range filter.signal {
+		for phase := range filter.signal[pixel] {
+			s := ntscSignal(pixel, phase)
+			filter.signal[pixel][phase] = float32(s)
+			filter.luma[pixel] += float32(s / 12.0)
+		}
+	}
+
+	for phase := range filter.cos {
+		angle := math.Pi * (float64(phase) + 4.0 + params.Hue/30.0) / 6.0
+		filter.cos[phase] = float32(math.Cos(angle) * params.Saturation * 2.0)
+		filter.sin[phase] = float32(math.Sin(angle) * params.Saturation * 2.0)
+	}
+
+	for i := range filter.gamma {
+		filter.gamma[i] = ntscGamma(float64(i)/(NTSC_GAMMA_LEVELS-1), params.Gamma)
+	}
+
+	for x := range filter.windows {
+		filter.windows[x] = (2*x + 1) * NTSC_SAMPLES / (2 * NTSC_FRAME_WIDTH)
+	}
+
+	return filter
+}
+
+func (filter *NTSCFilter) SetPalette(palette []color.Color) {
+	for i := range filter.palette {
+		filter.palette[i] = color.RGBAModel.Convert(palette[i]).(color.RGBA)
+	}
+}
+
+func (filter *NTSCFilter) Filter(colors []uint16) (frame *image.RGBA) {
+	frame = image.NewRGBA(image.Rect(0, 0, NTSC_FRAME_WIDTH, 240))
+
+	if filter.preset.RGB {
+		for y := 0; y < 240; y++ {
+			for x := 0; x < NTSC_FRAME_WIDTH; x++ {
+				rgba := filter.palette[colors[y<<8+x*256/NTSC_FRAME_WIDTH]]
+				o := frame.PixOffset(x, y)
+				frame.Pix[o], frame.Pix[o+1], frame.Pix[o+2], frame.Pix[o+3] = rgba.R, rgba.G, rgba.B, 0xff
+			}
+		}
+
+		return
+	}
+
+	// each scanline starts 4 samples later in the subcarrier's
+	// cycle than the last, and every other frame is a pixel shorter
+	framePhase := (filter.frames & 0x01) * 4
+	filter.frames++
+
+	for y := 0; y < 240; y++ {
+		filter.scanline(colors[y<<8:(y+1)<<8], (y*4+framePhase)%12)
+		filter.decode(frame.Pix[frame.PixOffset(0, y):])
+	}
+
+	return
+}
+
+// Generates the signal for a scanline of pixels and sums it into the
+// luma and demodulated chroma prefix sums.
+func (filter *NTSCFilter) scanline(pixels []uint16, phase int) {
+	var y, i, q float32
+
+	k := 0
+
+	for _, pixel := range pixels {
+		signal := &filter.signal[pixel]
+		luma := filter.luma[pixel]
+
+		for n := 0; n < 8; n++ {
+			s := signal[phase]
+			c := s
+
+			if filter.preset.Separate {
+				c -= luma
+				s = luma
+			}
+
+			y += s
+			i += c * filter.cos[phase]
+			q += c * filter.sin[phase]
+
+			k++
+			filter.y[k], filter.i[k], filter.q[k] = y, i, q
+
+			if phase++; phase == 12 {
+				phase = 0
+			}
+		}
+	}
+}
+
+// Decodes a scanline from the prefix sums into RGBA pixels.
+func (filter *NTSCFilter) decode(pix []uint8) {
+	lumaWidth, chromaWidth := filter.preset.LumaWidth, filter.preset.ChromaWidth
+	contrast, brightness := float32(filter.params.Contrast), float32(filter.params.Brightness)
+
+	for x, centre := range filter.windows {
+		y := window(&filter.y, centre, lumaWidth)*contrast + brightness
+		i := window(&filter.i, centre, chromaWidth)
+		q := window(&filter.q, centre, chromaWidth)
+
+		pix[x*4] = filter.correct(y + 0.946882*i + 0.623557*q)
+		pix[x*4+1] = filter.correct(y - 0.274788*i - 0.635691*q)
+		pix[x*4+2] = filter.correct(y - 1.108545*i + 1.709007*q)
+		pix[x*4+3] = 0xff
+	}
+}
+
+// Returns the average of the samples in a window of the given width
+// around centre.
+func window(sums *[NTSC_SAMPLES + 1]float32, centre, width int) float32 {
+	start, end := centre-width/2, centre-width/2+width
+
+	if start < 0 {
+		start = 0
+	}
+
+	if end > NTSC_SAMPLES {
+		end = NTSC_SAMPLES
+	}
+
+	return (sums[end] - sums[start]) / float32(end-start)
+}
+
+func (filter *NTSCFilter) correct(value float32) uint8 {
+	switch {
+	case value <= 0.0:
+		return 0
+	case value >= 1.0:
+		return filter.gamma[NTSC_GAMMA_LEVELS-1]
+	}
+
+	return filter.gamma[int(value*(NTSC_GAMMA_LEVELS-1))]
+}
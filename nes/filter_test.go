@@ -0,0 +1,121 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solidFrame(pixel uint16) (colors []uint16) {
+	colors = make([]uint16, 0xf000)
+
+	for i := range colors {
+		colors[i] = pixel
+	}
+
+	return
+}
+
+func TestPaletteFilter(t *testing.T) {
+	colors := solidFrame(0x16)
+	colors[0x0101] = 0x1a
+
+	frame := NewPaletteFilter(EmphasisPalette).Filter(colors)
+
+	if frame.Bounds() != image.Rect(0, 0, 256, 240) {
+		t.Fatalf("Frame is %v, expected 256x240", frame.Bounds())
+	}
+
+	if c := frame.At(1, 1); c != EmphasisPalette[0x1a] {
+		t.Errorf("Pixel is %v, expected %v", c, EmphasisPalette[0x1a])
+	}
+
+	if c := frame.At(2, 1); c != EmphasisPalette[0x16] {
+		t.Errorf("Pixel is %v, expected %v", c, EmphasisPalette[0x16])
+	}
+}
+
+func TestNTSCFilter(t *testing.T) {
+	palette := NTSCPalette(DefaultNTSCParams)
+
+	near := func(a, b color.Color) bool {
+		ar, ag, ab, _ := a.RGBA()
+		br, bg, bb, _ := b.RGBA()
+
+		for _, d := range []int{int(ar>>8) - int(br>>8), int(ag>>8) - int(bg>>8), int(ab>>8) - int(bb>>8)} {
+			if d < -3 || d > 3 {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	for _, pixel := range []uint16{0x16, 0x2a, 0x0f, 0x30, 0x92} {
+		filter, _ := NewFilter("ntsc-svideo", EmphasisPalette, DefaultNTSCParams)
+		frame := filter.Filter(solidFrame(pixel))
+
+		if frame.Bounds() != image.Rect(0, 0, NTSC_FRAME_WIDTH, 240) {
+			t.Fatalf("Frame is %v, expected %vx240", frame.Bounds(), NTSC_FRAME_WIDTH)
+		}
+
+		// solid areas decode to the colours of the NTSC palette
+		if c := frame.At(300, 120); !near(c, palette[pixel]) {
+			t.Errorf("Pixel %03X is %v, expected %v", pixel, c, palette[pixel])
+		}
+	}
+
+	// composite video crawls from frame to frame
+	filter, _ := NewFilter("ntsc-composite", EmphasisPalette, DefaultNTSCParams)
+	colors := solidFrame(0x16)
+
+	first, second := filter.Filter(colors), filter.Filter(colors)
+
+	if first.At(300, 120) == second.At(300, 120) {
+		t.Error("Consecutive composite frames are identical, expected dot crawl")
+	}
+
+	filter, _ = NewFilter("ntsc-rgb", EmphasisPalette, DefaultNTSCParams)
+
+	if c := filter.Filter(colors).At(601, 239); c != EmphasisPalette[0x16] {
+		t.Errorf("RGB pixel is %v, expected %v", c, EmphasisPalette[0x16])
+	}
+
+	if _, err := NewFilter("ntsc-vhs", EmphasisPalette, DefaultNTSCParams); err == nil {
+		t.Error("No error creating unknown filter")
+	}
+}
+
+func benchmarkFilter(b *testing.B, name string) {
+	filter, err := NewFilter(name, EmphasisPalette, DefaultNTSCParams)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	colors := make([]uint16, 0xf000)
+
+	for i := range colors {
+		colors[i] = uint16(i*7) & 0x1ff
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		filter.Filter(colors)
+	}
+}
+
+func BenchmarkPaletteFilter(b *testing.B) {
+	benchmarkFilter(b, "none")
+}
+
+// A frame must take well under 1/60th of a second, 16.7ms, to keep up
+// with the emulator on one core.
+func BenchmarkNTSCCompositeFilter(b *testing.B) {
+	benchmarkFilter(b, "ntsc-composite")
+}
+
+func BenchmarkNTSCSVideoFilter(b *testing.B) {
+	benchmarkFilter(b, "ntsc-svideo")
+}
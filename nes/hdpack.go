@@ -0,0 +1,523 @@
+package nes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nwidger/nintengo/rp2cgo2"
+)
+
+// The name of an HD pack's definition file inside its directory.
+const HD_PACK_FILENAME = "hires.txt"
+
+// A condition a replacement tile can be made to depend on, checked
+// once per frame.  Only Mesen's memoryCheck and memoryCheckConstant
+// types are supported, conditions of other types never hold.
+type hdCondition struct {
+	Name     string
+	Type     string
+	Address  uint16
+	Operator string
+	// the value compared against for memoryCheckConstant or the
+	// second address for memoryCheck
+	Operand uint16
+	Mask    uint8
+}
+
+// A replacement for an 8x8 tile, Scale times the size, drawn while
+// its conditions hold.
+type hdTile struct {
+	Image      *image.RGBA
+	X, Y       int
+	Brightness float64
+	Conditions []string
+	Negated    []bool
+}
+
+type hdTileKey struct {
+	Key     uint32
+	Palette uint32
+}
+
+// An HD pack in the hires.txt format of Mesen's HD packs, replacing
+// 8x8 tiles with PNG art Scale times their size.  Tiles are matched
+// by their CHR ROM tile number or, for games with CHR RAM, their
+// pattern data, and by the 4 colours of the palette they are drawn
+// with.  Only <ver>, <scale>, <img>, <condition> and <tile> lines are
+// used, others are ignored.
+type HDPack struct {
+	Scale int
+
+	rom    ROM
+	chr    func(address uint16) uint8
+	memory func(address uint16) uint8
+
+	images     []*image.RGBA
+	conditions map[string]*hdCondition
+	tiles      map[hdTileKey][]*hdTile
+	// tiles drawn with any palette that has no tile of its own
+	defaults map[uint32][]*hdTile
+}
+
+// Loads the HD pack in directory dir for rom.  Tiles with CHR RAM are
+// read with chr and conditions are checked against memory.
+func LoadHDPack(dir string, rom ROM, chr, memory func(address uint16) uint8) (pack *HDPack, err error) {
+	var f *os.File
+
+	pack = &HDPack{
+		Scale:      1,
+		rom:        rom,
+		chr:        chr,
+		memory:     memory,
+		conditions: make(map[string]*hdCondition),
+		tiles:      make(map[hdTileKey][]*hdTile),
+		defaults:   make(map[uint32][]*hdTile),
+	}
+
+	if f, err = os.Open(filepath.Join(dir, HD_PACK_FILENAME)); err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for line := 1; scanner.Scan(); line++ {
+		if err = pack.parseLine(dir, strings.TrimSpace(scanner.Text())); err != nil {
+			err = errors.New(fmt.Sprintf("%s line %d: %v", HD_PACK_FILENAME, line, err))
+			return
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	for _, tiles := range pack.tiles {
+		if err = pack.checkConditions(tiles); err != nil {
+			return
+		}
+	}
+
+	for _, tiles := range pack.defaults {
+		if err = pack.checkConditions(tiles); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (pack *HDPack) checkConditions(tiles []*hdTile) error {
+	for _, tile := range tiles {
+		for _, name := range tile.Conditions {
+			if _, ok := pack.conditions[name]; !ok {
+				return errors.New(fmt.Sprintf("Unknown condition '%s'", name))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (pack *HDPack) parseLine(dir, line string) (err error) {
+	var conditions []string
+
+	if strings.HasPrefix(line, "[") {
+		end := strings.Index(line, "]")
+
+		if end < 0 {
+			return errors.New("Missing ']'")
+		}
+
+		conditions = strings.Split(line[1:end], "&")
+		line = line[end+1:]
+	}
+
+	if !strings.HasPrefix(line, "<") {
+		return
+	}
+
+	end := strings.Index(line, ">")
+
+	if end < 0 {
+		return errors.New("Missing '>'")
+	}
+
+	tag, value := line[1:end], line[end+1:]
+
+	switch tag {
+	case "scale":
+		if pack.Scale, err = strconv.Atoi(value); err == nil && pack.Scale < 1 {
+			err = errors.New(fmt.Sprintf("Invalid scale %v", pack.Scale))
+		}
+	case "img":
+		var img *image.RGBA
+
+		if img, err = loadHDImage(filepath.Join(dir, value)); err == nil {
+			pack.images = append(pack.images, img)
+		}
+	case "condition":
+		err = pack.parseCondition(strings.Split(value, ","))
+	case "tile":
+		err = pack.parseTile(strings.Split(value, ","), conditions)
+	}
+
+	return
+}
+
+func loadHDImage(filename string) (rgba *image.RGBA, err error) {
+	var f *os.File
+	var img image.Image
+
+	if f, err = os.Open(filename); err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	if img, _, err = image.Decode(f); err != nil {
+		return
+	}
+
+	bounds := img.Bounds()
+	rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	return
+}
+
+// Parses a hexadecimal number, which may start with $ or 0x.
+func parseHDHex(s string, bits int) (uint64, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "$"), "0x")
+	return strconv.ParseUint(s, 16, bits)
+}
+
+// <condition>name,type,address,operator,operand[,mask]
+func (pack *HDPack) parseCondition(fields []string) (err error) {
+	var address, operand, mask uint64
+
+	if len(fields) < 2 {
+		return errors.New("Condition needs a name and a type")
+	}
+
+	condition := &hdCondition{
+		Name: fields[0],
+		Type: fields[1],
+		Mask: 0xff,
+	}
+
+	switch condition.Type {
+	case "memoryCheck", "memoryCheckConstant":
+		if len(fields) < 5 {
+			return errors.New(fmt.Sprintf("Condition '%s' needs an address, an operator and an operand", condition.Name))
+		}
+
+		if address, err = parseHDHex(fields[2], 16); err != nil {
+			return
+		}
+
+		if operand, err = parseHDHex(fields[4], 16); err != nil {
+			return
+		}
+
+		if len(fields) > 5 {
+			if mask, err = parseHDHex(fields[5], 8); err != nil {
+				return
+			}
+
+			condition.Mask = uint8(mask)
+		}
+
+		switch fields[3] {
+		case "==", "!=", ">", "<", ">=", "<=":
+		default:
+			return errors.New(fmt.Sprintf("Unknown operator '%s'", fields[3]))
+		}
+
+		condition.Address = uint16(address)
+		condition.Operator = fields[3]
+		condition.Operand = uint16(operand)
+	}
+
+	pack.conditions[condition.Name] = condition
+
+	return
+}
+
+// <tile>image,tile,palette,x,y[,brightness[,default]]
+func (pack *HDPack) parseTile(fields []string, conditions []string) (err error) {
+	var index, x, y int
+	var palette uint64
+	var key uint32
+
+	if len(fields) < 5 {
+		return errors.New("Tile needs an image, a tile, a palette and a position")
+	}
+
+	if index, err = strconv.Atoi(fields[0]); err != nil {
+		return
+	}
+
+	if index < 0 || index >= len(pack.images) {
+		return errors.New(fmt.Sprintf("Unknown image %v", index))
+	}
+
+	if key, err = parseHDTileKey(fields[1]); err != nil {
+		return
+	}
+
+	if palette, err = parseHDHex(fields[2], 32); err != nil {
+		return
+	}
+
+	if x, err = strconv.Atoi(fields[3]); err != nil {
+		return
+	}
+
+	if y, err = strconv.Atoi(fields[4]); err != nil {
+		return
+	}
+
+	tile := &hdTile{
+		Image:      pack.images[index],
+		X:          x,
+		Y:          y,
+		Brightness: 1.0,
+	}
+
+	if !image.Rect(x, y, x+8*pack.Scale, y+8*pack.Scale).In(tile.Image.Bounds()) {
+		return errors.New(fmt.Sprintf("Tile at (%v, %v) is outside image %v", x, y, index))
+	}
+
+	if len(fields) > 5 {
+		if tile.Brightness, err = strconv.ParseFloat(fields[5], 64); err != nil {
+			return
+		}
+	}
+
+	for _, name := range conditions {
+		negated := strings.HasPrefix(name, "!")
+
+		tile.Conditions = append(tile.Conditions, strings.TrimPrefix(name, "!"))
+		tile.Negated = append(tile.Negated, negated)
+	}
+
+	k := hdTileKey{Key: key, Palette: uint32(palette)}
+	pack.tiles[k] = addHDTile(pack.tiles[k], tile)
+
+	if len(fields) > 6 && strings.ToUpper(fields[6]) == "Y" {
+		pack.defaults[key] = addHDTile(pack.defaults[key], tile)
+	}
+
+	return
+}
+
+// Adds tile to tiles, keeping tiles with conditions before those
+// without so that they are tried first.
+func addHDTile(tiles []*hdTile, tile *hdTile) []*hdTile {
+	i := len(tiles)
+
+	if len(tile.Conditions) > 0 {
+		for i > 0 && len(tiles[i-1].Conditions) == 0 {
+			i--
+		}
+	}
+
+	tiles = append(tiles, nil)
+	copy(tiles[i+1:], tiles[i:])
+	tiles[i] = tile
+
+	return tiles
+}
+
+// Parses a tile as either its decimal tile number in CHR ROM or its
+// 16 bytes of pattern data in hexadecimal.
+func parseHDTileKey(s string) (key uint32, err error) {
+	var n int
+	var data []uint8
+
+	if len(s) != 32 {
+		n, err = strconv.Atoi(s)
+		key = uint32(n)
+		return
+	}
+
+	for i := 0; i < 32; i += 2 {
+		var b uint64
+
+		if b, err = strconv.ParseUint(s[i:i+2], 16, 8); err != nil {
+			return
+		}
+
+		data = append(data, uint8(b))
+	}
+
+	key = hdPatternKey(data)
+
+	return
+}
+
+func hdPatternKey(data []uint8) uint32 {
+	h := fnv.New32a()
+	h.Write(data)
+
+	return h.Sum32()
+}
+
+// Returns the key the tile at address in the pattern tables is
+// matched with, for RP2C02.TileKey.
+func (pack *HDPack) TileKey(address uint16) uint32 {
+	var data [16]uint8
+
+	if offset := pack.rom.CHROffset(address); offset >= 0 {
+		return uint32(offset / 16)
+	}
+
+	for i := range data {
+		data[i] = pack.chr(address + uint16(i))
+	}
+
+	return hdPatternKey(data[:])
+}
+
+func (condition *hdCondition) holds(memory func(address uint16) uint8) bool {
+	var a, b uint8
+
+	switch condition.Type {
+	case "memoryCheck":
+		a, b = memory(condition.Address), memory(condition.Operand)
+	case "memoryCheckConstant":
+		a, b = memory(condition.Address), uint8(condition.Operand)
+	default:
+		return false
+	}
+
+	a &= condition.Mask
+	b &= condition.Mask
+
+	switch condition.Operator {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	}
+
+	return false
+}
+
+// Returns the replacement for the tile a pixel is drawn from, or nil.
+func (pack *HDPack) match(pt *rp2cgo2.PixelTile, held map[string]bool) *hdTile {
+	if !pt.Background && !pt.Sprite {
+		return nil
+	}
+
+	for _, tiles := range [][]*hdTile{pack.tiles[hdTileKey{Key: pt.Key, Palette: pt.Palette}], pack.defaults[pt.Key]} {
+	tile:
+		for _, tile := range tiles {
+			for i, name := range tile.Conditions {
+				if held[name] == tile.Negated[i] {
+					continue tile
+				}
+			}
+
+			return tile
+		}
+	}
+
+	return nil
+}
+
+// Returns frame Scale times larger with each pixel drawn from a tile
+// the pack replaces taken from its replacement, blended over the
+// pixel by the replacement's alpha.  tiles are the tiles the pixels
+// of the 256x240 picture frame was filtered from were drawn from.
+func (pack *HDPack) Compose(frame *image.RGBA, tiles []rp2cgo2.PixelTile) *image.RGBA {
+	scale := pack.Scale
+	bounds := frame.Bounds()
+	composed := image.NewRGBA(image.Rect(0, 0, 256*scale, 240*scale))
+
+	held := make(map[string]bool)
+
+	for name, condition := range pack.conditions {
+		held[name] = condition.holds(pack.memory)
+	}
+
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 256; x++ {
+			var tile *hdTile
+			var pt *rp2cgo2.PixelTile
+
+			if len(tiles) == 256*240 {
+				pt = &tiles[y<<8|x]
+				tile = pack.match(pt, held)
+			}
+
+			base := frame.RGBAAt(bounds.Min.X+x*bounds.Dx()/256, bounds.Min.Y+y*bounds.Dy()/240)
+
+			for sy := 0; sy < scale; sy++ {
+				for sx := 0; sx < scale; sx++ {
+					c := base
+
+					if tile != nil {
+						u, v := sx, sy
+
+						if pt.HFlip {
+							u = scale - 1 - u
+						}
+
+						if pt.VFlip {
+							v = scale - 1 - v
+						}
+
+						hd := tile.Image.RGBAAt(tile.X+int(pt.Column)*scale+u, tile.Y+int(pt.Row)*scale+v)
+						c = blendHD(hd, base, tile.Brightness)
+					}
+
+					composed.SetRGBA(x*scale+sx, y*scale+sy, c)
+				}
+			}
+		}
+	}
+
+	return composed
+}
+
+// Blends the premultiplied colour hd, scaled by brightness, over
+// base.
+func blendHD(hd, base color.RGBA, brightness float64) color.RGBA {
+	channel := func(h, b uint8) uint8 {
+		v := float64(h)*brightness + float64(b)*float64(255-hd.A)/255.0
+
+		if v > 255.0 {
+			v = 255.0
+		}
+
+		return uint8(v)
+	}
+
+	return color.RGBA{
+		R: channel(hd.R, base.R),
+		G: channel(hd.G, base.G),
+		B: channel(hd.B, base.B),
+		A: 0xff,
+	}
+}
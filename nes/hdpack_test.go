@@ -0,0 +1,185 @@
+package nes
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nwidger/nintengo/rp2cgo2"
+)
+
+func TestHDPack(t *testing.T) {
+	for _, filename := range []string{
+		// CHR ROM, matched by tile number
+		"../samples/nes15-1.0.0/nes15-NTSC.nes",
+		// CHR RAM, matched by pattern data
+		"../samples/cpu_timing_test6/cpu_timing_test.nes",
+	} {
+		testHDPack(t, filename)
+	}
+}
+
+// Runs filename with an HD pack replacing the first background tile
+// it draws and checks the tile is replaced in the composed frame.
+func testHDPack(t *testing.T, filename string) {
+	var pt *rp2cgo2.PixelTile
+	var x, y int
+
+	dir, err := ioutil.TempDir("", "hdpack")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	// run once with an empty pack to find a background tile and
+	// the pack's key for it
+	writeHDPack(t, dir, "")
+
+	nes, pack := newTestHDPackNES(t, filename, dir)
+	colors := runTestFrames(t, nes, 60)
+
+	// skip the first scanline, which the PPU may have started
+	// drawing again, and blank pixels, which may be from a blank tile
+	for i := 256; i < len(nes.PPU.Tiles); i++ {
+		if tile := nes.PPU.Tiles[i]; tile.Background && colors[i]&0x3f != uint16(tile.Palette>>24)&0x3f {
+			pt, x, y = &nes.PPU.Tiles[i], i&0xff, i>>8
+			break
+		}
+	}
+
+	if pt == nil {
+		t.Fatalf("%v drew no background", filename)
+	}
+
+	key := ""
+
+	for address := uint16(0x0000); address < 0x2000 && key == ""; address += 16 {
+		if pack.TileKey(address) != pt.Key {
+			continue
+		}
+
+		if offset := nes.ROM.CHROffset(address); offset >= 0 {
+			key = fmt.Sprintf("%d", offset/16)
+			continue
+		}
+
+		for i := uint16(0); i < 16; i++ {
+			key += fmt.Sprintf("%02X", nes.PPU.Memory.Peek(address+i))
+		}
+	}
+
+	if key == "" {
+		t.Fatalf("%v drew a tile not in its pattern tables", filename)
+	}
+
+	// the replacement is a gradient to the left of a solid green
+	// tile that is never drawn
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+
+	for v := 0; v < 16; v++ {
+		for u := 0; u < 16; u++ {
+			img.SetRGBA(u, v, color.RGBA{uint8(u * 16), uint8(v * 16), 0xff, 0xff})
+			img.SetRGBA(16+u, v, color.RGBA{0x00, 0xff, 0x00, 0xff})
+		}
+	}
+
+	writePNG(t, filepath.Join(dir, "tiles.png"), img)
+
+	writeHDPack(t, dir, fmt.Sprintf("<img>tiles.png\n"+
+		"<condition>always,memoryCheck,0000,==,0000\n"+
+		"[!always]<tile>0,%s,%08X,16,0,1,N\n"+
+		"<tile>0,%s,%08X,0,0,1,N\n", key, pt.Palette, key, pt.Palette))
+
+	// then run again with the pack replacing the tile
+	nes, pack = newTestHDPackNES(t, filename, dir)
+	colors = runTestFrames(t, nes, 60)
+
+	if tile := nes.PPU.Tiles[y*256+x]; tile != *pt {
+		t.Fatalf("%v drew %+v at (%v, %v) not %+v", filename, tile, x, y, *pt)
+	}
+
+	frame := NewPaletteFilter(EmphasisPalette).Filter(colors)
+	composedFilename := filepath.Join(dir, "frame.png")
+
+	writePNG(t, composedFilename, pack.Compose(frame, nes.PPU.Tiles))
+
+	f, err := os.Open(composedFilename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	composed, err := png.Decode(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bounds := composed.Bounds(); bounds.Dx() != 512 || bounds.Dy() != 480 {
+		t.Fatalf("Composed frame is %vx%v not 512x480", bounds.Dx(), bounds.Dy())
+	}
+
+	for v := 0; v < 2; v++ {
+		for u := 0; u < 2; u++ {
+			expected := color.RGBA{uint8((int(pt.Column)*2 + u) * 16), uint8((int(pt.Row)*2 + v) * 16), 0xff, 0xff}
+
+			if c := color.RGBAModel.Convert(composed.At(x*2+u, y*2+v)); c != expected {
+				t.Errorf("%v pixel (%v, %v) is %v not %v", filename, x*2+u, y*2+v, c, expected)
+			}
+		}
+	}
+
+	// pixels drawn from other tiles are only scaled
+	for i := 256; i < len(nes.PPU.Tiles); i++ {
+		if tile := nes.PPU.Tiles[i]; tile.Key != pt.Key || tile.Palette != pt.Palette || !tile.Background {
+			expected := frame.At(i&0xff, i>>8)
+
+			if c := color.RGBAModel.Convert(composed.At((i&0xff)*2+1, (i>>8)*2+1)); c != expected {
+				t.Errorf("%v pixel (%v, %v) is %v not %v", filename, i&0xff, i>>8, c, expected)
+			}
+
+			break
+		}
+	}
+}
+
+// Returns an NES running filename with the HD pack in dir loaded as
+// NewNES loads it.
+func newTestHDPackNES(t *testing.T, filename, dir string) (nes *NES, pack *HDPack) {
+	nes = newTestNESWithOptions(t, filename, &Options{HDPack: dir})
+	pack = nes.hdpack
+
+	return
+}
+
+// Writes an HD pack at scale 2 with the given lines to dir.
+func writeHDPack(t *testing.T, dir, lines string) {
+	hires := "<ver>106\n<scale>2\n" + lines
+
+	if err := ioutil.WriteFile(filepath.Join(dir, HD_PACK_FILENAME), []byte(hires), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePNG(t *testing.T, filename string, img image.Image) {
+	f, err := os.Create(filename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if err = png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
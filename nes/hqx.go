@@ -0,0 +1,410 @@
+package nes
+
+import "image"
+
+// hqNx's rules and blends are given for the top left corner of a pixel
+// and rotated clockwise a quarter turn at a time for the top right,
+// bottom right and bottom left corners.  Its patterns have a bit set
+// for each neighbour whose colour differs from the pixel's, in this
+// order from the least significant bit.
+var hqxOffsets = [8][2]int{
+	{-1, -1}, {0, -1}, {1, -1},
+	{-1, 0}, {1, 0},
+	{-1, 1}, {0, 1}, {1, 1},
+}
+
+// The blends of hqNx, numbered as in hq2x for the top left subpixel.
+// Each mixes the pixel with its top left corner, left and top
+// neighbours.
+const (
+	hqx0      = iota // the pixel
+	hqx10            // 3:1 with the corner
+	hqx11            // 3:1 with the left
+	hqx12            // 3:1 with the top
+	hqx20            // 2:1:1 with the left and top
+	hqx21            // 2:1:1 with the corner and top
+	hqx22            // 2:1:1 with the corner and left
+	hqx60            // 5:2:1 with the top and left
+	hqx61            // 5:2:1 with the left and top
+	hqx70            // 6:1:1 with the left and top
+	hqx90Left        // 2:3:3 with the left and top, along a line to the left
+	hqx90Top         // 2:3:3 with the left and top, along a line to the top
+	hqx100           // 14:1:1 with the left and top
+	hqxFill          // hqx20 filling in the corner of an edge
+	hqxBlends
+)
+
+// The neighbours whose colours a rule compares before it applies.
+const (
+	hqxAlways   = iota
+	hqxOwn      // the left and top
+	hqxNext     // the top and right, those of the top right corner
+	hqxPrevious // the bottom and left, those of the bottom left corner
+)
+
+// A corner's blend for a pattern, differ if its condition's
+// neighbours differ and same otherwise.
+type hqxRule struct {
+	cond         int
+	differ, same int
+}
+
+// hq2x's rules for the top left subpixel in the order they are tried.
+// A rule applies to the patterns in which the neighbours of each mask
+// differ exactly where those of its value do.  A rule with a
+// condition applies only when its neighbours differ, otherwise the
+// next rule without one that matches does, and patterns no rule
+// matches are blended with hqx70.
+var hqxPatterns = []struct {
+	cond     int
+	blend    int
+	patterns [][2]uint8
+}{
+	{hqxNext, hqx11, [][2]uint8{{0xbf, 0x37}, {0xdb, 0x13}}},
+	{hqxPrevious, hqx12, [][2]uint8{{0xdb, 0x49}, {0xef, 0x6d}}},
+	{hqxOwn, hqx0, [][2]uint8{{0x0b, 0x0b}, {0xfe, 0x4a}, {0xfe, 0x1a}}},
+	{hqxOwn, hqx10, [][2]uint8{
+		{0x6f, 0x2a}, {0x5b, 0x0a}, {0xbf, 0x3a}, {0xdf, 0x5a}, {0x9f, 0x8a},
+		{0xcf, 0x8a}, {0xef, 0x4e}, {0x3f, 0x0e}, {0xfb, 0x5a}, {0xbb, 0x8a},
+		{0x7f, 0x5a}, {0xaf, 0x8a}, {0xeb, 0x8a},
+	}},
+	{hqxAlways, hqx21, [][2]uint8{{0x0b, 0x08}}},
+	{hqxAlways, hqx22, [][2]uint8{{0x0b, 0x02}}},
+	{hqxAlways, hqx100, [][2]uint8{{0x2f, 0x2f}}},
+	{hqxAlways, hqx60, [][2]uint8{{0xbf, 0x37}, {0xdb, 0x13}}},
+	{hqxAlways, hqx61, [][2]uint8{{0xdb, 0x49}, {0xef, 0x6d}}},
+	{hqxAlways, hqx11, [][2]uint8{{0x1b, 0x03}, {0x4f, 0x43}, {0x8b, 0x83}, {0x6b, 0x43}}},
+	{hqxAlways, hqx12, [][2]uint8{{0x4b, 0x09}, {0x8b, 0x89}, {0x1f, 0x19}, {0x3b, 0x19}}},
+	{hqxAlways, hqx90Left, [][2]uint8{{0x7e, 0x2a}, {0xef, 0xab}, {0xbf, 0x8f}, {0x7e, 0x0e}}},
+	{hqxAlways, hqx10, [][2]uint8{
+		{0xfb, 0x6a}, {0x6f, 0x6e}, {0x3f, 0x3e}, {0xfb, 0xfa}, {0xdf, 0xde},
+		{0xdf, 0x1e},
+	}},
+	{hqxAlways, hqx20, [][2]uint8{
+		{0x0a, 0x00}, {0x4f, 0x4b}, {0x9f, 0x1b}, {0x2f, 0x0b}, {0xbe, 0x0a},
+		{0xee, 0x0a}, {0x7e, 0x0a}, {0xeb, 0x4b}, {0x3b, 0x1b},
+	}},
+}
+
+// The weights in 16ths of the pixel, corner, left and top of each
+// blend: of the subpixel at 2x, of the corner subpixel at 3x and of
+// the outer, top, left and inner subpixels of the corner at 4x.
+type hqxWeights [4]uint32
+
+var hqxWeights2x = [hqxBlends]hqxWeights{
+	hqx0:      {16, 0, 0, 0},
+	hqx10:     {12, 4, 0, 0},
+	hqx11:     {12, 0, 4, 0},
+	hqx12:     {12, 0, 0, 4},
+	hqx20:     {8, 0, 4, 4},
+	hqx21:     {8, 4, 0, 4},
+	hqx22:     {8, 4, 4, 0},
+	hqx60:     {10, 0, 2, 4},
+	hqx61:     {10, 0, 4, 2},
+	hqx70:     {12, 0, 2, 2},
+	hqx90Left: {4, 0, 6, 6},
+	hqx90Top:  {4, 0, 6, 6},
+	hqx100:    {14, 0, 1, 1},
+	hqxFill:   {8, 0, 4, 4},
+}
+
+var hqxWeights3x = [hqxBlends]hqxWeights{
+	hqx0:      {16, 0, 0, 0},
+	hqx10:     {12, 4, 0, 0},
+	hqx11:     {12, 0, 4, 0},
+	hqx12:     {12, 0, 0, 4},
+	hqx20:     {8, 0, 4, 4},
+	hqx21:     {12, 4, 0, 0},
+	hqx22:     {12, 4, 0, 0},
+	hqx60:     {8, 0, 4, 4},
+	hqx61:     {8, 0, 4, 4},
+	hqx70:     {8, 0, 4, 4},
+	hqx90Left: {0, 0, 8, 8},
+	hqx90Top:  {0, 0, 8, 8},
+	hqx100:    {8, 0, 4, 4},
+	hqxFill:   {2, 0, 7, 7},
+}
+
+var hqxWeights4x = [hqxBlends][4]hqxWeights{
+	hqx0:      {{16, 0, 0, 0}, {16, 0, 0, 0}, {16, 0, 0, 0}, {16, 0, 0, 0}},
+	hqx10:     {{10, 6, 0, 0}, {12, 4, 0, 0}, {12, 4, 0, 0}, {14, 2, 0, 0}},
+	hqx11:     {{10, 0, 6, 0}, {14, 0, 2, 0}, {10, 0, 6, 0}, {14, 0, 2, 0}},
+	hqx12:     {{10, 0, 0, 6}, {10, 0, 0, 6}, {14, 0, 0, 2}, {14, 0, 0, 2}},
+	hqx20:     {{8, 0, 4, 4}, {10, 0, 2, 4}, {10, 0, 4, 2}, {12, 0, 2, 2}},
+	hqx21:     {{10, 6, 0, 0}, {10, 2, 0, 4}, {12, 4, 0, 0}, {14, 2, 0, 0}},
+	hqx22:     {{10, 6, 0, 0}, {12, 4, 0, 0}, {10, 2, 4, 0}, {14, 2, 0, 0}},
+	hqx60:     {{12, 0, 0, 4}, {4, 0, 0, 12}, {10, 0, 6, 0}, {14, 0, 2, 0}},
+	hqx61:     {{12, 0, 4, 0}, {10, 0, 0, 6}, {4, 0, 12, 0}, {14, 0, 0, 2}},
+	hqx70:     {{8, 0, 4, 4}, {12, 0, 0, 4}, {12, 0, 4, 0}, {16, 0, 0, 0}},
+	hqx90Left: {{0, 0, 8, 8}, {4, 0, 4, 8}, {0, 0, 10, 6}, {12, 0, 2, 2}},
+	hqx90Top:  {{0, 0, 8, 8}, {0, 0, 6, 10}, {4, 0, 8, 4}, {12, 0, 2, 2}},
+	hqx100:    {{8, 0, 4, 4}, {16, 0, 0, 0}, {16, 0, 0, 0}, {16, 0, 0, 0}},
+	hqxFill:   {{0, 0, 8, 8}, {8, 0, 0, 8}, {8, 0, 8, 0}, {16, 0, 0, 0}},
+}
+
+// The rule of the top left corner for each pattern.
+var hqxRules [256]hqxRule
+
+// The neighbours of each corner in the order of a pattern's bits for
+// the top left corner, as indices into hqxOffsets, and each pattern as
+// seen from each corner.
+var hqxRotations [4][8]uint
+var hqxRotated [4][256]int
+
+func init() {
+	for r := range hqxRotations {
+		for i, o := range hqxOffsets {
+			x, y := o[0], o[1]
+
+			for n := 0; n < r; n++ {
+				x, y = -y, x
+			}
+
+			for j, p := range hqxOffsets {
+				if p[0] == x && p[1] == y {
+					hqxRotations[r][i] = uint(j)
+				}
+			}
+		}
+	}
+
+	for r := range hqxRotated {
+		for k := range hqxRotated[r] {
+			for i, j := range hqxRotations[r] {
+				if k&(1<<j) != 0 {
+					hqxRotated[r][k] |= 1 << uint(i)
+				}
+			}
+		}
+	}
+
+	for k := range hqxRules {
+		rule := hqxRule{hqxAlways, hqx70, hqx70}
+		matched := false
+
+		for _, p := range hqxPatterns {
+			matches := false
+
+			for _, pattern := range p.patterns {
+				if uint8(k)&pattern[0] == pattern[1] {
+					matches = true
+				}
+			}
+
+			if !matches || (matched && p.cond != hqxAlways) {
+				continue
+			}
+
+			if !matched {
+				rule.cond, rule.differ = p.cond, p.blend
+				matched = true
+			}
+
+			if p.cond == hqxAlways {
+				rule.same = p.blend
+
+				if rule.cond == hqxAlways {
+					rule.differ = p.blend
+				}
+
+				break
+			}
+		}
+
+		// the pixel or its corner where the edge is sharp, and the
+		// corner filled in otherwise
+		if rule.cond == hqxOwn && rule.same == hqx20 {
+			rule.same = hqxFill
+		}
+
+		hqxRules[k] = rule
+	}
+
+	// a line along hqx90 continues to the corner whose rule compares
+	// this corner's neighbours
+	for k := range hqxRules {
+		if hqxRules[k].same == hqx90Left && hqxRules[hqxRotated[1][k]].cond == hqxPrevious {
+			hqxRules[k].same = hqx90Top
+		}
+	}
+}
+
+// Returns x, y within the top left corner of an n by n block of
+// subpixels rotated clockwise to corner r.
+func hqxSubpixel(x, y, n, r int) (int, int) {
+	for ; r > 0; r-- {
+		x, y = n-1-y, x
+	}
+
+	return x, y
+}
+
+// Returns the colors mixed with weights, in 16ths.
+func blendPixels(colors *[4]uint32, weights *hqxWeights) uint32 {
+	var rb, ga uint32
+
+	for i, c := range colors {
+		rb += (c & 0x00ff00ff) * weights[i]
+		ga += ((c >> 8) & 0x00ff00ff) * weights[i]
+	}
+
+	return (rb>>4)&0x00ff00ff | (ga<<4)&0xff00ff00
+}
+
+// Returns the weight of the neighbour in an edge subpixel at 3x claimed
+// by a corner's rule and the blend it took, or false if the rule
+// leaves it alone.  Toward is hqx90Left for the corner's left edge and
+// hqx90Top for its top edge.
+func hqxEdge(rule hqxRule, blend, toward int) (weight uint32, claimed bool) {
+	switch rule.same {
+	case hqxFill:
+		if blend == hqxFill {
+			weight = 2
+		}
+	case hqx90Left, hqx90Top:
+		if blend != rule.same {
+			break
+		}
+
+		// more strongly along the line
+		if rule.same == toward {
+			weight = 12
+		} else {
+			weight = 4
+		}
+	default:
+		return
+	}
+
+	return weight, true
+}
+
+// Scales frames by 2, 3 or 4 with Maxim Stepin's hqNx.  The pattern of
+// neighbours whose colours differ from each pixel in YUV by more than
+// hqNx's thresholds selects the rule each corner is blended with from
+// hq2x's lookup table.  hq3x and hq4x apply the same rules, blending
+// the larger corners with the subpixel weights of hq3x and hq4x.
+type HQxScaler struct {
+	Factor int
+}
+
+func (scaler *HQxScaler) Apply(frame *image.RGBA) *image.RGBA {
+	p := newPixels(frame)
+	yuv := p.yuv()
+	n := scaler.Factor
+	scaled := image.NewRGBA(image.Rect(0, 0, p.width*n, p.height*n))
+
+	differ := func(a, b int) bool {
+		return p.pix[a] != p.pix[b] &&
+			(abs(yuv[a][0]-yuv[b][0]) > 48 || abs(yuv[a][1]-yuv[b][1]) > 7 || abs(yuv[a][2]-yuv[b][2]) > 6)
+	}
+
+	// the offsets into scaled of the subpixels of each corner
+	var subpixels [4][]int
+	half := (n + 1) / 2
+
+	for r := range subpixels {
+		for i := 0; i < half*half; i++ {
+			sx, sy := hqxSubpixel(i%half, i/half, n, r)
+			subpixels[r] = append(subpixels[r], scaled.PixOffset(sx, sy))
+		}
+	}
+
+	var neighbours [8]int
+	var rules [4]hqxRule
+	var blends [4]int
+	var crosses [4]bool
+	var colors [4][4]uint32
+
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			e := p.index(x, y)
+			o := scaled.PixOffset(x*n, y*n)
+			pattern := 0
+			flat := true
+
+			for i, off := range hqxOffsets {
+				neighbours[i] = p.index(x+off[0], y+off[1])
+
+				if p.pix[neighbours[i]] != p.pix[e] {
+					flat = false
+				}
+
+				if differ(e, neighbours[i]) {
+					pattern |= 1 << uint(i)
+				}
+			}
+
+			// every blend of the same colour is that colour
+			if flat {
+				for sy := 0; sy < n; sy++ {
+					for sx := 0; sx < n; sx++ {
+						putPixel(scaled.Pix[o+sy*scaled.Stride+sx*4:], p.pix[e])
+					}
+				}
+
+				continue
+			}
+
+			for r := range rules {
+				rotation := &hqxRotations[r]
+				corner, left, top := neighbours[rotation[0]], neighbours[rotation[3]], neighbours[rotation[1]]
+
+				rules[r] = hqxRules[hqxRotated[r][pattern]]
+				colors[r] = [4]uint32{p.pix[e], p.pix[corner], p.pix[left], p.pix[top]}
+				crosses[r] = differ(left, top)
+			}
+
+			for r, rule := range rules {
+				blends[r] = rule.same
+
+				if (rule.cond == hqxOwn && crosses[r]) ||
+					(rule.cond == hqxNext && crosses[(r+1)&3]) ||
+					(rule.cond == hqxPrevious && crosses[(r+3)&3]) {
+					blends[r] = rule.differ
+				}
+			}
+
+			switch n {
+			case 2:
+				for r := range rules {
+					putPixel(scaled.Pix[o+subpixels[r][0]:], blendPixels(&colors[r], &hqxWeights2x[blends[r]]))
+				}
+			case 3:
+				putPixel(scaled.Pix[o+scaled.PixOffset(1, 1):], p.pix[e])
+
+				for r := range rules {
+					putPixel(scaled.Pix[o+subpixels[r][0]:], blendPixels(&colors[r], &hqxWeights3x[blends[r]]))
+
+					// the edge between this corner and the next, along
+					// this corner's top and the next's left
+					var weight uint32 = 4
+
+					if pattern&(1<<hqxRotations[r][1]) != 0 {
+						weight = 0
+						w, claimed := hqxEdge(rules[r], blends[r], hqx90Top)
+						next, nextClaimed := hqxEdge(rules[(r+1)&3], blends[(r+1)&3], hqx90Left)
+
+						if claimed && !nextClaimed {
+							weight = w
+						} else if nextClaimed && !claimed {
+							weight = next
+						}
+					}
+
+					putPixel(scaled.Pix[o+subpixels[r][1]:], blendPixels(&colors[r], &hqxWeights{16 - weight, 0, 0, weight}))
+				}
+			case 4:
+				for r := range rules {
+					weights := &hqxWeights4x[blends[r]]
+
+					for i, subpixel := range subpixels[r] {
+						putPixel(scaled.Pix[o+subpixel:], blendPixels(&colors[r], &weights[i]))
+					}
+				}
+			}
+		}
+	}
+
+	return scaled
+}
@@ -0,0 +1,144 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Returns a black frame with a white pixel in the middle.
+func dotFrame() *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, 3, 3))
+
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			frame.SetRGBA(x, y, black)
+		}
+	}
+
+	frame.SetRGBA(1, 1, white)
+
+	return frame
+}
+
+func grey(v uint8) color.RGBA {
+	return color.RGBA{v, v, v, 0xff}
+}
+
+// Checks the subpixels of scaled at each point.
+func checkSubpixels(t *testing.T, name string, scaled *image.RGBA, expected map[image.Point]color.RGBA) {
+	for pt, e := range expected {
+		if c := scaled.RGBAAt(pt.X, pt.Y); c != e {
+			t.Errorf("%v pixel %v,%v is %v, expected %v", name, pt.X, pt.Y, c, e)
+		}
+	}
+}
+
+func TestHQxRules(t *testing.T) {
+	// the top left pixels of cases of hq2x's switch
+	rules := map[int]hqxRule{
+		0:   {hqxAlways, hqx20, hqx20},
+		2:   {hqxAlways, hqx22, hqx22},
+		3:   {hqxAlways, hqx11, hqx11},
+		8:   {hqxAlways, hqx21, hqx21},
+		9:   {hqxAlways, hqx12, hqx12},
+		10:  {hqxOwn, hqx10, hqxFill},
+		11:  {hqxOwn, hqx0, hqxFill},
+		14:  {hqxOwn, hqx10, hqx90Top},
+		19:  {hqxNext, hqx11, hqx60},
+		26:  {hqxOwn, hqx0, hqxFill},
+		30:  {hqxAlways, hqx10, hqx10},
+		42:  {hqxOwn, hqx10, hqx90Left},
+		58:  {hqxOwn, hqx10, hqx70},
+		73:  {hqxPrevious, hqx12, hqx61},
+		143: {hqxOwn, hqx0, hqx90Top},
+		255: {hqxOwn, hqx0, hqx100},
+	}
+
+	for k, rule := range rules {
+		if hqxRules[k] != rule {
+			t.Errorf("Rule for pattern %v is %v, expected %v", k, hqxRules[k], rule)
+		}
+	}
+
+	// hq2x is the same from every corner
+	for k := range hqxRules {
+		mirrored := 0
+
+		for i, j := range []uint{0, 3, 5, 1, 6, 2, 4, 7} {
+			if k&(1<<j) != 0 {
+				mirrored |= 1 << uint(i)
+			}
+		}
+
+		rule, m := hqxRules[k], hqxRules[mirrored]
+		swapped := map[int]int{hqx11: hqx12, hqx12: hqx11, hqx21: hqx22, hqx22: hqx21,
+			hqx60: hqx61, hqx61: hqx60, hqx90Left: hqx90Top, hqx90Top: hqx90Left}
+
+		for _, blend := range []*int{&rule.differ, &rule.same} {
+			if s, ok := swapped[*blend]; ok {
+				*blend = s
+			}
+		}
+
+		if rule.cond == hqxNext {
+			rule.cond = hqxPrevious
+		} else if rule.cond == hqxPrevious {
+			rule.cond = hqxNext
+		}
+
+		if rule != m {
+			t.Errorf("Rule for pattern %v is %v, mirrored %v is %v", k, hqxRules[k], mirrored, m)
+		}
+	}
+}
+
+func TestHQ2xScaler(t *testing.T) {
+	scaler := &HQxScaler{Factor: 2}
+
+	// a dot is dimmed by hqx100
+	checkSubpixels(t, "Dot", scaler.Apply(dotFrame()), map[image.Point]color.RGBA{
+		{2, 2}: grey(0xdf), {3, 2}: grey(0xdf), {2, 3}: grey(0xdf), {3, 3}: grey(0xdf),
+		{1, 2}: black, {2, 1}: black, {1, 1}: black,
+	})
+
+	// the corners either side of a diagonal edge are filled in halfway
+	checkSubpixels(t, "Diagonal", scaler.Apply(diagonalFrame(6)), map[image.Point]color.RGBA{
+		{4, 5}: grey(0x7f), {4, 4}: black, {5, 4}: black, {5, 5}: black,
+		{3, 4}: grey(0x7f), {2, 4}: white, {2, 5}: white, {3, 5}: white,
+	})
+}
+
+func TestHQ3xScaler(t *testing.T) {
+	scaler := &HQxScaler{Factor: 3}
+
+	checkSubpixels(t, "Dot", scaler.Apply(dotFrame()), map[image.Point]color.RGBA{
+		{3, 3}: grey(0x7f), {5, 3}: grey(0x7f), {3, 5}: grey(0x7f), {5, 5}: grey(0x7f),
+		{4, 3}: white, {3, 4}: white, {4, 4}: white,
+	})
+
+	// the corner is filled in and the edges beside it blended slightly
+	checkSubpixels(t, "Diagonal", scaler.Apply(diagonalFrame(6)), map[image.Point]color.RGBA{
+		{6, 8}: grey(0xdf), {6, 7}: grey(0x1f), {7, 8}: grey(0x1f),
+		{6, 6}: black, {7, 7}: black, {8, 6}: black, {8, 8}: black,
+		{5, 6}: grey(0x1f), {4, 6}: grey(0xdf), {5, 7}: grey(0xdf),
+	})
+}
+
+func TestHQ4xScaler(t *testing.T) {
+	scaler := &HQxScaler{Factor: 4}
+
+	checkSubpixels(t, "Dot", scaler.Apply(dotFrame()), map[image.Point]color.RGBA{
+		{4, 4}: grey(0x7f), {5, 4}: white, {4, 5}: white, {5, 5}: white,
+		{7, 7}: grey(0x7f), {6, 7}: white,
+	})
+
+	checkSubpixels(t, "Diagonal", scaler.Apply(diagonalFrame(6)), map[image.Point]color.RGBA{
+		{8, 11}: white, {8, 10}: grey(0x7f), {9, 11}: grey(0x7f), {9, 10}: black,
+		{8, 8}: black, {11, 8}: black, {11, 11}: black,
+	})
+}
+
+func BenchmarkHQ4xScaler(b *testing.B) {
+	benchmarkScaler(b, "hq4x")
+}
@@ -48,6 +48,7 @@ type MMC1Registers struct {
 type MMC1 struct {
 	*ROMFile  `json:"-"`
 	Registers MMC1Registers
+	A12       bool
 }
 
 func (reg *MMC1Registers) Reset() {
@@ -90,46 +91,36 @@ func (mmc1 *MMC1) String() string {
 		fmt.Sprintf("Mapper: 1 (MMC1)")
 }
 
-func (mmc1 *MMC1) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
-	fetch = []uint16{}
-	store = []uint16{}
+func (mmc1 *MMC1) Ranges(which rp2ago3.Mapping) (fetch, store []rp2ago3.Range) {
+	fetch = []rp2ago3.Range{}
+	store = []rp2ago3.Range{}
 
 	switch which {
 	case rp2ago3.PPU:
 		if mmc1.ROMFile.chrBanks > 0 {
 			// CHR bank 1
-			for i := uint32(0x0000); i <= 0x0fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
+			store = append(store, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
 
 			// CHR bank 2
-			for i := uint32(0x1000); i <= 0x1fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
+			store = append(store, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
 		}
 	case rp2ago3.CPU:
 		if mmc1.ROMFile.ramBanks > 0 {
 			// PRG RAM bank
-			for i := uint32(0x6000); i <= 0x7fff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0x6000, End: 0x7fff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0x6000, End: 0x7fff})
 		}
 
 		if mmc1.ROMFile.prgBanks > 0 {
 			// PRG bank 1
-			for i := uint32(0x8000); i <= 0xbfff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0x8000, End: 0xbfff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0x8000, End: 0xbfff})
 
 			// PRG bank 2
-			for i := uint32(0xc000); i <= 0xffff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0xc000, End: 0xffff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0xc000, End: 0xffff})
 		}
 
 	}
@@ -168,6 +159,10 @@ func (mmc1 *MMC1) Fetch(address uint16) (value uint8) {
 		switch {
 		// PRG RAM bank
 		case address >= 0x6000 && address <= 0x7fff:
+			if mmc1.prgRAMDisabled() {
+				break
+			}
+
 			index := address & 0x1fff
 			value = mmc1.ROMFile.wramBanks[0][index]
 		// PRG bank 1
@@ -213,6 +208,10 @@ func (mmc1 *MMC1) Store(address uint16, value uint8) (oldValue uint8) {
 	// CPU only
 	// PRG RAM bank
 	case address >= 0x6000 && address <= 0x7fff:
+		if mmc1.prgRAMDisabled() {
+			break
+		}
+
 		index := address & 0x1fff
 		mmc1.ROMFile.wramBanks[0][index] = value
 	// PRG banks 1 & 2
@@ -259,6 +258,64 @@ func (mmc1 *MMC1) Store(address uint16, value uint8) (oldValue uint8) {
 	return
 }
 
+// The MMC1 has no A12 input of its own but SNROM boards wire CHR bank
+// bit 4 to the PRG RAM enable, so the bank register selected by PPU
+// A12 decides whether PRG RAM responds.  SUROM, SOROM and SXROM
+// boards use the same bit to select PRG ROM or RAM banks instead.
+func (mmc1 *MMC1) ObserveAddress(address uint16, cycles uint64) {
+	mmc1.A12 = address&0x1000 != 0
+}
+
+func (mmc1 *MMC1) prgRAMDisabled() bool {
+	// only SNROM: CHR RAM, up to 256KB of PRG ROM and a single
+	// 8KB PRG RAM bank
+	if mmc1.ROMFile.chrBanks > 0 || mmc1.ROMFile.prgBanks > 16 || mmc1.ROMFile.ramBanks > 1 {
+		return false
+	}
+
+	reg := mmc1.Registers.CHRBank0
+
+	if mmc1.A12 && mmc1.control(CHRRomBankMode) == 1 {
+		reg = mmc1.Registers.CHRBank1
+	}
+
+	return reg&0x10 != 0
+}
+
+func (mmc1 *MMC1) PRGOffset(address uint16) (offset int) {
+	offset = -1
+	index := address & 0x3fff
+	lower, upper := mmc1.prgBanks()
+
+	switch {
+	// PRG bank 1
+	case address >= 0x8000 && address <= 0xbfff:
+		offset = mmc1.ROMFile.prgOffset(int(lower), index)
+	// PRG bank 2
+	case address >= 0xc000 && address <= 0xffff:
+		offset = mmc1.ROMFile.prgOffset(int(upper), index)
+	}
+
+	return
+}
+
+func (mmc1 *MMC1) CHROffset(address uint16) (offset int) {
+	offset = -1
+	index := address & 0x0fff
+	lower, upper := mmc1.chrBanks()
+
+	switch {
+	// CHR bank 1
+	case address >= 0x0000 && address <= 0x0fff:
+		offset = mmc1.ROMFile.chrOffset(int(lower), index)
+	// CHR bank 2
+	case address >= 0x1000 && address <= 0x1fff:
+		offset = mmc1.ROMFile.chrOffset(int(upper), index)
+	}
+
+	return
+}
+
 // 4bit0
 // -----
 // CPPMM
@@ -78,50 +78,38 @@ func (mmc2 *MMC2) String() string {
 		fmt.Sprintf("Mapper: 9 (MMC2)")
 }
 
-func (mmc2 *MMC2) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
-	fetch = []uint16{}
-	store = []uint16{}
+func (mmc2 *MMC2) Ranges(which rp2ago3.Mapping) (fetch, store []rp2ago3.Range) {
+	fetch = []rp2ago3.Range{}
+	store = []rp2ago3.Range{}
 
 	switch which {
 	case rp2ago3.PPU:
 		if mmc2.ROMFile.chrBanks > 0 {
 			// CHR bank 1
-			for i := uint32(0x0000); i <= 0x0fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
+			store = append(store, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
 
 			// CHR bank 2
-			for i := uint32(0x1000); i <= 0x1fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
+			store = append(store, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
 		}
 	case rp2ago3.CPU:
 		if mmc2.ROMFile.prgBanks > 0 {
 			// PRG bank 1
-			for i := uint32(0x8000); i <= 0x9fff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0x8000, End: 0x9fff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0x8000, End: 0x9fff})
 
 			// PRG bank 2
-			for i := uint32(0xa000); i <= 0xbfff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0xa000, End: 0xbfff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0xa000, End: 0xbfff})
 
 			// PRG bank 3
-			for i := uint32(0xc000); i <= 0xdfff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0xc000, End: 0xdfff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0xc000, End: 0xdfff})
 
 			// PRG bank 4
-			for i := uint32(0xe000); i <= 0xffff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0xe000, End: 0xffff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0xe000, End: 0xffff})
 		}
 	}
 
@@ -132,7 +120,9 @@ func (mmc2 *MMC2) Reset() {
 	mmc2.Registers.Reset()
 }
 
-func (mmc2 *MMC2) Fetch(address uint16) (value uint8) {
+// Returns the value Fetch would return without updating the CHR
+// latches.
+func (mmc2 *MMC2) Peek(address uint16) (value uint8) {
 	switch {
 	// PPU only
 	// CHR banks 1 & 2
@@ -152,17 +142,6 @@ func (mmc2 *MMC2) Fetch(address uint16) (value uint8) {
 				value = mmc2.ROMFile.vromBanks[upper][index]
 			}
 		}
-
-		switch {
-		case address == 0x0fd8:
-			mmc2.Registers.Latch0 = 0xfd
-		case address == 0x0fe8:
-			mmc2.Registers.Latch0 = 0xfe
-		case address >= 0x1fd8 && address <= 0x1fdf:
-			mmc2.Registers.Latch1 = 0xfd
-		case address >= 0x1fe8 && address <= 0x1fef:
-			mmc2.Registers.Latch1 = 0xfe
-		}
 	// CPU only
 	case address >= 0x8000 && address <= 0xffff:
 		index := address & 0x1fff
@@ -195,6 +174,25 @@ func (mmc2 *MMC2) Fetch(address uint16) (value uint8) {
 	return
 }
 
+func (mmc2 *MMC2) Fetch(address uint16) (value uint8) {
+	return mmc2.Peek(address)
+}
+
+// Switches the CHR latches when the PPU reads one of the tiles that
+// trigger them, after the tile has been read.
+func (mmc2 *MMC2) ObserveAddress(address uint16, cycles uint64) {
+	switch {
+	case address == 0x0fd8:
+		mmc2.Registers.Latch0 = 0xfd
+	case address == 0x0fe8:
+		mmc2.Registers.Latch0 = 0xfe
+	case address >= 0x1fd8 && address <= 0x1fdf:
+		mmc2.Registers.Latch1 = 0xfd
+	case address >= 0x1fe8 && address <= 0x1fef:
+		mmc2.Registers.Latch1 = 0xfe
+	}
+}
+
 func (mmc2 *MMC2) Store(address uint16, value uint8) (oldValue uint8) {
 	switch {
 	// PPU only
@@ -252,6 +250,46 @@ func (mmc2 *MMC2) Store(address uint16, value uint8) (oldValue uint8) {
 	return
 }
 
+func (mmc2 *MMC2) PRGOffset(address uint16) (offset int) {
+	offset = -1
+	index := address & 0x1fff
+	prgBanks := int(mmc2.ROMFile.prgBanks)
+
+	switch {
+	// PRG bank 1
+	case address >= 0x8000 && address <= 0x9fff:
+		offset = mmc2.ROMFile.prgOffset(int(mmc2.prgBank()), index)
+	// PRG bank 2
+	case address >= 0xa000 && address <= 0xbfff:
+		offset = mmc2.ROMFile.prgOffset(prgBanks-3, index)
+	// PRG bank 3
+	case address >= 0xc000 && address <= 0xdfff:
+		offset = mmc2.ROMFile.prgOffset(prgBanks-2, index)
+	// PRG bank 4
+	case address >= 0xe000 && address <= 0xffff:
+		offset = mmc2.ROMFile.prgOffset(prgBanks-1, index)
+	}
+
+	return
+}
+
+func (mmc2 *MMC2) CHROffset(address uint16) (offset int) {
+	offset = -1
+	index := address & 0x0fff
+	lower, upper := mmc2.chrBanks()
+
+	switch {
+	// CHR bank 1
+	case address >= 0x0000 && address <= 0x0fff:
+		offset = mmc2.ROMFile.chrOffset(int(lower), index)
+	// CHR bank 2
+	case address >= 0x1000 && address <= 0x1fff:
+		offset = mmc2.ROMFile.chrOffset(int(upper), index)
+	}
+
+	return
+}
+
 func (mmc2 *MMC2) prgBank() uint8 {
 	return mmc2.Registers.PRGBank & 0x0f
 }
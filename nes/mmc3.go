@@ -9,6 +9,10 @@ import (
 
 type MMC3BankSelectFlag uint8
 
+// The number of PPU cycles A12 of the PPU's address bus must stay low
+// before it rises for the scanline counter to be clocked.
+const MMC3_A12_FILTER uint64 = 10
+
 const (
 	BankRegister MMC3BankSelectFlag = 1 << iota
 	PRGROMBankMode
@@ -40,6 +44,11 @@ type MMC3Registers struct {
 type MMC3 struct {
 	*ROMFile  `json:"-"`
 	Registers MMC3Registers
+
+	// the level of A12 on the PPU's address bus and the PPU cycle
+	// at which it last fell
+	A12     bool
+	A12Fell uint64
 }
 
 func (reg *MMC3Registers) Reset() {
@@ -108,94 +117,68 @@ func (mmc3 *MMC3) String() string {
 		fmt.Sprintf("Mapper: 4 (MMC3)")
 }
 
-func (mmc3 *MMC3) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
-	fetch = []uint16{}
-	store = []uint16{}
+func (mmc3 *MMC3) Ranges(which rp2ago3.Mapping) (fetch, store []rp2ago3.Range) {
+	fetch = []rp2ago3.Range{}
+	store = []rp2ago3.Range{}
 
 	switch which {
 	case rp2ago3.PPU:
 		if mmc3.ROMFile.chrBanks > 0 {
 			// CHR bank 1
-			for i := uint32(0x0000); i <= 0x03ff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x0000, End: 0x03ff})
+			store = append(store, rp2ago3.Range{Start: 0x0000, End: 0x03ff})
 
 			// CHR bank 2
-			for i := uint32(0x0400); i <= 0x07ff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x0400, End: 0x07ff})
+			store = append(store, rp2ago3.Range{Start: 0x0400, End: 0x07ff})
 
 			// CHR bank 3
-			for i := uint32(0x0800); i <= 0x0bff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x0800, End: 0x0bff})
+			store = append(store, rp2ago3.Range{Start: 0x0800, End: 0x0bff})
 
 			// CHR bank 4
-			for i := uint32(0x0c00); i <= 0x0fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x0c00, End: 0x0fff})
+			store = append(store, rp2ago3.Range{Start: 0x0c00, End: 0x0fff})
 
 			// CHR bank 5
-			for i := uint32(0x1000); i <= 0x13ff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x1000, End: 0x13ff})
+			store = append(store, rp2ago3.Range{Start: 0x1000, End: 0x13ff})
 
 			// CHR bank 6
-			for i := uint32(0x1400); i <= 0x17ff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x1400, End: 0x17ff})
+			store = append(store, rp2ago3.Range{Start: 0x1400, End: 0x17ff})
 
 			// CHR bank 7
-			for i := uint32(0x1800); i <= 0x1bff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x1800, End: 0x1bff})
+			store = append(store, rp2ago3.Range{Start: 0x1800, End: 0x1bff})
 
 			// CHR bank 8
-			for i := uint32(0x1c00); i <= 0x1fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x1c00, End: 0x1fff})
+			store = append(store, rp2ago3.Range{Start: 0x1c00, End: 0x1fff})
 		}
 	case rp2ago3.CPU:
 		if mmc3.ROMFile.ramBanks > 0 {
 			// PRG RAM bank
-			for i := uint32(0x6000); i <= 0x7fff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0x6000, End: 0x7fff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0x6000, End: 0x7fff})
 		}
 
 		if mmc3.ROMFile.prgBanks > 0 {
 			// PRG bank 1
-			for i := uint32(0x8000); i <= 0x9fff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0x8000, End: 0x9fff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0x8000, End: 0x9fff})
 
 			// PRG bank 2
-			for i := uint32(0xa000); i <= 0xbfff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0xa000, End: 0xbfff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0xa000, End: 0xbfff})
 
 			// PRG bank 3
-			for i := uint32(0xc000); i <= 0xdfff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0xc000, End: 0xdfff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0xc000, End: 0xdfff})
 
 			// PRG bank 4
-			for i := uint32(0xe000); i <= 0xffff; i++ {
-				store = append(store, uint16(i))
-				fetch = append(fetch, uint16(i))
-			}
+			store = append(store, rp2ago3.Range{Start: 0xe000, End: 0xffff})
+			fetch = append(fetch, rp2ago3.Range{Start: 0xe000, End: 0xffff})
 		}
 	}
 
@@ -368,6 +351,50 @@ func (mmc3 *MMC3) Store(address uint16, value uint8) (oldValue uint8) {
 	return
 }
 
+func (mmc3 *MMC3) PRGOffset(address uint16) (offset int) {
+	offset = -1
+
+	switch {
+	// PRG banks 1-4
+	case address >= 0x8000 && address <= 0xffff:
+		bank1, bank2, bank3, bank4 := mmc3.prgBanks()
+		banks := [4]uint16{bank1, bank2, bank3, bank4}
+		offset = mmc3.ROMFile.prgOffset(int(banks[(address>>13)&0x03]), address&0x1fff)
+	}
+
+	return
+}
+
+func (mmc3 *MMC3) CHROffset(address uint16) (offset int) {
+	offset = -1
+
+	switch {
+	// CHR banks 1-8
+	case address >= 0x0000 && address <= 0x1fff:
+		bank1, bank2, bank3, bank4, bank5, bank6, bank7, bank8 := mmc3.chrBanks()
+		banks := [8]uint8{bank1, bank2, bank3, bank4, bank5, bank6, bank7, bank8}
+		offset = mmc3.ROMFile.chrOffset(int(banks[address>>10]), address&0x03ff)
+	}
+
+	return
+}
+
+// Clocks the scanline counter when A12 of the PPU's address bus rises
+// after being low for at least MMC3_A12_FILTER cycles, which ignores
+// the brief drops between the pattern table fetches for each tile.
+func (mmc3 *MMC3) ObserveAddress(address uint16, cycles uint64) {
+	a12 := address&0x1000 != 0
+
+	switch {
+	case mmc3.A12 && !a12:
+		mmc3.A12Fell = cycles
+	case !mmc3.A12 && a12 && cycles-mmc3.A12Fell >= MMC3_A12_FILTER:
+		mmc3.scanlineCounter()
+	}
+
+	mmc3.A12 = a12
+}
+
 func (mmc3 *MMC3) scanlineCounter() {
 	if mmc3.Registers.IRQReload {
 		mmc3.Registers.IRQReload = false
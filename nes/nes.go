@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"image/color"
+	"io"
 	"log"
 
 	"os"
@@ -50,20 +52,71 @@ type NES struct {
 	controllers   *Controllers
 	ROM           ROM
 	audio         Audio
+	samples       []int16
+	RateControl   *RateControl
 	video         Video
+	palette       []color.Color
+	filter        Filter
+	effects       []Effect
 	fps           *FPS
 	recorder      Recorder
 	audioRecorder AudioRecorder
+	tracer        *Tracer
+	cdl           *CDL
+	hdpack        *HDPack
+	profiler      *m65go2.Profiler
 	options       *Options
+	captures      chan *nametableRequest
+	capture       *nametableRequest
+	calls         chan *call
+	quit          chan bool
+	stopped       chan bool
+}
+
+// A function run by Call on the goroutine running the processors.
+type call struct {
+	f    func()
+	done chan bool
 }
 
 type Options struct {
-	Recorder      string
-	AudioRecorder string
-	CPUDecode     bool
-	CPUProfile    string
-	MemProfile    string
-	HTTPAddress   string
+	Recorder       string
+	AudioRecorder  string
+	AudioFrequency int
+	Stereo         bool
+	Mixer          MixerParams
+	CPUDecode      bool
+	CPUProfile     string
+	Trace          string
+	TraceFormat    string
+	TraceStart     int
+	TraceStop      int
+	TraceLowPC     uint
+	TraceHighPC    uint
+	TraceTrigger   int
+	CDL            string
+	RoutineProfile string
+	RoutineReport  string
+	MemProfile     string
+	HTTPAddress    string
+	Palette        string
+	NTSC           NTSCParams
+	Filter         string
+	Scaler         string
+	Scanlines      float64
+	Blend          bool
+	NoSpriteLimit  bool
+	HDPack         string
+}
+
+// Returns the audio's sample rate, 44.1kHz unless AudioFrequency is
+// set.
+func (options *Options) audioFrequency() int {
+	if options.AudioFrequency <= 0 {
+		return 44100
+	}
+
+	return options.AudioFrequency
 }
 
 func NewNES(filename string, options *Options) (nes *NES, err error) {
@@ -71,35 +124,42 @@ func NewNES(filename string, options *Options) (nes *NES, err error) {
 	var video Video
 	var recorder Recorder
 	var audioRecorder AudioRecorder
-	var cpuDivisor float32
+	var tracer *Tracer
+	var rateControl *RateControl
+	var profiler *m65go2.Profiler
 
-	audioFrequency := 44100
+	audioFrequency := options.audioFrequency()
+	audioChannels := 1
 	audioSampleSize := 2048
 
-	cpu := rp2ago3.NewRP2A03(audioFrequency)
+	if options.Stereo {
+		audioChannels = 2
+	}
+
+	if nes, err = newNES(filename, options); err != nil {
+		return
+	}
+
+	cpu, ppu, rom := nes.CPU, nes.PPU, nes.ROM
 
 	if options.CPUDecode {
 		cpu.EnableDecode()
 	}
 
-	ppu := rp2cgo2.NewRP2C02(cpu.InterruptLine(m65go2.Nmi))
+	if options.RoutineProfile != "" || options.RoutineReport != "" {
+		// vblank lasts 20 scanlines, or 70 on PAL
+		scanlines := uint16(20)
 
-	rom, err := NewROM(filename, cpu.InterruptLine(m65go2.Irq), ppu.Nametable.SetTables)
+		if rom.Region() == PAL {
+			scanlines = 70
+		}
 
-	if err != nil {
-		err = errors.New(fmt.Sprintf("Error loading ROM: %v", err))
-		return
-	}
+		vblank := float32(scanlines*rp2cgo2.CYCLES_PER_SCANLINE) / nes.cpuDivisor
 
-	switch rom.Region() {
-	case NTSC:
-		cpuDivisor = rp2ago3.NTSC_CPU_CLOCK_DIVISOR
-	case PAL:
-		cpuDivisor = rp2ago3.PAL_CPU_CLOCK_DIVISOR
+		profiler = m65go2.NewProfiler(uint64(vblank))
+		cpu.SetProfiler(profiler)
 	}
 
-	ctrls := NewControllers()
-
 	events := make(chan Event)
 	video, err = NewVideo(rom.GameName(), events)
 
@@ -108,13 +168,17 @@ func NewNES(filename string, options *Options) (nes *NES, err error) {
 		return
 	}
 
-	audio, err = NewAudio(audioFrequency, audioSampleSize)
+	audio, err = NewAudio(audioFrequency, audioChannels, audioSampleSize)
 
 	if err != nil {
 		err = errors.New(fmt.Sprintf("Error creating audio: %v", err))
 		return
 	}
 
+	if _, size := audio.Buffered(); size > 0 {
+		rateControl = NewRateControl()
+	}
+
 	switch options.Recorder {
 	case "none":
 		// none
@@ -129,11 +193,46 @@ func NewNES(filename string, options *Options) (nes *NES, err error) {
 		return
 	}
 
+	palette, err := NewPalette(options.Palette, options.NTSC)
+
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Error loading palette: %v", err))
+		return
+	}
+
+	filter, err := NewFilter(options.Filter, palette, options.NTSC)
+
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Error creating filter: %v", err))
+		return
+	}
+
+	scaler, err := NewScaler(options.Scaler)
+
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Error creating scaler: %v", err))
+		return
+	}
+
+	effects := []Effect{}
+
+	if options.Blend {
+		effects = append(effects, &FrameBlendEffect{})
+	}
+
+	if scaler != nil {
+		effects = append(effects, scaler)
+	}
+
+	if options.Scanlines > 0.0 {
+		effects = append(effects, &ScanlinesEffect{Intensity: options.Scanlines})
+	}
+
 	switch options.AudioRecorder {
 	case "none":
 		// none
 	case "wav":
-		audioRecorder, err = NewWAVRecorder()
+		audioRecorder, err = NewWAVRecorder(audioFrequency, audioChannels)
 	}
 
 	if err != nil {
@@ -141,32 +240,172 @@ func NewNES(filename string, options *Options) (nes *NES, err error) {
 		return
 	}
 
-	cpu.Memory.AddMappings(ppu, rp2ago3.CPU)
-	cpu.Memory.AddMappings(rom, rp2ago3.CPU)
+	if options.Trace != "" {
+		var format TraceFormat
+
+		if format, err = ParseTraceFormat(options.TraceFormat); err == nil {
+			tracer, err = NewTracer(options.Trace, format, ppu)
+		}
+
+		if err != nil {
+			err = errors.New(fmt.Sprintf("Error creating tracer: %v", err))
+			return
+		}
+
+		tracer.StartFrame = options.TraceStart
+		tracer.StopFrame = options.TraceStop
+		tracer.LowPC = uint16(options.TraceLowPC)
+		tracer.HighPC = uint16(options.TraceHighPC)
+		tracer.Trigger = options.TraceTrigger
+
+		cpu.SetTrace(tracer.Tracing, tracer.Trace)
+	}
+
+	nes.frameStep = NoStep
+	nes.paused = make(chan bool, 2)
+	nes.events = events
+	nes.audio = audio
+	nes.RateControl = rateControl
+	nes.video = video
+	nes.palette = palette
+	nes.filter = filter
+	nes.effects = effects
+	nes.fps = NewFPS(DEFAULT_FPS)
+	nes.recorder = recorder
+	nes.audioRecorder = audioRecorder
+	nes.tracer = tracer
+	nes.profiler = profiler
+	nes.captures = make(chan *nametableRequest, 16)
+	nes.calls = make(chan *call)
+	nes.quit = make(chan bool)
+	nes.stopped = make(chan bool)
+
+	return
+}
+
+// Creates the CPU, PPU, cartridge and controllers of an NES running
+// the ROM at filename and wires them together, with the CDL and HD
+// pack in options if any.  NewNES adds the video, audio and the rest
+// to it and the tests run it as is.
+func newNES(filename string, options *Options) (nes *NES, err error) {
+	var cdl *CDL
+	var hdpack *HDPack
+	var cpu *rp2ago3.RP2A03
+	var cpuDivisor float32
+	var cpuFrequency float64
+
+	// the CPU's clock depends on the ROM's region, so the PPU and
+	// the cartridge are made first and reach the CPU's interrupt
+	// lines through it once it is made
+	interruptLine := func(which m65go2.Interrupt) func(state bool) {
+		return func(state bool) {
+			if cpu != nil {
+				cpu.M6502.Interrupt(which, state)
+			}
+		}
+	}
+
+	ppu := rp2cgo2.NewRP2C02(interruptLine(m65go2.Nmi))
+
+	rom, err := NewROM(filename, interruptLine(m65go2.Irq), ppu.Nametable.SetTables)
+
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Error loading ROM: %v", err))
+		return
+	}
+
+	switch rom.Region() {
+	case NTSC:
+		cpuDivisor = rp2ago3.NTSC_CPU_CLOCK_DIVISOR
+		cpuFrequency = rp2ago3.NTSC_CPU_FREQUENCY
+	case PAL:
+		cpuDivisor = rp2ago3.PAL_CPU_CLOCK_DIVISOR
+		cpuFrequency = rp2ago3.PAL_CPU_FREQUENCY
+	}
+
+	cpu = rp2ago3.NewRP2A03(cpuFrequency, options.audioFrequency())
+
+	if options.Stereo {
+		cpu.APU.Stereo = true
+		cpu.APU.Channels = options.Mixer.Channels()
+	}
+
+	ctrls := NewControllers()
+
+	cpu.Memory.AddRanges(ppu, rp2ago3.CPU)
+
+	if options.CDL != "" {
+		cdl = NewCDL(rom, cpu.M6502)
+
+		if _, err = os.Stat(options.CDL); err == nil {
+			err = cdl.Load(options.CDL)
+		} else if os.IsNotExist(err) {
+			err = nil
+		}
+
+		if err != nil {
+			err = errors.New(fmt.Sprintf("Error loading CDL: %v", err))
+			return
+		}
+
+		cpu.OnExecute(cdl.Execute)
+		ppu.PatternFetch = cdl.Pattern
+
+		cpu.Memory.AddRanges(cdl, rp2ago3.CPU)
+	} else {
+		cpu.Memory.AddRanges(rom, rp2ago3.CPU)
+	}
+
+	ctrls.OpenBus = func() uint8 { return cpu.Memory.Bus }
 	cpu.Memory.AddMappings(ctrls, rp2ago3.CPU)
 
-	ppu.Memory.AddMappings(rom, rp2ago3.PPU)
+	ppu.Memory.AddRanges(rom, rp2ago3.PPU)
+	ppu.AddressBus = rom.ObserveAddress
+	ppu.NoSpriteLimit = options.NoSpriteLimit
+
+	if options.HDPack != "" {
+		hdpack, err = LoadHDPack(options.HDPack, rom, ppu.Memory.Peek, cpu.Memory.Peek)
+
+		if err != nil {
+			err = errors.New(fmt.Sprintf("Error loading HD pack: %v", err))
+			return
+		}
+
+		ppu.TileKey = hdpack.TileKey
+	}
 
 	nes = &NES{
-		frameStep:     NoStep,
-		paused:        make(chan bool, 2),
-		events:        events,
-		CPU:           cpu,
-		cpuDivisor:    cpuDivisor,
-		PPU:           ppu,
-		ROM:           rom,
-		audio:         audio,
-		video:         video,
-		fps:           NewFPS(DEFAULT_FPS),
-		recorder:      recorder,
-		audioRecorder: audioRecorder,
-		controllers:   ctrls,
-		options:       options,
+		CPU:         cpu,
+		cpuDivisor:  cpuDivisor,
+		PPU:         ppu,
+		ROM:         rom,
+		cdl:         cdl,
+		hdpack:      hdpack,
+		controllers: ctrls,
+		options:     options,
 	}
 
 	return
 }
 
+// Switches the filter to the palette with the given name, as accepted
+// by NewPalette.  Since the filter uses the palette for every frame it
+// must be called on the goroutine running the processors, through
+// Call once the NES is running.
+func (nes *NES) SetPalette(name string) (err error) {
+	palette, err := NewPalette(name, nes.options.NTSC)
+
+	if err != nil {
+		return
+	}
+
+	nes.options.Palette = name
+	nes.palette = palette
+	nes.filter.SetPalette(palette)
+
+	return
+}
+
 func (nes *NES) Reset() {
 	nes.CPU.Reset()
 	nes.PPU.Reset()
@@ -174,6 +413,82 @@ func (nes *NES) Reset() {
 	nes.controllers.Reset()
 }
 
+// Queues e to be processed along with the events from the video
+// and the emulation.
+func (nes *NES) Send(e Event) {
+	nes.events <- e
+}
+
+// Runs f on the goroutine running the processors, at the end of a
+// scanline or while paused, and waits for it to return.  Events are
+// processed alongside the processors, so changes to the hardware,
+// its hooks or the palette that must not happen mid-instruction or
+// mid-frame are made with Call instead.  f is run immediately if the
+// NES has not been started or the processors have stopped.
+func (nes *NES) Call(f func()) {
+	if nes.state != Running && nes.state != Paused && nes.state != Quitting {
+		f()
+		return
+	}
+
+	c := &call{
+		f:    f,
+		done: make(chan bool),
+	}
+
+	select {
+	case nes.calls <- c:
+		<-c.done
+	case <-nes.stopped:
+		f()
+	}
+}
+
+// Runs the functions waiting in Call.
+func (nes *NES) runCalls() {
+	for {
+		select {
+		case c := <-nes.calls:
+			c.f()
+			close(c.done)
+		default:
+			return
+		}
+	}
+}
+
+// Waits for the NES to be resumed, running the functions passed to
+// Call meanwhile.  Returns false if the NES quit instead.
+func (nes *NES) waitResumed() bool {
+	for {
+		select {
+		case <-nes.paused:
+			return true
+		case <-nes.quit:
+			return false
+		case c := <-nes.calls:
+			c.f()
+			close(c.done)
+		}
+	}
+}
+
+// Stops the processors and waits for them to return, discarding the
+// events they send meanwhile since the video is no longer running
+// to receive frames.
+func (nes *NES) stop() {
+	nes.state = Quitting
+	close(nes.quit)
+
+	for {
+		select {
+		case <-nes.stopped:
+			return
+		case <-nes.events:
+		}
+	}
+}
+
 func (nes *NES) RunState() RunState {
 	return nes.state
 }
@@ -296,7 +611,7 @@ func (nes *NES) processEvents() {
 func (nes *NES) runProcessors() (err error) {
 	var cycles uint16
 
-	mmc3, _ := nes.ROM.(*MMC3)
+	defer close(nes.stopped)
 
 	for nes.state != Quitting {
 		if nes.PPUQuota < 1.0 {
@@ -311,7 +626,13 @@ func (nes *NES) runProcessors() (err error) {
 			scanline := nes.PPU.Scanline
 
 			if colors := nes.PPU.Execute(); colors != nil {
+				if nes.profiler != nil {
+					nes.profiler.Frame()
+				}
+
 				nes.frame(colors)
+				nes.flushSamples()
+				nes.controlRate()
 				nes.fps.Delay()
 
 				if nes.frameStep == FrameStep {
@@ -319,12 +640,13 @@ func (nes *NES) runProcessors() (err error) {
 				}
 			}
 
-			if mmc3 != nil && nes.PPU.TriggerScanlineCounter() {
-				mmc3.scanlineCounter()
-			}
-
 			nes.PPUQuota--
 
+			if nes.PPU.Scanline != scanline {
+				nes.captureNametables()
+				nes.runCalls()
+			}
+
 			if nes.frameStep == CycleStep ||
 				(nes.frameStep == ScanlineStep && nes.PPU.Scanline != scanline) {
 				nes.state = Paused
@@ -333,31 +655,93 @@ func (nes *NES) runProcessors() (err error) {
 
 		if nes.PPUQuota < 1.0 {
 			for i := uint16(0); i < cycles; i++ {
-				if sample, haveSample := nes.CPU.APU.Execute(); haveSample {
-					nes.sample(sample)
+				if left, right, haveSample := nes.CPU.APU.Execute(); haveSample {
+					nes.sample(left, right)
 				}
 			}
 		}
 
-		if nes.state == Paused {
-			<-nes.paused
+		if nes.state == Paused && !nes.waitResumed() {
+			break
 		}
-
 	}
 
 	return
 }
 
-func (nes *NES) frame(colors []uint8) {
+func (nes *NES) frame(colors []uint16) {
+	frame := nes.filter.Filter(colors)
+
+	if nes.hdpack != nil {
+		frame = nes.hdpack.Compose(frame, nes.PPU.Tiles)
+	}
+
+	for _, effect := range nes.effects {
+		frame = effect.Apply(frame)
+	}
+
 	nes.events <- &FrameEvent{
-		colors: colors,
+		frame: frame,
+	}
+}
+
+// Adds a sample to those sent to the audio at the end of the frame,
+// or a pair of samples with stereo.
+func (nes *NES) sample(left, right int16) {
+	if nes.CPU.APU.Stereo {
+		nes.samples = append(nes.samples, left, right)
+	} else {
+		nes.samples = append(nes.samples, left)
+	}
+}
+
+// Adjusts the APU's sample rate to keep the audio's buffer half full.
+func (nes *NES) controlRate() {
+	if nes.RateControl != nil {
+		nes.CPU.APU.AdjustSampleRate(nes.RateControl.Update(nes.audio.Buffered()))
+	}
+}
+
+// Sends the samples of the last frame to the audio in one event.  The
+// audio keeps the slice, so later samples go in a new one.
+func (nes *NES) flushSamples() {
+	if len(nes.samples) == 0 {
+		return
+	}
+
+	nes.events <- &SamplesEvent{
+		samples: nes.samples,
 	}
+
+	nes.samples = make([]int16, 0, cap(nes.samples))
 }
 
-func (nes *NES) sample(sample int16) {
-	nes.events <- &SampleEvent{
-		sample: sample,
+func (nes *NES) writeRoutineProfile() {
+	write := func(filename string, writeTo func(w io.Writer) error) {
+		if filename == "" {
+			return
+		}
+
+		f, err := os.Create(filename)
+
+		if err == nil {
+			err = writeTo(f)
+
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+
+		if err != nil {
+			fmt.Printf("*** Error writing routine profile: %s\n", err)
+			return
+		}
+
+		fmt.Println("*** Writing routine profile to", filename)
 	}
+
+	write(nes.options.RoutineProfile, nes.profiler.WritePprof)
+	write(nes.options.RoutineReport, nes.profiler.WriteReport)
 }
 
 func (nes *NES) Run() (err error) {
@@ -395,6 +779,7 @@ func (nes *NES) Run() (err error) {
 	}
 
 	nes.video.Run()
+	nes.stop()
 
 	if nes.recorder != nil {
 		nes.recorder.Quit()
@@ -404,6 +789,24 @@ func (nes *NES) Run() (err error) {
 		nes.audioRecorder.Quit()
 	}
 
+	if nes.tracer != nil {
+		if err = nes.tracer.Close(); err != nil {
+			fmt.Printf("*** Error closing trace: %s\n", err)
+		}
+	}
+
+	if nes.cdl != nil {
+		fmt.Println("*** Saving CDL to " + nes.options.CDL)
+
+		if err = nes.cdl.Save(nes.options.CDL); err != nil {
+			fmt.Printf("*** Error saving CDL: %s\n", err)
+		}
+	}
+
+	if nes.profiler != nil {
+		nes.writeRoutineProfile()
+	}
+
 	if nes.options.MemProfile != "" {
 		f, err := os.Create(nes.options.MemProfile)
 
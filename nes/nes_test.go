@@ -195,3 +195,245 @@ func TestHorizontalMirroring(t *testing.T) {
 		ppu.Memory.Store(i, 0x00)
 	}
 }
+
+// Returns an NES running the ROM at filename without video, audio or
+// events, wired up as NewNES does.
+func newTestNES(t *testing.T, filename string) *NES {
+	return newTestNESWithOptions(t, filename, &Options{})
+}
+
+// Returns an NES like newTestNES with the given options.
+func newTestNESWithOptions(t *testing.T, filename string, options *Options) *NES {
+	nes, err := newNES(filename, options)
+
+	if err != nil {
+		t.Fatalf("Error creating NES: %v", err)
+	}
+
+	nes.Reset()
+
+	return nes
+}
+
+// Runs nes for the given number of frames the way runProcessors does,
+// without sending frames or samples anywhere, and returns the last
+// frame's pixels.  The PPU may run a few cycles into the next frame.
+func runTestFrames(t *testing.T, nes *NES, frames int) (colors []uint16) {
+	for frames > 0 {
+		cycles, err := nes.CPU.Execute()
+
+		if err != nil {
+			t.Fatalf("Error executing CPU: %v", err)
+		}
+
+		for nes.PPUQuota += float32(cycles) * nes.cpuDivisor; nes.PPUQuota >= 1.0; nes.PPUQuota-- {
+			if frame := nes.PPU.Execute(); frame != nil {
+				colors = frame
+				frames--
+			}
+		}
+
+		for i := uint16(0); i < cycles; i++ {
+			nes.CPU.APU.Execute()
+		}
+	}
+
+	return
+}
+
+// Runs a test ROM that reports its result at $6000, returning the
+// result and the text it wrote at $6004.  The writes are watched
+// rather than read back since some mappers disable reads from PRG
+// RAM.
+func runTestROM(t *testing.T, filename string, frames int) (result uint8, text string) {
+	var wram [0x1000]uint8
+
+	nes := newTestNES(t, filename)
+
+	nes.CPU.Memory.OnWrite(func(address uint16, value uint8) {
+		if address >= 0x6000 && address <= 0x6fff {
+			wram[address-0x6000] = value
+		}
+	})
+
+	for ; frames > 0; frames -= 10 {
+		runTestFrames(t, nes, 10)
+
+		// $de $b0 $61 marks a running test
+		if wram[1] == 0xde && wram[2] == 0xb0 && wram[3] == 0x61 && wram[0] < 0x80 {
+			break
+		}
+	}
+
+	if wram[1] != 0xde || wram[2] != 0xb0 || wram[3] != 0x61 {
+		t.Errorf("%v did not start", filename)
+	}
+
+	result = wram[0]
+
+	for i := 4; i < len(wram) && wram[i] != 0; i++ {
+		text += string(wram[i])
+	}
+
+	return
+}
+
+func TestSpriteOverflowTests(t *testing.T) {
+	for _, name := range []string{"1.Basics", "2.Details", "3.Timing", "4.Obscure", "5.Emulator"} {
+		nes := newTestNES(t, "../samples/sprite_overflow_tests/"+name+".nes")
+
+		runTestFrames(t, nes, 120)
+
+		// these tests store 1 at $f8 when they pass and the
+		// number of the failing test otherwise
+		if result := nes.CPU.Memory.Fetch(0x00f8); result != 1 {
+			t.Errorf("%v failed test %v", name, result)
+		}
+	}
+}
+
+func TestOAMStress(t *testing.T) {
+	for _, name := range []string{"oam_read/oam_read", "oam_stress/oam_stress"} {
+		if result, text := runTestROM(t, "../samples/"+name+".nes", 3600); result != 0 {
+			t.Errorf("%v failed with %02X: %v", name, result, text)
+		}
+	}
+}
+
+// 4.Scanline_timing is left out since the CPU and PPU are only
+// synchronized between instructions, and 5.MMC3_rev_A tests the
+// older MMC3 revision.
+func TestMMC3IRQTests(t *testing.T) {
+	for _, name := range []string{"1.Clocking", "2.Details", "3.A12_clocking", "6.MMC3_rev_B"} {
+		nes := newTestNES(t, "../samples/mmc3_irq_tests/"+name+".nes")
+
+		runTestFrames(t, nes, 240)
+
+		if result := nes.CPU.Memory.Fetch(0x00f8); result != 1 {
+			t.Errorf("%v failed test %v", name, result)
+		}
+	}
+
+	for _, name := range []string{"1-clocking", "2-details", "3-A12_clocking", "5-MMC3"} {
+		if result, text := runTestROM(t, "../samples/mmc3_test_2/rom_singles/"+name+".nes", 600); result != 0 {
+			t.Errorf("%v failed with %02X: %v", name, result, text)
+		}
+	}
+}
+
+func TestMMC1A12(t *testing.T) {
+	writes := 0
+
+	nes := newTestNES(t, "../samples/MMC1_A12/mmc1_a12.nes")
+
+	// the test bar writes $9f to $6000 once a frame but spins
+	// forever if PRG RAM is never disabled while sprites are
+	// fetched
+	nes.CPU.Memory.OnWrite(func(address uint16, value uint8) {
+		if address == 0x6000 && value == 0x9f {
+			writes++
+		}
+	})
+
+	runTestFrames(t, nes, 60)
+
+	if writes < 2 {
+		t.Errorf("test bar froze after %v frames", writes)
+	}
+}
+
+func TestPPUOpenBus(t *testing.T) {
+	if result, text := runTestROM(t, "../samples/ppu_open_bus/ppu_open_bus.nes", 600); result != 0 {
+		t.Errorf("ppu_open_bus failed with %02X: %v", result, text)
+	}
+}
+
+func TestCall(t *testing.T) {
+	ran := false
+
+	nes := &NES{
+		state:  Paused,
+		paused: make(chan bool, 2),
+		calls:  make(chan *call),
+	}
+
+	// resume once the call has returned
+	go func() {
+		nes.Call(func() { ran = true })
+		nes.paused <- false
+	}()
+
+	nes.waitResumed()
+
+	if !ran {
+		t.Error("Call was not run while paused")
+	}
+}
+
+func TestPaletteEvent(t *testing.T) {
+	var err error
+
+	nes := &NES{
+		state:   Paused,
+		paused:  make(chan bool, 2),
+		calls:   make(chan *call),
+		filter:  NewPaletteFilter(EmphasisPalette),
+		options: &Options{},
+	}
+
+	e := &PaletteEvent{
+		Name: "rp2c03",
+		Err:  make(chan error, 1),
+	}
+
+	e.Process(nes)
+
+	go func() {
+		err = <-e.Err
+		nes.paused <- false
+	}()
+
+	// the palette is switched on this goroutine
+	nes.waitResumed()
+
+	if err != nil || nes.options.Palette != "rp2c03" {
+		t.Errorf("Switched to palette '%v' with error %v", nes.options.Palette, err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	ran := false
+
+	nes := &NES{
+		state:   Paused,
+		paused:  make(chan bool, 2),
+		events:  make(chan Event),
+		calls:   make(chan *call),
+		quit:    make(chan bool),
+		stopped: make(chan bool),
+	}
+
+	// stands in for the processors: sends a frame nobody receives
+	// and then stays paused until the NES quits
+	go func() {
+		defer close(nes.stopped)
+
+		nes.events <- &FrameEvent{}
+
+		if nes.waitResumed() {
+			t.Error("Resumed instead of quitting")
+		}
+	}()
+
+	nes.stop()
+
+	if nes.state != Quitting {
+		t.Errorf("State is %v after stopping", nes.state)
+	}
+
+	nes.Call(func() { ran = true })
+
+	if !ran {
+		t.Error("Call was not run once stopped")
+	}
+}
@@ -19,36 +19,28 @@ func (nrom *NROM) String() string {
 		fmt.Sprintf("Mapper: 0 (NROM)")
 }
 
-func (nrom *NROM) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
-	fetch = []uint16{}
-	store = []uint16{}
+func (nrom *NROM) Ranges(which rp2ago3.Mapping) (fetch, store []rp2ago3.Range) {
+	fetch = []rp2ago3.Range{}
+	store = []rp2ago3.Range{}
 
 	switch which {
 	case rp2ago3.PPU:
 		if nrom.ROMFile.chrBanks > 0 {
 			// CHR bank 1
-			for i := uint32(0x0000); i <= 0x0fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
+			store = append(store, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
 
 			// CHR bank 2
-			for i := uint32(0x1000); i <= 0x1fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
+			store = append(store, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
 		}
 	case rp2ago3.CPU:
 		if nrom.ROMFile.prgBanks > 0 {
 			// PRG bank 1
-			for i := uint32(0x8000); i <= 0xbfff; i++ {
-				fetch = append(fetch, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x8000, End: 0xbfff})
 
 			// PRG bank 2
-			for i := uint32(0xc000); i <= 0xffff; i++ {
-				fetch = append(fetch, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0xc000, End: 0xffff})
 		}
 	}
 
@@ -99,3 +91,31 @@ func (nrom *NROM) Store(address uint16, value uint8) (oldValue uint8) {
 
 	return
 }
+
+func (nrom *NROM) PRGOffset(address uint16) (offset int) {
+	offset = -1
+	index := address & 0x3fff
+
+	switch {
+	// PRG bank 1
+	case address >= 0x8000 && address <= 0xbfff:
+		offset = nrom.ROMFile.prgOffset(0, index)
+	// PRG bank 2
+	case address >= 0xc000 && address <= 0xffff:
+		offset = nrom.ROMFile.prgOffset(int(nrom.ROMFile.prgBanks)-1, index)
+	}
+
+	return
+}
+
+func (nrom *NROM) CHROffset(address uint16) (offset int) {
+	offset = -1
+
+	switch {
+	// CHR banks 1 & 2
+	case address >= 0x0000 && address <= 0x1fff:
+		offset = nrom.ROMFile.chrOffset(0, address)
+	}
+
+	return
+}
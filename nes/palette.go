@@ -0,0 +1,284 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+// Parameters used to decode the composite video signal of an NTSC
+// RP2C02 into RGB.  Hue is in degrees, Saturation and Contrast are
+// multipliers, Brightness is added to luma and Gamma is the gamma of
+// the display being emulated.
+type NTSCParams struct {
+	Hue        float64
+	Saturation float64
+	Contrast   float64
+	Brightness float64
+	Gamma      float64
+}
+
+var DefaultNTSCParams = NTSCParams{
+	Hue:        0.0,
+	Saturation: 1.0,
+	Contrast:   1.0,
+	Brightness: 0.0,
+	Gamma:      1.8,
+}
+
+// The names of the built-in palettes accepted by NewPalette, in the
+// order PaletteEvent cycles through them.
+var PaletteNames []string = []string{
+	"rp2c02",
+	"ntsc",
+	"rp2c03",
+	"rp2c04-0001",
+	"rp2c04-0002",
+	"rp2c04-0003",
+	"rp2c04-0004",
+	"rp2c05",
+}
+
+// Returns the 512-entry palette with the given name, which is either
+// one of PaletteNames or the path of a .pal file.  The ntsc palette is
+// generated from params.
+func NewPalette(name string, params NTSCParams) (palette []color.Color, err error) {
+	switch name {
+	case "", "rp2c02":
+		palette = EmphasisPalette
+	case "ntsc":
+		palette = NTSCPalette(params)
+	case "rp2c03", "rp2c05":
+		palette = RGBPalette(nil)
+	case "rp2c04-0001":
+		palette = RGBPalette(rp2c04Lookup[0][:])
+	case "rp2c04-0002":
+		palette = RGBPalette(rp2c04Lookup[1][:])
+	case "rp2c04-0003":
+		palette = RGBPalette(rp2c04Lookup[2][:])
+	case "rp2c04-0004":
+		palette = RGBPalette(rp2c04Lookup[3][:])
+	default:
+		if !strings.HasSuffix(strings.ToLower(name), ".pal") {
+			err = errors.New(fmt.Sprintf("Unknown palette '%s'", name))
+			return
+		}
+
+		palette, err = LoadPalette(name)
+	}
+
+	return
+}
+
+// Loads a palette from a .pal file holding 64 or 512 RGB triplets.
+// A 64-entry palette is expanded to cover the emphasis bits.
+func LoadPalette(filename string) (palette []color.Color, err error) {
+	var buf []byte
+
+	if buf, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	switch len(buf) {
+	case 64 * 3, 512 * 3:
+	default:
+		err = errors.New(fmt.Sprintf("Palette file '%s' is %v bytes, expected 192 or 1536", filename, len(buf)))
+		return
+	}
+
+	palette = make([]color.Color, len(buf)/3)
+
+	for i := range palette {
+		palette[i] = color.RGBA{buf[i*3], buf[i*3+1], buf[i*3+2], 0xff}
+	}
+
+	if len(palette) == 64 {
+		palette = ExpandPalette(palette)
+	}
+
+	return
+}
+
+// Voltage levels of the RP2C02's video signal relative to sync,
+// indexed by luma for the low and high halves of its colour square
+// wave.
+var ntscLevels = [2][4]float64{
+	{0.350, 0.518, 0.962, 1.550},
+	{1.094, 1.506, 1.962, 1.962},
+}
+
+const (
+	NTSC_BLACK = 0.518
+	NTSC_WHITE = 1.962
+)
+
+// Returns the level of the video signal the RP2C02 generates for a
+// 9-bit pixel at the given phase of the colour subcarrier, scaled so
+// that black is 0 and white is 1.
+func ntscSignal(pixel, phase int) float64 {
+	hue := pixel & 0x0f
+	luma := (pixel >> 4) & 0x03
+	emphasis := pixel >> 6
+
+	// $xE and $xF output the level of $1D
+	if hue > 0x0d {
+		luma = 1
+	}
+
+	low, high := ntscLevels[0][luma], ntscLevels[1][luma]
+
+	switch {
+	case hue == 0x00:
+		low = high
+	case hue > 0x0c:
+		high = low
+	}
+
+	inPhase := func(hue int) bool {
+		return (hue+phase)%12 < 6
+	}
+
+	signal := low
+
+	if inPhase(hue) {
+		signal = high
+	}
+
+	if (emphasis&0x01 != 0 && inPhase(0x0c)) ||
+		(emphasis&0x02 != 0 && inPhase(0x04)) ||
+		(emphasis&0x04 != 0 && inPhase(0x08)) {
+		signal *= EMPHASIS_ATTENUATION
+	}
+
+	return (signal - NTSC_BLACK) / (NTSC_WHITE - NTSC_BLACK)
+}
+
+// Returns the palette seen by decoding the video signal the RP2C02
+// generates for each 9-bit pixel into YIQ and then RGB.
+func NTSCPalette(params NTSCParams) (palette []color.Color) {
+	palette = make([]color.Color, 512)
+
+	for pixel := range palette {
+		var y, i, q float64
+
+		// sample the 12 phases of one colour subcarrier cycle
+		for phase := 0; phase < 12; phase++ {
+			signal := ntscSignal(pixel, phase)
+
+			// offset so that hue $6 decodes to red
+			angle := math.Pi * (float64(phase) + 4.0 + params.Hue/30.0) / 6.0
+
+			y += signal
+			i += signal * math.Cos(angle)
+			q += signal * math.Sin(angle)
+		}
+
+		y = y/12.0*params.Contrast + params.Brightness
+		i = i / 12.0 * params.Saturation * 2.0
+		q = q / 12.0 * params.Saturation * 2.0
+
+		palette[pixel] = color.RGBA{
+			ntscGamma(y+0.946882*i+0.623557*q, params.Gamma),
+			ntscGamma(y-0.274788*i-0.635691*q, params.Gamma),
+			ntscGamma(y-1.108545*i+1.709007*q, params.Gamma),
+			0xff,
+		}
+	}
+
+	return
+}
+
+// Converts a decoded channel from the NES's gamma of 2.2 to a
+// display's and scales it to 0-255.
+func ntscGamma(value, gamma float64) uint8 {
+	if value <= 0.0 {
+		return 0
+	}
+
+	value = math.Pow(value, 2.2/gamma) * 255.0
+
+	if value > 255.0 {
+		return 255
+	}
+
+	return uint8(value + 0.5)
+}
+
+// The colours of the RGB PPUs as octal RGB triplets, one digit per
+// 3-bit channel.  The RP2C03 and RP2C05 output black for $xD-$xF,
+// which the RP2C04's lookup tables use for colours the others lack.
+var rgbColors = [64]uint16{
+	0333, 0014, 0006, 0326, 0403, 0503, 0510, 0420, 0320, 0120, 0031, 0040, 0022, 0111, 0003, 0020,
+	0555, 0036, 0027, 0407, 0507, 0704, 0700, 0630, 0430, 0140, 0040, 0053, 0044, 0222, 0200, 0310,
+	0777, 0357, 0447, 0637, 0707, 0737, 0740, 0750, 0660, 0360, 0070, 0276, 0077, 0444, 0000, 0000,
+	0777, 0567, 0657, 0757, 0747, 0755, 0764, 0772, 0773, 0572, 0473, 0276, 0467, 0666, 0653, 0760,
+}
+
+// The order in which each revision of the RP2C04 scrambles
+// rgbColors.
+var rp2c04Lookup = [4][64]uint8{
+	{
+		0x35, 0x23, 0x16, 0x22, 0x1c, 0x09, 0x1d, 0x15, 0x20, 0x00, 0x27, 0x05, 0x04, 0x28, 0x08, 0x20,
+		0x21, 0x3e, 0x1f, 0x29, 0x3c, 0x32, 0x36, 0x12, 0x3f, 0x2b, 0x2e, 0x1e, 0x3d, 0x2d, 0x24, 0x01,
+		0x0e, 0x31, 0x33, 0x2a, 0x2c, 0x0c, 0x1b, 0x14, 0x2e, 0x07, 0x34, 0x06, 0x13, 0x02, 0x26, 0x2e,
+		0x2e, 0x19, 0x10, 0x0a, 0x39, 0x03, 0x37, 0x17, 0x0f, 0x11, 0x0b, 0x0d, 0x38, 0x25, 0x18, 0x3a,
+	},
+	{
+		0x2e, 0x27, 0x18, 0x39, 0x3a, 0x25, 0x1c, 0x31, 0x16, 0x13, 0x38, 0x34, 0x20, 0x23, 0x3c, 0x0b,
+		0x0f, 0x21, 0x06, 0x3d, 0x1b, 0x29, 0x1e, 0x22, 0x1d, 0x24, 0x0e, 0x2b, 0x32, 0x08, 0x2e, 0x03,
+		0x04, 0x36, 0x26, 0x33, 0x11, 0x1f, 0x10, 0x02, 0x14, 0x3f, 0x00, 0x09, 0x12, 0x2e, 0x28, 0x20,
+		0x3e, 0x0d, 0x2a, 0x17, 0x0c, 0x01, 0x15, 0x19, 0x2e, 0x2c, 0x07, 0x37, 0x35, 0x05, 0x0a, 0x2d,
+	},
+	{
+		0x14, 0x25, 0x3a, 0x10, 0x0b, 0x20, 0x31, 0x09, 0x01, 0x2e, 0x36, 0x08, 0x15, 0x3d, 0x3e, 0x3c,
+		0x22, 0x1c, 0x05, 0x12, 0x19, 0x18, 0x17, 0x1b, 0x00, 0x03, 0x2e, 0x02, 0x16, 0x06, 0x34, 0x35,
+		0x23, 0x0f, 0x0e, 0x37, 0x0d, 0x27, 0x26, 0x20, 0x29, 0x04, 0x21, 0x24, 0x11, 0x2d, 0x2e, 0x1f,
+		0x2c, 0x1e, 0x39, 0x33, 0x07, 0x2a, 0x28, 0x1d, 0x0a, 0x2e, 0x32, 0x38, 0x13, 0x2b, 0x3f, 0x0c,
+	},
+	{
+		0x18, 0x03, 0x1c, 0x28, 0x2e, 0x35, 0x01, 0x17, 0x10, 0x1f, 0x2a, 0x0e, 0x36, 0x37, 0x0b, 0x39,
+		0x25, 0x1e, 0x12, 0x34, 0x2e, 0x1d, 0x06, 0x26, 0x3e, 0x1b, 0x22, 0x19, 0x04, 0x2e, 0x3a, 0x21,
+		0x05, 0x0a, 0x07, 0x02, 0x13, 0x14, 0x00, 0x15, 0x0c, 0x3d, 0x11, 0x0f, 0x0d, 0x38, 0x2d, 0x24,
+		0x33, 0x20, 0x08, 0x16, 0x3f, 0x2b, 0x20, 0x3c, 0x2e, 0x27, 0x23, 0x31, 0x29, 0x32, 0x2c, 0x09,
+	},
+}
+
+// Returns the palette of an RGB PPU.  A nil lookup gives the RP2C03
+// and RP2C05 palette, otherwise each colour is looked up in
+// rgbColors through lookup as on the RP2C04.  Rather than attenuating
+// the other channels, an RGB PPU's emphasis bits drive the channel
+// they emphasize to full brightness.
+func RGBPalette(lookup []uint8) (palette []color.Color) {
+	palette = make([]color.Color, 512)
+
+	for pixel := range palette {
+		index := pixel & 0x3f
+		octal := uint16(0000)
+
+		switch {
+		case lookup != nil:
+			octal = rgbColors[lookup[index]]
+		case index&0x0f < 0x0d:
+			octal = rgbColors[index]
+		}
+
+		channels := [3]uint8{}
+
+		for channel := range channels {
+			level := (octal >> uint(3*(2-channel))) & 0x07
+
+			if (pixel>>6)&(1<<uint(channel)) != 0 {
+				level = 0x07
+			}
+
+			channels[channel] = uint8(level * 255 / 7)
+		}
+
+		palette[pixel] = color.RGBA{channels[0], channels[1], channels[2], 0xff}
+	}
+
+	return
+}
@@ -0,0 +1,130 @@
+package nes
+
+import (
+	"image/color"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadPalette(t *testing.T) {
+	for _, size := range []int{64, 512, 65} {
+		fo, err := ioutil.TempFile("", "nintengo")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, size*3)
+
+		for i := range buf {
+			buf[i] = uint8(i / 3)
+		}
+
+		fo.Write(buf)
+		fo.Close()
+
+		palette, err := LoadPalette(fo.Name())
+		os.Remove(fo.Name())
+
+		if size == 65 {
+			if err == nil {
+				t.Error("No error loading palette of 65 entries")
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(palette) != 512 {
+			t.Errorf("Palette of %v entries has %v entries, expected 512", size, len(palette))
+		}
+
+		if c := palette[0x21]; c != (color.RGBA{0x21, 0x21, 0x21, 0xff}) {
+			t.Errorf("Color $21 is %v in palette of %v entries", c, size)
+		}
+
+		// a 512-entry palette is used as is
+		if c := palette[0x161]; size == 512 && c != (color.RGBA{0x61, 0x61, 0x61, 0xff}) {
+			t.Errorf("Color $161 is %v, expected loaded color", c)
+		}
+	}
+}
+
+func TestRGBPalette(t *testing.T) {
+	rp2c03 := RGBPalette(nil)
+
+	for _, v := range []struct {
+		pixel uint16
+		c     color.RGBA
+	}{
+		{0x016, color.RGBA{0xff, 0x00, 0x00, 0xff}},
+		{0x00d, color.RGBA{0x00, 0x00, 0x00, 0xff}},
+		{0x020, color.RGBA{0xff, 0xff, 0xff, 0xff}},
+		{0x112, color.RGBA{0x00, 0x48, 0xff, 0xff}},
+	} {
+		if c := rp2c03[v.pixel]; c != v.c {
+			t.Errorf("Pixel %03X is %v, expected %v", v.pixel, c, v.c)
+		}
+	}
+
+	// each revision of the RP2C04 scrambles the same colours
+	counts := make(map[color.Color]int)
+
+	for _, c := range RGBPalette(rp2c04Lookup[0][:])[:64] {
+		counts[c]++
+	}
+
+	for i := 1; i < len(rp2c04Lookup); i++ {
+		revision := make(map[color.Color]int)
+
+		for _, c := range RGBPalette(rp2c04Lookup[i][:])[:64] {
+			revision[c]++
+		}
+
+		for c, n := range counts {
+			if revision[c] != n {
+				t.Errorf("RP2C04 revision %v has color %v %v times, expected %v", i+1, c, revision[c], n)
+			}
+		}
+	}
+}
+
+func TestNTSCPalette(t *testing.T) {
+	palette := NTSCPalette(DefaultNTSCParams)
+
+	rgb := func(pixel uint16) (r, g, b uint8) {
+		c := palette[pixel].(color.RGBA)
+		return c.R, c.G, c.B
+	}
+
+	if r, g, b := rgb(0x0f); r != 0 || g != 0 || b != 0 {
+		t.Errorf("Color $0F is %02x%02x%02x, expected black", r, g, b)
+	}
+
+	if r, g, b := rgb(0x20); r != 0xff || g != 0xff || b != 0xff {
+		t.Errorf("Color $20 is %02x%02x%02x, expected white", r, g, b)
+	}
+
+	for _, v := range []struct {
+		pixel   uint16
+		channel int
+	}{
+		{0x016, 0},
+		{0x01a, 1},
+		{0x012, 2},
+		{0x050, 0},
+	} {
+		r, g, b := rgb(v.pixel)
+		channels := []uint8{r, g, b}
+
+		for i, c := range channels {
+			if i != v.channel && c >= channels[v.channel] {
+				t.Errorf("Color %03X is %02x%02x%02x, expected channel %v to be brightest", v.pixel, r, g, b, v.channel)
+			}
+		}
+	}
+}
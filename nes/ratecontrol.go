@@ -0,0 +1,98 @@
+package nes
+
+import "sync"
+
+// The most the rate control changes the audio's sample rate by.
+const RATE_CONTROL_MAX_DELTA float64 = 0.005
+
+// The number of updates Drift averages Ratio over.
+const RATE_CONTROL_DRIFT_UPDATES float64 = 128
+
+// Keeps the audio's buffer about half full by making slightly more or
+// fewer samples than the audio plays, so that small differences
+// between the speed frames are made at and the speed the audio device
+// plays at don't run its buffer dry or make it overflow.  It is
+// updated once a frame.
+type RateControl struct {
+	RateControlStats
+
+	filled bool
+	empty  bool
+
+	// a copy of the stats made by each update for other goroutines
+	// to read
+	lock      sync.Mutex
+	published RateControlStats
+}
+
+// The rate control's view of the audio's buffer.
+type RateControlStats struct {
+	// how full the audio's buffer was at the last update, from 0 to 1
+	Level float64
+	// the times the audio's buffer ran dry
+	Underruns uint64
+	// the ratio the sample rate was last adjusted by
+	Ratio float64
+	// the average of Ratio - 1, how much faster samples are made
+	// than the audio plays them without adjustment
+	Drift   float64
+	Updates uint64
+}
+
+func NewRateControl() *RateControl {
+	rc := &RateControl{}
+	rc.Ratio = 1
+	rc.published = rc.RateControlStats
+
+	return rc
+}
+
+// Returns the stats as of the last update.  Unlike the embedded
+// fields, which only the goroutine calling Update may use, it is safe
+// to call from any goroutine.
+func (rc *RateControl) Stats() RateControlStats {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	return rc.published
+}
+
+// Updates the rate control with the number of samples waiting in the
+// audio's buffer and the number it holds, and returns the ratio to
+// adjust the sample rate by.
+func (rc *RateControl) Update(buffered, size int) (ratio float64) {
+	if size <= 0 {
+		return 1
+	}
+
+	rc.Level = float64(buffered) / float64(size)
+
+	switch {
+	case rc.Level < 0:
+		rc.Level = 0
+	case rc.Level > 1:
+		rc.Level = 1
+	}
+
+	// count each time the buffer runs dry once it has been filled
+	if buffered <= 0 {
+		if rc.filled && !rc.empty {
+			rc.Underruns++
+		}
+
+		rc.empty = true
+	} else {
+		rc.filled = true
+		rc.empty = false
+	}
+
+	rc.Ratio = 1 + RATE_CONTROL_MAX_DELTA*(1-2*rc.Level)
+	rc.Drift += (rc.Ratio - 1 - rc.Drift) / RATE_CONTROL_DRIFT_UPDATES
+	rc.Updates++
+
+	rc.lock.Lock()
+	rc.published = rc.RateControlStats
+	rc.lock.Unlock()
+
+	return rc.Ratio
+}
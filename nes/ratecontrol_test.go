@@ -0,0 +1,53 @@
+package nes
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRateControl(t *testing.T) {
+	rc := NewRateControl()
+
+	for _, test := range []struct {
+		buffered, size int
+		ratio          float64
+		underruns      uint64
+	}{
+		// not counted as an underrun before the buffer has filled
+		{0, 4096, 1.005, 0},
+		{2048, 4096, 1, 0},
+		{4096, 4096, 0.995, 0},
+		{8192, 4096, 0.995, 0},
+		{1024, 4096, 1.0025, 0},
+		{0, 4096, 1.005, 1},
+		{0, 4096, 1.005, 1},
+		{3072, 4096, 0.9975, 1},
+		{0, 4096, 1.005, 2},
+	} {
+		if ratio := rc.Update(test.buffered, test.size); math.Abs(ratio-test.ratio) > 1e-9 {
+			t.Errorf("%v of %v samples buffered gave ratio %v not %v", test.buffered, test.size, ratio, test.ratio)
+		}
+
+		if rc.Underruns != test.underruns {
+			t.Errorf("%v of %v samples buffered gave %v underruns not %v", test.buffered, test.size, rc.Underruns, test.underruns)
+		}
+	}
+
+	if ratio := rc.Update(0, 0); ratio != 1 {
+		t.Errorf("Unknown buffer size gave ratio %v not 1", ratio)
+	}
+
+	// a buffer kept nearly empty shows samples being played faster
+	// than they are made
+	for i := 0; i < 1000; i++ {
+		rc.Update(512, 4096)
+	}
+
+	if rc.Drift < 0.0037 || rc.Drift > 0.0038 {
+		t.Errorf("Drift is %v not 0.00375", rc.Drift)
+	}
+
+	if stats := rc.Stats(); stats != rc.RateControlStats {
+		t.Errorf("Stats are %+v not %+v", stats, rc.RateControlStats)
+	}
+}
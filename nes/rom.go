@@ -45,12 +45,19 @@ type ROMFile struct {
 }
 
 type ROM interface {
-	rp2ago3.MappableMemory
+	rp2ago3.RangeMappableMemory
 	Region() Region
 	String() string
 	GameName() string
 	LoadBattery()
 	SaveBattery() (err error)
+	PRGSize() int
+	CHRSize() int
+	PRGOffset(address uint16) int
+	CHROffset(address uint16) int
+	PatchCHR(offset int, value uint8)
+	SaveROM(filename string) (err error)
+	ObserveAddress(address uint16, cycles uint64)
 }
 
 func getBuf(filename string) (buf []byte, suffix string, err error) {
@@ -297,6 +304,88 @@ func (romf *ROMFile) String() string {
 		fmt.Sprintf("Region: %v\n", romf.region)
 }
 
+// Returns the size in bytes of the ROM file's PRG ROM
+func (romf *ROMFile) PRGSize() (size int) {
+	for _, bank := range romf.romBanks {
+		size += len(bank)
+	}
+
+	return
+}
+
+// Returns the size in bytes of the ROM file's CHR ROM, which is zero
+// for carts using CHR RAM
+func (romf *ROMFile) CHRSize() (size int) {
+	for _, bank := range romf.vromBanks {
+		size += len(bank)
+	}
+
+	return
+}
+
+// Returns the offset into the ROM file's PRG ROM of index within
+// romBanks[bank], or -1 if there is no PRG ROM.  Mappers that split
+// the file's 16 KB banks always do so evenly, so every bank in
+// romBanks has the same size and romBanks[bank] starts at
+// bank*len(romBanks[bank]).
+func (romf *ROMFile) prgOffset(bank int, index uint16) int {
+	if romf.prgBanks == 0 {
+		return -1
+	}
+
+	return bank*len(romf.romBanks[bank]) + int(index)
+}
+
+// Returns the offset into the ROM file's CHR ROM of index within
+// vromBanks[bank], or -1 if the cart uses CHR RAM.
+func (romf *ROMFile) chrOffset(bank int, index uint16) int {
+	if romf.chrBanks == 0 {
+		return -1
+	}
+
+	return bank*len(romf.vromBanks[bank]) + int(index)
+}
+
+// Stores value at offset into the ROM file's CHR ROM
+func (romf *ROMFile) PatchCHR(offset int, value uint8) {
+	size := len(romf.vromBanks[0])
+	romf.vromBanks[offset/size][offset%size] = value
+}
+
+// Writes the ROM file to filename as a .nes file, including any
+// changes made to its CHR ROM
+func (romf *ROMFile) SaveROM(filename string) (err error) {
+	buf, _, err := getBuf(romf.filename)
+
+	if err != nil {
+		return
+	}
+
+	i := 16 + romf.PRGSize()
+
+	if romf.trainer {
+		i += 512
+	}
+
+	if len(buf) < i+romf.CHRSize() {
+		err = errors.New("Invalid ROM: EOF in VROM bank data")
+		return
+	}
+
+	for _, bank := range romf.vromBanks {
+		i += copy(buf[i:], bank)
+	}
+
+	err = ioutil.WriteFile(filename, buf, 0644)
+
+	return
+}
+
+// Called with each address the PPU reads or writes and the number of
+// cycles the PPU had run.  Mappers that watch the PPU's address bus
+// override it.
+func (romf *ROMFile) ObserveAddress(address uint16, cycles uint64) {}
+
 func (romf *ROMFile) GameName() string {
 	return romf.gamename
 }
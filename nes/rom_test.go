@@ -632,3 +632,44 @@ func TestRegion(t *testing.T) {
 	}
 
 }
+
+func TestMMC1PRGRAMDisable(t *testing.T) {
+	for _, test := range []struct {
+		prgBanks uint8
+		disabled bool
+	}{
+		// SNROM
+		{16, true},
+		// SUROM, where CHR bank bit 4 selects the upper 256KB
+		{32, false},
+	} {
+		buf := make([]byte, 16+int(test.prgBanks)*0x4000)
+		copy(buf, []byte{0x4e, 0x45, 0x53, 0x1a, test.prgBanks, 0x00, 0x12, 0x00})
+
+		romf, err := NewROMFile(buf)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		romf.setTables = func(t0, t1, t2, t3 int) {}
+		mmc1 := NewMMC1(romf)
+
+		mmc1.Store(0x6000, 0x5a)
+
+		// write CHR bank 0 = $10 serially
+		for _, bit := range []uint8{0, 0, 0, 0, 1} {
+			mmc1.Store(0xa000, bit)
+		}
+
+		mmc1.Store(0x6001, 0xa5)
+
+		if value := mmc1.Fetch(0x6000); (value != 0x5a) != test.disabled {
+			t.Errorf("%v PRG banks: PRG RAM read $%02x with CHR bank $10", test.prgBanks, value)
+		}
+
+		if disabled := romf.wramBanks[0][1] != 0xa5; disabled != test.disabled {
+			t.Errorf("%v PRG banks: PRG RAM write disabled is %v not %v", test.prgBanks, disabled, test.disabled)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// Post-processes the frames produced by a Filter before they are
+// shown and recorded.  Effects may modify the frames they are given.
+type Effect interface {
+	Apply(frame *image.RGBA) *image.RGBA
+}
+
+// The names of the scalers accepted by NewScaler.
+var ScalerNames []string = []string{
+	"none",
+	"nearest2x",
+	"nearest3x",
+	"nearest4x",
+	"scale2x",
+	"scale3x",
+	"hq2x",
+	"hq3x",
+	"hq4x",
+	"xbr2x",
+}
+
+// Returns the scaler with the given name, one of ScalerNames.  The
+// none scaler is nil.
+func NewScaler(name string) (scaler Effect, err error) {
+	switch name {
+	case "", "none":
+	case "nearest2x":
+		scaler = &NearestScaler{Factor: 2}
+	case "nearest3x":
+		scaler = &NearestScaler{Factor: 3}
+	case "nearest4x":
+		scaler = &NearestScaler{Factor: 4}
+	case "scale2x":
+		scaler = &Scale2xScaler{}
+	case "scale3x":
+		scaler = &Scale3xScaler{}
+	case "hq2x":
+		scaler = &HQxScaler{Factor: 2}
+	case "hq3x":
+		scaler = &HQxScaler{Factor: 3}
+	case "hq4x":
+		scaler = &HQxScaler{Factor: 4}
+	case "xbr2x":
+		scaler = &XBRScaler{}
+	default:
+		err = errors.New(fmt.Sprintf("Unknown scaler '%s'", name))
+	}
+
+	return
+}
+
+// A frame's pixels packed as 0xAABBGGRR for fast comparison.
+type pixels struct {
+	pix           []uint32
+	width, height int
+}
+
+func newPixels(frame *image.RGBA) *pixels {
+	bounds := frame.Bounds()
+
+	p := &pixels{
+		pix:    make([]uint32, bounds.Dx()*bounds.Dy()),
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+	}
+
+	for y := 0; y < p.height; y++ {
+		o := frame.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+
+		for x := 0; x < p.width; x++ {
+			p.pix[y*p.width+x] = uint32(frame.Pix[o]) | uint32(frame.Pix[o+1])<<8 |
+				uint32(frame.Pix[o+2])<<16 | uint32(frame.Pix[o+3])<<24
+			o += 4
+		}
+	}
+
+	return p
+}
+
+// Returns the index of the pixel at x, y, clamping coordinates
+// outside the frame to its edges.
+func (p *pixels) index(x, y int) int {
+	switch {
+	case x < 0:
+		x = 0
+	case x >= p.width:
+		x = p.width - 1
+	}
+
+	switch {
+	case y < 0:
+		y = 0
+	case y >= p.height:
+		y = p.height - 1
+	}
+
+	return y*p.width + x
+}
+
+// Returns the pixel at x, y, clamping coordinates outside the frame to
+// its edges.
+func (p *pixels) at(x, y int) uint32 {
+	return p.pix[p.index(x, y)]
+}
+
+// Returns the YUV of each pixel, each component scaled to 0-255.
+func (p *pixels) yuv() (yuv [][3]int) {
+	yuv = make([][3]int, len(p.pix))
+
+	for i, c := range p.pix {
+		r, g, b := int(c&0xff), int((c>>8)&0xff), int((c>>16)&0xff)
+
+		yuv[i][0] = (299*r + 587*g + 114*b) / 1000
+		yuv[i][1] = (-169*r-331*g+500*b)/1000 + 128
+		yuv[i][2] = (500*r-419*g-81*b)/1000 + 128
+	}
+
+	return
+}
+
+func setPixel(frame *image.RGBA, x, y int, c uint32) {
+	putPixel(frame.Pix[frame.PixOffset(x, y):], c)
+}
+
+// Stores c in the first 4 bytes of pix.
+func putPixel(pix []uint8, c uint32) {
+	pix[0], pix[1], pix[2], pix[3] = uint8(c), uint8(c>>8), uint8(c>>16), uint8(c>>24)
+}
+
+// Returns a mixed with b, taking weight/256ths of b.
+func mixPixels(a, b uint32, weight uint32) uint32 {
+	rb := ((a&0x00ff00ff)*(256-weight) + (b&0x00ff00ff)*weight) >> 8
+	ga := ((a>>8)&0x00ff00ff)*(256-weight) + ((b>>8)&0x00ff00ff)*weight
+
+	return rb&0x00ff00ff | ga&0xff00ff00
+}
+
+// Scales frames by repeating each pixel.
+type NearestScaler struct {
+	Factor int
+}
+
+func (scaler *NearestScaler) Apply(frame *image.RGBA) *image.RGBA {
+	bounds := frame.Bounds()
+	n := scaler.Factor
+	scaled := image.NewRGBA(image.Rect(0, 0, bounds.Dx()*n, bounds.Dy()*n))
+
+	for y := 0; y < scaled.Rect.Max.Y; y++ {
+		row := scaled.Pix[y*scaled.Stride:]
+		src := frame.Pix[frame.PixOffset(bounds.Min.X, bounds.Min.Y+y/n):]
+
+		for x := 0; x < scaled.Rect.Max.X; x++ {
+			copy(row[x*4:x*4+4], src[(x/n)*4:])
+		}
+	}
+
+	return scaled
+}
+
+// Scales frames by 2 with Andrea Mazzoleni's Scale2x, which copies a
+// neighbouring pixel into the corners of each pixel that lie on an
+// edge.
+type Scale2xScaler struct{}
+
+func (scaler *Scale2xScaler) Apply(frame *image.RGBA) *image.RGBA {
+	p := newPixels(frame)
+	scaled := image.NewRGBA(image.Rect(0, 0, p.width*2, p.height*2))
+
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			b, d, e, f, h := p.at(x, y-1), p.at(x-1, y), p.at(x, y), p.at(x+1, y), p.at(x, y+1)
+			e0, e1, e2, e3 := e, e, e, e
+
+			if b != h && d != f {
+				if d == b {
+					e0 = d
+				}
+
+				if b == f {
+					e1 = f
+				}
+
+				if d == h {
+					e2 = d
+				}
+
+				if h == f {
+					e3 = f
+				}
+			}
+
+			setPixel(scaled, x*2, y*2, e0)
+			setPixel(scaled, x*2+1, y*2, e1)
+			setPixel(scaled, x*2, y*2+1, e2)
+			setPixel(scaled, x*2+1, y*2+1, e3)
+		}
+	}
+
+	return scaled
+}
+
+// Scales frames by 3 with Scale3x, Scale2x's rules extended to the
+// edges between the corners.
+type Scale3xScaler struct{}
+
+func (scaler *Scale3xScaler) Apply(frame *image.RGBA) *image.RGBA {
+	p := newPixels(frame)
+	scaled := image.NewRGBA(image.Rect(0, 0, p.width*3, p.height*3))
+
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			a, b, c := p.at(x-1, y-1), p.at(x, y-1), p.at(x+1, y-1)
+			d, e, f := p.at(x-1, y), p.at(x, y), p.at(x+1, y)
+			g, h, i := p.at(x-1, y+1), p.at(x, y+1), p.at(x+1, y+1)
+
+			out := [9]uint32{e, e, e, e, e, e, e, e, e}
+
+			if b != h && d != f {
+				if d == b {
+					out[0] = d
+				}
+
+				if (d == b && e != c) || (b == f && e != a) {
+					out[1] = b
+				}
+
+				if b == f {
+					out[2] = f
+				}
+
+				if (d == b && e != g) || (d == h && e != a) {
+					out[3] = d
+				}
+
+				if (b == f && e != i) || (h == f && e != c) {
+					out[5] = f
+				}
+
+				if d == h {
+					out[6] = d
+				}
+
+				if (d == h && e != i) || (h == f && e != g) {
+					out[7] = h
+				}
+
+				if h == f {
+					out[8] = f
+				}
+			}
+
+			for n, px := range out {
+				setPixel(scaled, x*3+n%3, y*3+n/3, px)
+			}
+		}
+	}
+
+	return scaled
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// Darkens the bottom of each scanline like the gaps between the
+// scanlines of a television.  Intensity is how much the gaps are
+// darkened, from 0 to 1.
+type ScanlinesEffect struct {
+	Intensity float64
+}
+
+func (effect *ScanlinesEffect) Apply(frame *image.RGBA) *image.RGBA {
+	bounds := frame.Bounds()
+	scale := bounds.Dy() / 240
+
+	if scale < 1 {
+		scale = 1
+	}
+
+	keep := uint32((1.0 - effect.Intensity) * 256)
+
+	for y := 0; y < bounds.Dy(); y++ {
+		// every other row at 1x, otherwise the bottom half of each
+		// scanline
+		if (scale == 1 && y&0x01 == 0) || (scale > 1 && y%scale < (scale+1)/2) {
+			continue
+		}
+
+		o := frame.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+
+		for x := 0; x < bounds.Dx(); x++ {
+			for c := 0; c < 3; c++ {
+				frame.Pix[o+c] = uint8(uint32(frame.Pix[o+c]) * keep >> 8)
+			}
+
+			o += 4
+		}
+	}
+
+	return frame
+}
+
+// Averages each frame with the one before it, so that sprites games
+// flicker on alternate frames are shown half transparent as on a
+// television.
+type FrameBlendEffect struct {
+	previous []uint8
+}
+
+func (effect *FrameBlendEffect) Apply(frame *image.RGBA) *image.RGBA {
+	previous := effect.previous
+	effect.previous = make([]uint8, len(frame.Pix))
+	copy(effect.previous, frame.Pix)
+
+	if len(previous) != len(frame.Pix) {
+		return frame
+	}
+
+	for i := range frame.Pix {
+		frame.Pix[i] = uint8((uint16(frame.Pix[i]) + uint16(previous[i]) + 1) >> 1)
+	}
+
+	return frame
+}
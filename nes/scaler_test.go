@@ -0,0 +1,161 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var (
+	black = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	white = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// Returns a frame that is black above its diagonal and white below
+// it.
+func diagonalFrame(size int) *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if x < y {
+				frame.SetRGBA(x, y, white)
+			} else {
+				frame.SetRGBA(x, y, black)
+			}
+		}
+	}
+
+	return frame
+}
+
+func TestNewScaler(t *testing.T) {
+	for _, name := range ScalerNames {
+		scaler, err := NewScaler(name)
+
+		if err != nil {
+			t.Errorf("Error creating scaler %v: %v", name, err)
+		}
+
+		if (scaler == nil) != (name == "none") {
+			t.Errorf("Scaler %v is %v", name, scaler)
+		}
+	}
+
+	if _, err := NewScaler("hq5x"); err == nil {
+		t.Error("No error creating unknown scaler")
+	}
+}
+
+func TestScalerBounds(t *testing.T) {
+	factors := map[string]int{
+		"nearest2x": 2, "nearest3x": 3, "nearest4x": 4,
+		"scale2x": 2, "scale3x": 3,
+		"hq2x": 2, "hq3x": 3, "hq4x": 4,
+		"xbr2x": 2,
+	}
+
+	for name, factor := range factors {
+		scaler, _ := NewScaler(name)
+		scaled := scaler.Apply(diagonalFrame(8))
+
+		if scaled.Bounds() != image.Rect(0, 0, 8*factor, 8*factor) {
+			t.Errorf("Scaler %v frame is %v, expected %vx%v", name, scaled.Bounds(), 8*factor, 8*factor)
+		}
+
+		// solid areas are left alone
+		if c := scaled.RGBAAt(8*factor-1, 0); c != black {
+			t.Errorf("Scaler %v top right pixel is %v, expected %v", name, c, black)
+		}
+
+		if c := scaled.RGBAAt(0, 8*factor-1); c != white {
+			t.Errorf("Scaler %v bottom left pixel is %v, expected %v", name, c, white)
+		}
+	}
+}
+
+func TestNearestScaler(t *testing.T) {
+	scaled := (&NearestScaler{Factor: 3}).Apply(diagonalFrame(4))
+
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 12; x++ {
+			if c, expected := scaled.RGBAAt(x, y), diagonalFrame(4).RGBAAt(x/3, y/3); c != expected {
+				t.Fatalf("Pixel %v,%v is %v, expected %v", x, y, c, expected)
+			}
+		}
+	}
+}
+
+func TestScale2xScaler(t *testing.T) {
+	scaled := (&Scale2xScaler{}).Apply(diagonalFrame(4))
+
+	// the corner of each black pixel on the diagonal nearest the white
+	// is filled in, smoothing the staircase
+	for i := 1; i < 3; i++ {
+		if c := scaled.RGBAAt(i*2, i*2+1); c != white {
+			t.Errorf("Pixel %v,%v is %v, expected %v", i*2, i*2+1, c, white)
+		}
+
+		if c := scaled.RGBAAt(i*2+1, i*2); c != black {
+			t.Errorf("Pixel %v,%v is %v, expected %v", i*2+1, i*2, c, black)
+		}
+	}
+}
+
+func TestScanlinesEffect(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 4, 480))
+
+	for i := range frame.Pix {
+		frame.Pix[i] = 0xff
+	}
+
+	frame = (&ScanlinesEffect{Intensity: 0.5}).Apply(frame)
+
+	if c := frame.RGBAAt(0, 2); c != white {
+		t.Errorf("Top of scanline is %v, expected %v", c, white)
+	}
+
+	if c, expected := frame.RGBAAt(0, 3), (color.RGBA{0x7f, 0x7f, 0x7f, 0xff}); c != expected {
+		t.Errorf("Bottom of scanline is %v, expected %v", c, expected)
+	}
+}
+
+func TestFrameBlendEffect(t *testing.T) {
+	effect := &FrameBlendEffect{}
+
+	first := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	first.SetRGBA(0, 0, white)
+
+	if c := effect.Apply(first).RGBAAt(0, 0); c != white {
+		t.Errorf("First frame is %v, expected %v", c, white)
+	}
+
+	second := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	second.SetRGBA(0, 0, black)
+
+	if c, expected := effect.Apply(second).RGBAAt(0, 0), (color.RGBA{0x80, 0x80, 0x80, 0xff}); c != expected {
+		t.Errorf("Second frame is %v, expected %v", c, expected)
+	}
+}
+
+func benchmarkScaler(b *testing.B, name string) {
+	scaler, _ := NewScaler(name)
+
+	colors := make([]uint16, 0xf000)
+
+	for i := range colors {
+		colors[i] = uint16(i/3*7) & 0x3f
+	}
+
+	frame := NewPaletteFilter(EmphasisPalette).Filter(colors)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		scaler.Apply(frame)
+	}
+}
+
+func BenchmarkScale2xScaler(b *testing.B) {
+	benchmarkScaler(b, "scale2x")
+}
@@ -6,23 +6,32 @@ package nes
 
 import (
 	"errors"
+	"sync/atomic"
+	"time"
 
 	"github.com/scottferg/Go-SDL/sdl"
 	sdl_audio "github.com/scottferg/Go-SDL/sdl/audio"
 )
 
 type SDLAudio struct {
-	paused  bool
-	spec    sdl_audio.AudioSpec
-	samples []int16
-	input   chan int16
+	paused    bool
+	frequency int
+	channels  int
+	spec      sdl_audio.AudioSpec
+	samples   []int16
+	input     chan []int16
+
+	// the samples not yet sent to SDL and when SDL was last sent
+	// samples, for Buffered
+	pending int64
+	sent    int64
 }
 
-func NewAudio(frequency int, sampleSize int) (audio *SDLAudio, err error) {
+func NewAudio(frequency, channels, sampleSize int) (audio *SDLAudio, err error) {
 	spec := sdl_audio.AudioSpec{
 		Freq:        frequency,
 		Format:      sdl_audio.AUDIO_S16SYS,
-		Channels:    1,
+		Channels:    uint8(channels),
 		Out_Silence: 0,
 		Samples:     uint16(sampleSize),
 		Out_Size:    0,
@@ -36,14 +45,16 @@ func NewAudio(frequency int, sampleSize int) (audio *SDLAudio, err error) {
 	sdl_audio.PauseAudio(false)
 
 	audio = &SDLAudio{
-		samples: make([]int16, sampleSize),
-		input:   make(chan int16),
+		frequency: frequency,
+		channels:  channels,
+		samples:   make([]int16, sampleSize*channels),
+		input:     make(chan []int16),
 	}
 
 	return
 }
 
-func (audio *SDLAudio) Input() chan int16 {
+func (audio *SDLAudio) Input() chan []int16 {
 	return audio.input
 }
 
@@ -52,17 +63,41 @@ func (audio *SDLAudio) Run() {
 
 	for {
 		select {
-		case s := <-audio.input:
-			audio.samples[i] = s
-
-			if i++; i == len(audio.samples) {
-				sdl_audio.SendAudio_int16(audio.samples)
-				i = 0
+		case samples := <-audio.input:
+			for len(samples) != 0 {
+				n := copy(audio.samples[i:], samples)
+				samples = samples[n:]
+
+				if i += n; i == len(audio.samples) {
+					sdl_audio.SendAudio_int16(audio.samples)
+					atomic.StoreInt64(&audio.sent, time.Now().UnixNano())
+					i = 0
+				}
 			}
+
+			atomic.StoreInt64(&audio.pending, int64(i))
 		}
 	}
 }
 
+// Since SDL doesn't say how much it has left to play, this counts
+// the samples not yet sent to it and those of the last buffer sent
+// that the time since it was sent can't have played yet.
+func (audio *SDLAudio) Buffered() (samples, size int) {
+	frames := len(audio.samples) / audio.channels
+	samples = int(atomic.LoadInt64(&audio.pending)) / audio.channels
+
+	if sent := atomic.LoadInt64(&audio.sent); sent != 0 {
+		played := int(time.Since(time.Unix(0, sent)).Seconds() * float64(audio.frequency))
+
+		if played < frames {
+			samples += frames - played
+		}
+	}
+
+	return samples, 2 * frames
+}
+
 func (audio *SDLAudio) TogglePaused() {
 	audio.paused = !audio.paused
 	sdl_audio.PauseAudio(audio.paused)
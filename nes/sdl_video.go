@@ -5,6 +5,7 @@ package nes
 import (
 	"errors"
 	"fmt"
+	"image"
 	"math"
 	"unsafe"
 
@@ -13,46 +14,24 @@ import (
 	"github.com/scottferg/Go-SDL/sdl"
 )
 
-var SDLPalette []uint32 = []uint32{
-	0x666666, 0x002A88, 0x1412A7, 0x3B00A4, 0x5C007E,
-	0x6E0040, 0x6C0600, 0x561D00, 0x333500, 0x0B4800,
-	0x005200, 0x004F08, 0x00404D, 0x000000, 0x000000,
-	0x000000, 0xADADAD, 0x155FD9, 0x4240FF, 0x7527FE,
-	0xA01ACC, 0xB71E7B, 0xB53120, 0x994E00, 0x6B6D00,
-	0x388700, 0x0C9300, 0x008F32, 0x007C8D, 0x000000,
-	0x000000, 0x000000, 0xFFFEFF, 0x64B0FF, 0x9290FF,
-	0xC676FF, 0xF36AFF, 0xFE6ECC, 0xFE8170, 0xEA9E22,
-	0xBCBE00, 0x88D800, 0x5CE430, 0x45E082, 0x48CDDE,
-	0x4F4F4F, 0x000000, 0x000000, 0xFFFEFF, 0xC0DFFF,
-	0xD3D2FF, 0xE8C8FF, 0xFBC2FF, 0xFEC4EA, 0xFECCC5,
-	0xF7D8A5, 0xE4E594, 0xCFEF96, 0xBDF4AB, 0xB3F3CC,
-	0xB5EBF2, 0xB8B8B8, 0x000000, 0x000000,
-}
-
 type SDLVideo struct {
-	input         chan []uint8
+	input         chan *image.RGBA
 	screen        *sdl.Surface
 	prog          gl.Program
 	texture       gl.Texture
 	width, height int
 	textureUni    gl.AttribLocation
-	palette       []uint32
 	events        chan Event
 	overscan      bool
 }
 
 func NewVideo(caption string, events chan Event) (video *SDLVideo, err error) {
 	video = &SDLVideo{
-		input:    make(chan []uint8),
+		input:    make(chan *image.RGBA),
 		events:   events,
-		palette:  SDLPalette,
 		overscan: true,
 	}
 
-	for i, _ := range video.palette {
-		video.palette[i] <<= 8
-	}
-
 	if sdl.Init(sdl.INIT_VIDEO|sdl.INIT_JOYSTICK|sdl.INIT_AUDIO) != 0 {
 		err = errors.New(sdl.GetError())
 		return
@@ -201,33 +180,12 @@ func (video *SDLVideo) Reshape(width int, height int) {
 	gl.Viewport(x_offset, y_offset, width, height)
 }
 
-func (video *SDLVideo) Input() chan []uint8 {
+func (video *SDLVideo) Input() chan *image.RGBA {
 	return video.input
 }
 
-func (video *SDLVideo) frameWidth() int {
-	width := 256
-
-	if video.overscan {
-		width -= 16
-	}
-
-	return width
-}
-
-func (video *SDLVideo) frameHeight() int {
-	height := 240
-
-	if video.overscan {
-		height -= 16
-	}
-
-	return height
-}
-
 func (video *SDLVideo) Run() {
 	running := true
-	frame := make([]uint32, 0xf000)
 
 	for running {
 		select {
@@ -264,6 +222,10 @@ func (video *SDLVideo) Run() {
 					if e.Type == sdl.KEYDOWN {
 						video.ResizeEvent(2560, 1440)
 					}
+				case sdl.K_c:
+					if e.Type == sdl.KEYDOWN {
+						event = &PaletteEvent{}
+					}
 				case sdl.K_p:
 					if e.Type == sdl.KEYDOWN {
 						event = &PauseEvent{}
@@ -318,6 +280,10 @@ func (video *SDLVideo) Run() {
 					if e.Type == sdl.KEYDOWN {
 						event = &ShowSpritesEvent{}
 					}
+				case sdl.K_8:
+					if e.Type == sdl.KEYDOWN {
+						event = &NoSpriteLimitEvent{}
+					}
 				case sdl.K_F1:
 					if e.Type == sdl.KEYDOWN {
 						event = &SaveStateEvent{}
@@ -379,24 +345,8 @@ func (video *SDLVideo) Run() {
 			if event != nil {
 				go func() { video.events <- event }()
 			}
-		case colors := <-video.input:
-			index := 0
-			x, y := 0, 0
-
-			for _, c := range colors {
-				if pixelInFrame(x, y, video.overscan) {
-					frame[index] = video.palette[c]
-					index++
-				}
-
-				switch x {
-				case 255:
-					x = 0
-					y++
-				default:
-					x++
-				}
-			}
+		case frame := <-video.input:
+			pix, width, height := overscanPixels(frame, video.overscan)
 
 			gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 
@@ -405,8 +355,8 @@ func (video *SDLVideo) Run() {
 			gl.ActiveTexture(gl.TEXTURE0)
 			video.texture.Bind(gl.TEXTURE_2D)
 
-			gl.TexImage2D(gl.TEXTURE_2D, 0, 3, video.frameWidth(), video.frameHeight(), 0, gl.RGBA,
-				gl.UNSIGNED_INT_8_8_8_8, frame)
+			gl.TexImage2D(gl.TEXTURE_2D, 0, 3, width, height, 0, gl.RGBA,
+				gl.UNSIGNED_BYTE, pix)
 
 			gl.DrawArrays(gl.TRIANGLES, 0, 6)
 
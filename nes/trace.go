@@ -0,0 +1,175 @@
+package nes
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/nwidger/nintengo/rp2cgo2"
+)
+
+type TraceFormat uint8
+
+const (
+	// A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+	NestestTrace TraceFormat = iota
+	// A:00 X:00 Y:00 P:24 SP:FD CYC:  0 SL:241
+	NintendulatorTrace
+)
+
+func ParseTraceFormat(name string) (format TraceFormat, err error) {
+	switch name {
+	case "", "nestest":
+		format = NestestTrace
+	case "nintendulator":
+		format = NintendulatorTrace
+	default:
+		err = errors.New(fmt.Sprintf("Unknown trace format %v, must be nestest or nintendulator", name))
+	}
+
+	return
+}
+
+// Writes the CPU's decoded instructions to a file along with the
+// PPU's position and the CPU cycle count, so that the result can be
+// diffed against the logs of other emulators.  Instructions are only
+// written while the PPU's frame is within [StartFrame, StopFrame],
+// once the PC has reached Trigger and while the PC is within [LowPC,
+// HighPC].
+type Tracer struct {
+	lock   sync.Mutex
+	file   *os.File
+	gz     *gzip.Writer
+	w      *bufio.Writer
+	ppu    *rp2cgo2.RP2C02
+	format TraceFormat
+
+	StartFrame int
+	StopFrame  int
+	LowPC      uint16
+	HighPC     uint16
+	Trigger    int
+	triggered  bool
+}
+
+// Returns a new Tracer writing to filename, which is gzip-compressed
+// if filename ends in '.gz'.  The tracer writes every instruction
+// until its conditions are changed.
+func NewTracer(filename string, format TraceFormat, ppu *rp2cgo2.RP2C02) (tracer *Tracer, err error) {
+	var w io.Writer
+
+	tracer = &Tracer{
+		ppu:        ppu,
+		format:     format,
+		StartFrame: 0,
+		StopFrame:  -1,
+		LowPC:      0x0000,
+		HighPC:     0xffff,
+		Trigger:    -1,
+	}
+
+	if tracer.file, err = os.Create(filename); err != nil {
+		tracer = nil
+		return
+	}
+
+	w = tracer.file
+
+	if strings.HasSuffix(filename, ".gz") {
+		tracer.gz = gzip.NewWriter(w)
+		w = tracer.gz
+	}
+
+	tracer.w = bufio.NewWriterSize(w, 1<<16)
+
+	return
+}
+
+func (tracer *Tracer) active(pc uint16) bool {
+	frame := int(tracer.ppu.Frame)
+
+	if frame < tracer.StartFrame ||
+		(tracer.StopFrame >= 0 && frame > tracer.StopFrame) {
+		return false
+	}
+
+	if !tracer.triggered {
+		if tracer.Trigger >= 0 && int(pc) != tracer.Trigger {
+			return false
+		}
+
+		tracer.triggered = true
+	}
+
+	return pc >= tracer.LowPC && pc <= tracer.HighPC
+}
+
+// Returns whether the instruction at pc is written to the trace,
+// suitable for passing to M6502.SetTrace so that only those
+// instructions are decoded.
+func (tracer *Tracer) Tracing(pc uint16) bool {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	return tracer.w != nil && tracer.active(pc)
+}
+
+// Writes a decoded instruction to the trace, suitable for passing to
+// M6502.SetTrace along with Tracing.
+func (tracer *Tracer) Trace(pc uint16, line string, ticks uint64) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	if tracer.w == nil {
+		return
+	}
+
+	scanline := int(tracer.ppu.Scanline)
+
+	if scanline == rp2cgo2.NUM_SCANLINES-1 {
+		scanline = -1
+	}
+
+	tracer.w.WriteString(line)
+
+	switch tracer.format {
+	case NestestTrace:
+		fmt.Fprintf(tracer.w, " PPU:%3d,%3d CYC:%d\n", scanline, tracer.ppu.Cycle, ticks)
+	case NintendulatorTrace:
+		fmt.Fprintf(tracer.w, " CYC:%3d SL:%d\n", tracer.ppu.Cycle, scanline)
+	}
+}
+
+// Flushes any buffered trace output and closes the trace file.
+func (tracer *Tracer) Close() (err error) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	if tracer.w == nil {
+		return
+	}
+
+	// close everything even if flushing fails, returning the
+	// first error
+	first := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+
+	first(tracer.w.Flush())
+	tracer.w = nil
+
+	if tracer.gz != nil {
+		first(tracer.gz.Close())
+	}
+
+	first(tracer.file.Close())
+
+	return
+}
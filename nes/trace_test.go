@@ -0,0 +1,188 @@
+package nes
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nwidger/nintengo/rp2cgo2"
+)
+
+// Returns a tracer writing to filename in dir, along with the PPU
+// whose position it writes.
+func newTestTracer(t *testing.T, dir, filename string, format TraceFormat) (*Tracer, *rp2cgo2.RP2C02) {
+	ppu := rp2cgo2.NewRP2C02(nil)
+
+	tracer, err := NewTracer(filepath.Join(dir, filename), format, ppu)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tracer, ppu
+}
+
+// Closes tracer and returns the lines it wrote to filename in dir.
+func readTestTrace(t *testing.T, tracer *Tracer, dir, filename string) []string {
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, filename))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+}
+
+func TestTraceFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		format   TraceFormat
+		expected []string
+	}{
+		{NestestTrace, []string{
+			"C000 PPU:241, 21 CYC:7",
+			"C001 PPU: -1,340 CYC:29781",
+		}},
+		{NintendulatorTrace, []string{
+			"C000 CYC: 21 SL:241",
+			"C001 CYC:340 SL:-1",
+		}},
+	} {
+		tracer, ppu := newTestTracer(t, dir, "trace.log", test.format)
+
+		ppu.Scanline, ppu.Cycle = 241, 21
+		tracer.Trace(0xc000, "C000", 7)
+
+		// the pre-render scanline is written as -1
+		ppu.Scanline, ppu.Cycle = rp2cgo2.NUM_SCANLINES-1, 340
+		tracer.Trace(0xc001, "C001", 29781)
+
+		lines := readTestTrace(t, tracer, dir, "trace.log")
+
+		if strings.Join(lines, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("Format %v wrote %q not %q", test.format, lines, test.expected)
+		}
+	}
+}
+
+func TestTraceConditions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tracer, ppu := newTestTracer(t, dir, "trace.log", NestestTrace)
+
+	tracer.StartFrame = 2
+	tracer.StopFrame = 3
+	tracer.LowPC = 0x8000
+	tracer.HighPC = 0xbfff
+	tracer.Trigger = 0x9000
+
+	traced := []uint16{}
+
+	for _, step := range []struct {
+		frame uint16
+		pc    uint16
+	}{
+		// before StartFrame
+		{1, 0x9000},
+		// before the trigger
+		{2, 0x8000},
+		{2, 0x9000},
+		{2, 0x8000},
+		// outside [LowPC, HighPC]
+		{2, 0xc000},
+		{2, 0x7fff},
+		{3, 0xbfff},
+		// after StopFrame
+		{4, 0x9000},
+	} {
+		ppu.Frame = step.frame
+
+		if tracer.Tracing(step.pc) {
+			traced = append(traced, step.pc)
+		}
+	}
+
+	expected := []uint16{0x9000, 0x8000, 0xbfff}
+
+	if len(traced) != len(expected) {
+		t.Fatalf("Traced %04X not %04X", traced, expected)
+	}
+
+	for i := range traced {
+		if traced[i] != expected[i] {
+			t.Errorf("Traced %04X not %04X", traced, expected)
+			break
+		}
+	}
+
+	if tracer.Close(); tracer.Tracing(0x9000) {
+		t.Error("Tracing after Close")
+	}
+}
+
+func TestTraceGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tracer, ppu := newTestTracer(t, dir, "trace.log.gz", NintendulatorTrace)
+	ppu.Scanline, ppu.Cycle = 0, 0
+
+	for i := 0; i < 1000; i++ {
+		tracer.Trace(0xc000, "C000", uint64(i))
+	}
+
+	if err = tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "trace.log.gz"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadAll(gz)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+
+	if len(lines) != 1000 || lines[999] != "C000 CYC:  0 SL:0" {
+		t.Errorf("Read %v lines ending with %q", len(lines), lines[len(lines)-1])
+	}
+}
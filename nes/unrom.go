@@ -34,38 +34,30 @@ func (unrom *UNROM) String() string {
 		fmt.Sprintf("Mapper: 2 (UNROM)")
 }
 
-func (unrom *UNROM) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
-	fetch = []uint16{}
-	store = []uint16{}
+func (unrom *UNROM) Ranges(which rp2ago3.Mapping) (fetch, store []rp2ago3.Range) {
+	fetch = []rp2ago3.Range{}
+	store = []rp2ago3.Range{}
 
 	switch which {
 	case rp2ago3.PPU:
 		if unrom.ROMFile.chrBanks > 0 {
 			// CHR bank 1
-			for i := uint32(0x0000); i <= 0x0fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
+			store = append(store, rp2ago3.Range{Start: 0x0000, End: 0x0fff})
 
 			// CHR bank 2
-			for i := uint32(0x1000); i <= 0x1fff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
+			store = append(store, rp2ago3.Range{Start: 0x1000, End: 0x1fff})
 		}
 	case rp2ago3.CPU:
 		if unrom.ROMFile.prgBanks > 0 {
 			// PRG bank 1
-			for i := uint32(0x8000); i <= 0xbfff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0x8000, End: 0xbfff})
+			store = append(store, rp2ago3.Range{Start: 0x8000, End: 0xbfff})
 
 			// PRG bank 2
-			for i := uint32(0xc000); i <= 0xffff; i++ {
-				fetch = append(fetch, uint16(i))
-				store = append(store, uint16(i))
-			}
+			fetch = append(fetch, rp2ago3.Range{Start: 0xc000, End: 0xffff})
+			store = append(store, rp2ago3.Range{Start: 0xc000, End: 0xffff})
 		}
 	}
 
@@ -120,3 +112,31 @@ func (unrom *UNROM) Store(address uint16, value uint8) (oldValue uint8) {
 
 	return
 }
+
+func (unrom *UNROM) PRGOffset(address uint16) (offset int) {
+	offset = -1
+	index := address & 0x3fff
+
+	switch {
+	// PRG bank 1
+	case address >= 0x8000 && address <= 0xbfff:
+		offset = unrom.ROMFile.prgOffset(int(unrom.Registers.BankSelect), index)
+	// PRG bank 2
+	case address >= 0xc000 && address <= 0xffff:
+		offset = unrom.ROMFile.prgOffset(int(unrom.ROMFile.prgBanks)-1, index)
+	}
+
+	return
+}
+
+func (unrom *UNROM) CHROffset(address uint16) (offset int) {
+	offset = -1
+
+	switch {
+	// CHR banks 1 & 2
+	case address >= 0x0000 && address <= 0x1fff:
+		offset = unrom.ROMFile.chrOffset(0, address)
+	}
+
+	return
+}
@@ -5,13 +5,15 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/color/palette"
+	"image/draw"
 	"image/gif"
 	"image/jpeg"
 	"os"
 )
 
 type Video interface {
-	Input() chan []uint8
+	Input() chan *image.RGBA
 	Events() chan Event
 	Run()
 }
@@ -83,8 +85,99 @@ var RGBAPalette []color.Color = []color.Color{
 	color.RGBA{0x00, 0x00, 0x00, 0xff},
 }
 
+// How much each emphasis bit attenuates the colour channels it does
+// not emphasize.
+const EMPHASIS_ATTENUATION = 0.746
+
+// RGBAPalette expanded to every combination of emphasis bits, indexed
+// by the 9-bit pixels the PPU outputs.
+var EmphasisPalette []color.Color = ExpandPalette(RGBAPalette)
+
+// Expands a 64-entry palette to the 512 entries indexed by 9-bit
+// pixels, whose bits 6-8 emphasize red, green and blue by attenuating
+// the other two channels.  Colours $xE and $xF are black and are left
+// unchanged.
+func ExpandPalette(palette []color.Color) (expanded []color.Color) {
+	expanded = make([]color.Color, 512)
+
+	for i := range expanded {
+		c := color.RGBAModel.Convert(palette[i&0x3f]).(color.RGBA)
+		emphasis := i >> 6
+
+		if i&0x0e != 0x0e {
+			rgb := []*uint8{&c.R, &c.G, &c.B}
+
+			for bit := uint(0); bit < 3; bit++ {
+				if emphasis&(1<<bit) == 0 {
+					continue
+				}
+
+				for channel, v := range rgb {
+					if uint(channel) != bit {
+						*v = uint8(float64(*v) * EMPHASIS_ATTENUATION)
+					}
+				}
+			}
+		}
+
+		expanded[i] = c
+	}
+
+	return
+}
+
+// Returns a paletted image of frame.  Frames of at most 256 colours
+// are converted exactly, others are dithered to the Plan 9 palette.
+func palettedFrame(frame *image.RGBA) (paletted *image.Paletted) {
+	paletted = image.NewPaletted(frame.Bounds(), color.Palette{})
+	indices := make(map[color.RGBA]uint8)
+
+	for i := range paletted.Pix {
+		c := color.RGBA{frame.Pix[i*4], frame.Pix[i*4+1], frame.Pix[i*4+2], frame.Pix[i*4+3]}
+		index, ok := indices[c]
+
+		if !ok {
+			if len(paletted.Palette) == 256 {
+				paletted.Palette = palette.Plan9
+				draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), frame, image.ZP)
+				return
+			}
+
+			index = uint8(len(paletted.Palette))
+			paletted.Palette = append(paletted.Palette, c)
+			indices[c] = index
+		}
+
+		paletted.Pix[i] = index
+	}
+
+	return
+}
+
+// Returns the pixels of frame as rows of RGBA values.  If overscan is
+// set the 8 of 240 rows and the 8 of 256 columns at each edge of the
+// picture that a television would hide are cropped.
+func overscanPixels(frame *image.RGBA, overscan bool) (pix []uint8, width, height int) {
+	bounds := frame.Bounds()
+
+	if overscan {
+		dx, dy := bounds.Dx()*8/256, bounds.Dy()*8/240
+		bounds = image.Rect(bounds.Min.X+dx, bounds.Min.Y+dy, bounds.Max.X-dx, bounds.Max.Y-dy)
+	}
+
+	width, height = bounds.Dx(), bounds.Dy()
+	pix = make([]uint8, width*height*4)
+
+	for y := 0; y < height; y++ {
+		offset := frame.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+		copy(pix[y*width*4:(y+1)*width*4], frame.Pix[offset:offset+width*4])
+	}
+
+	return
+}
+
 type Recorder interface {
-	Input() chan []uint8
+	Input() chan *image.RGBA
 	Record()
 	Stop()
 	Quit()
@@ -92,25 +185,23 @@ type Recorder interface {
 }
 
 type JPEGRecorder struct {
-	frame     *image.Paletted
-	palette   []color.Color
-	input     chan []uint8
+	frame     *image.RGBA
+	input     chan *image.RGBA
 	recording bool
 	stop      chan uint8
 }
 
 func NewJPEGRecorder() (video *JPEGRecorder, err error) {
 	video = &JPEGRecorder{
-		frame:   nil,
-		input:   make(chan []uint8),
-		palette: RGBAPalette,
-		stop:    make(chan uint8),
+		frame: nil,
+		input: make(chan *image.RGBA),
+		stop:  make(chan uint8),
 	}
 
 	return
 }
 
-func (video *JPEGRecorder) Input() chan []uint8 {
+func (video *JPEGRecorder) Input() chan *image.RGBA {
 	return video.input
 }
 
@@ -122,11 +213,11 @@ func (video *JPEGRecorder) Record() {
 		fmt.Println("*** Screenshot saved")
 	}
 
-	video.frame = image.NewPaletted(image.Rect(0, 0, 256, 240), video.palette)
+	video.frame = image.NewRGBA(image.Rect(0, 0, 256, 240))
 }
 
 func (video *JPEGRecorder) Stop() {
-	video.frame = image.NewPaletted(image.Rect(0, 0, 256, 240), video.palette)
+	video.frame = image.NewRGBA(image.Rect(0, 0, 256, 240))
 }
 
 func (video *JPEGRecorder) Quit() {
@@ -135,28 +226,16 @@ func (video *JPEGRecorder) Quit() {
 }
 
 func (video *JPEGRecorder) Run() {
-	video.frame = image.NewPaletted(image.Rect(0, 0, 256, 240), video.palette)
+	video.frame = image.NewRGBA(image.Rect(0, 0, 256, 240))
 
 	for {
 		select {
-		case colors := <-video.input:
+		case frame := <-video.input:
 			if video.frame == nil {
 				continue
 			}
 
-			x, y := 0, 0
-
-			for _, c := range colors {
-				video.frame.Set(x, y, video.palette[c])
-
-				switch x {
-				case 255:
-					x = 0
-					y++
-				default:
-					x++
-				}
-			}
+			video.frame = frame
 		case <-video.stop:
 			video.stop <- 1
 			break
@@ -165,24 +244,22 @@ func (video *JPEGRecorder) Run() {
 }
 
 type GIFRecorder struct {
-	gif     *gif.GIF
-	palette []color.Color
-	input   chan []uint8
-	stop    chan uint8
+	gif   *gif.GIF
+	input chan *image.RGBA
+	stop  chan uint8
 }
 
 func NewGIFRecorder() (video *GIFRecorder, err error) {
 	video = &GIFRecorder{
-		gif:     nil,
-		input:   make(chan []uint8),
-		palette: RGBAPalette,
-		stop:    make(chan uint8),
+		gif:   nil,
+		input: make(chan *image.RGBA),
+		stop:  make(chan uint8),
 	}
 
 	return
 }
 
-func (video *GIFRecorder) Input() chan []uint8 {
+func (video *GIFRecorder) Input() chan *image.RGBA {
 	return video.input
 }
 
@@ -216,28 +293,12 @@ func (video *GIFRecorder) Quit() {
 func (video *GIFRecorder) Run() {
 	for {
 		select {
-		case colors := <-video.input:
+		case frame := <-video.input:
 			if video.gif == nil {
 				continue
 			}
 
-			frame := image.NewPaletted(image.Rect(0, 0, 256, 240), video.palette)
-
-			x, y := 0, 0
-
-			for _, c := range colors {
-				frame.Set(x, y, video.palette[c])
-
-				switch x {
-				case 255:
-					x = 0
-					y++
-				default:
-					x++
-				}
-			}
-
-			video.gif.Image = append(video.gif.Image, frame)
+			video.gif.Image = append(video.gif.Image, palettedFrame(frame))
 			video.gif.Delay = append(video.gif.Delay, 3)
 		case <-video.stop:
 			video.stop <- 1
@@ -245,7 +306,3 @@ func (video *GIFRecorder) Run() {
 		}
 	}
 }
-
-func pixelInFrame(x, y int, overscan bool) bool {
-	return !overscan || (y >= 8 && y <= 231 && x >= 8 && x <= 247)
-}
@@ -0,0 +1,63 @@
+package nes
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestExpandPalette(t *testing.T) {
+	palette := make([]color.Color, 64)
+
+	for i := range palette {
+		palette[i] = color.RGBA{0x80, 0x80, 0x80, 0xff}
+	}
+
+	expanded := ExpandPalette(palette)
+
+	if len(expanded) != 512 {
+		t.Fatalf("Expanded palette has %v entries, expected 512", len(expanded))
+	}
+
+	for _, v := range []struct {
+		pixel uint16
+		c     color.RGBA
+	}{
+		{0x000, color.RGBA{0x80, 0x80, 0x80, 0xff}},
+		{0x040, color.RGBA{0x80, 0x5f, 0x5f, 0xff}},
+		{0x080, color.RGBA{0x5f, 0x80, 0x5f, 0xff}},
+		{0x100, color.RGBA{0x5f, 0x5f, 0x80, 0xff}},
+		{0x0c0, color.RGBA{0x5f, 0x5f, 0x46, 0xff}},
+		{0x1cf, color.RGBA{0x80, 0x80, 0x80, 0xff}},
+	} {
+		if c := expanded[v.pixel]; c != v.c {
+			t.Errorf("Pixel %03X is %v, expected %v", v.pixel, c, v.c)
+		}
+	}
+}
+
+func TestPalettedFrame(t *testing.T) {
+	colors := make([]uint16, 0xf000)
+
+	for i := range colors {
+		colors[i] = uint16(i % 200)
+	}
+
+	frame := palettedFrame(NewPaletteFilter(EmphasisPalette).Filter(colors))
+
+	if len(frame.Palette) > 200 {
+		t.Errorf("Frame palette has %v entries, expected at most 200", len(frame.Palette))
+	}
+
+	if r, g, b, _ := frame.At(0x10, 0).RGBA(); color.RGBAModel.Convert(EmphasisPalette[0x10]) != (color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 0xff}) {
+		t.Errorf("Pixel is %v, expected %v", frame.At(0x10, 0), EmphasisPalette[0x10])
+	}
+
+	for i := range colors {
+		colors[i] = uint16(i % 512)
+	}
+
+	// too many colours are dithered
+	if frame = palettedFrame(NewPaletteFilter(EmphasisPalette).Filter(colors)); len(frame.Palette) != 256 {
+		t.Errorf("Frame palette has %v entries, expected 256", len(frame.Palette))
+	}
+}
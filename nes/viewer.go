@@ -0,0 +1,132 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/nwidger/nintengo/rp2cgo2"
+)
+
+// The nametables as the PPU saw them at a scanline.
+type NametableCapture struct {
+	// the four nametables at 512x480, as returned by the PPU's
+	// Nametables
+	Frame *image.RGBA
+	// the area of Frame shown on screen, as returned by the PPU's
+	// ScrollRect
+	Scroll   image.Rectangle
+	Scanline int
+}
+
+type nametableRequest struct {
+	scanline int
+	result   chan *NametableCapture
+}
+
+// Returns an image of the given 9-bit pixels in the current palette.
+func (nes *NES) paletteImage(colors []uint16, width, height int) *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for i, c := range colors {
+		rgba := color.RGBAModel.Convert(nes.palette[c]).(color.RGBA)
+		frame.Pix[i*4], frame.Pix[i*4+1], frame.Pix[i*4+2], frame.Pix[i*4+3] = rgba.R, rgba.G, rgba.B, 0xff
+	}
+
+	return frame
+}
+
+// Returns the picture the PPU is drawing in the current palette.
+// Scanlines it has not reached yet still show the last frame.
+func (nes *NES) Screen() *image.RGBA {
+	return nes.paletteImage(nes.PPU.Colors(), 256, 240)
+}
+
+func (nes *NES) nametables() *NametableCapture {
+	return &NametableCapture{
+		Frame:    nes.paletteImage(nes.PPU.Nametables(), 512, 480),
+		Scroll:   nes.PPU.ScrollRect(),
+		Scanline: int(nes.PPU.Scanline),
+	}
+}
+
+// Returns the nametables once the PPU reaches the start of the given
+// scanline, so that the scroll of each part of a split screen can be
+// seen.  They are captured immediately if the scanline is negative or
+// the NES is not running.
+func (nes *NES) CaptureNametables(scanline int) *NametableCapture {
+	if scanline < 0 || nes.state != Running {
+		return nes.nametables()
+	}
+
+	request := &nametableRequest{
+		scanline: scanline % rp2cgo2.NUM_SCANLINES,
+		result:   make(chan *NametableCapture, 1),
+	}
+
+	select {
+	case nes.captures <- request:
+	default:
+		return nes.nametables()
+	}
+
+	select {
+	case capture := <-request.result:
+		return capture
+	case <-time.After(time.Second):
+		return nes.nametables()
+	}
+}
+
+// Completes the pending request for the nametables if the PPU has
+// just reached its scanline.
+func (nes *NES) captureNametables() {
+	if nes.capture == nil {
+		select {
+		case nes.capture = <-nes.captures:
+		default:
+			return
+		}
+	}
+
+	if int(nes.PPU.Scanline) == nes.capture.scanline {
+		nes.capture.result <- nes.nametables()
+		nes.capture = nil
+	}
+}
+
+// Draws the outline of the area shown on screen onto Frame, wrapping
+// it around the edges of the nametables.
+func (capture *NametableCapture) DrawScroll(c color.Color) {
+	bounds := capture.Frame.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	scroll := capture.Scroll
+
+	set := func(x, y int) {
+		capture.Frame.Set(x%width, y%height, c)
+	}
+
+	for x := scroll.Min.X; x < scroll.Max.X; x++ {
+		set(x, scroll.Min.Y)
+		set(x, scroll.Max.Y-1)
+	}
+
+	for y := scroll.Min.Y; y < scroll.Max.Y; y++ {
+		set(scroll.Min.X, y)
+		set(scroll.Max.X-1, y)
+	}
+}
+
+// Returns an image of a sprite in the current palette with its
+// transparent pixels left transparent.
+func (nes *NES) SpriteImage(sprite rp2cgo2.OAMSprite) *image.RGBA {
+	frame := nes.paletteImage(sprite.Colors, 8, sprite.Height)
+
+	for i, index := range sprite.Indexes {
+		if index == 0 {
+			frame.Pix[i*4], frame.Pix[i*4+1], frame.Pix[i*4+2], frame.Pix[i*4+3] = 0, 0, 0, 0
+		}
+	}
+
+	return frame
+}
@@ -0,0 +1,32 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDrawScroll(t *testing.T) {
+	outline := color.RGBA{0xff, 0x00, 0xff, 0xff}
+
+	capture := &NametableCapture{
+		Frame:  image.NewRGBA(image.Rect(0, 0, 512, 480)),
+		Scroll: image.Rect(400, 300, 656, 540),
+	}
+
+	capture.DrawScroll(outline)
+
+	for _, p := range []image.Point{
+		{400, 300}, {511, 300}, {0, 300}, {143, 300},
+		{400, 479}, {400, 0}, {400, 59},
+		{143, 59}, {143, 400},
+	} {
+		if c := capture.Frame.RGBAAt(p.X, p.Y); c != outline {
+			t.Errorf("Pixel %v is %v, expected the outline", p, c)
+		}
+	}
+
+	if c := capture.Frame.RGBAAt(200, 200); c == outline {
+		t.Error("Pixel outside the outline was drawn")
+	}
+}
@@ -0,0 +1,163 @@
+package nes
+
+import "image"
+
+// Scales frames by 2 with Hyllian's xBR level 2, as in libxbr.  Each
+// corner of a pixel whose two adjacent neighbours differ from it is
+// blended with the closer of them when the colour differences along
+// the edge through that corner are smaller than those across it.
+// Level 2 follows shallow and steep edges further, into the subpixels
+// beside the corner.
+type XBRScaler struct{}
+
+// The neighbours xBR compares for the bottom right corner, as offsets
+// from the pixel, and the subpixels it blends: the corner, the one
+// below and the one beside it.
+const (
+	xbrB = iota
+	xbrC
+	xbrD
+	xbrF
+	xbrG
+	xbrH
+	xbrI
+	xbrF4
+	xbrI4
+	xbrH5
+	xbrI5
+	xbrNeighbours
+)
+
+var xbrOffsets = [xbrNeighbours][2]int{
+	xbrB: {0, -1}, xbrC: {1, -1}, xbrD: {-1, 0}, xbrF: {1, 0},
+	xbrG: {-1, 1}, xbrH: {0, 1}, xbrI: {1, 1},
+	xbrF4: {2, 0}, xbrI4: {2, 1}, xbrH5: {0, 2}, xbrI5: {1, 2},
+}
+
+var xbrSubpixels = [3][2]int{{1, 1}, {-1, 1}, {1, -1}}
+
+// The neighbourhood and subpixels rotated so that each other corner is
+// at the bottom right, with the subpixels numbered from the top left
+// across each row.
+var xbrRotations [4][xbrNeighbours][2]int
+var xbrCorners [4][3]int
+
+func init() {
+	rotate := func(u, v, r int) (int, int) {
+		for ; r > 0; r-- {
+			u, v = v, -u
+		}
+
+		return u, v
+	}
+
+	for r := range xbrRotations {
+		for i, o := range xbrOffsets {
+			xbrRotations[r][i][0], xbrRotations[r][i][1] = rotate(o[0], o[1], r)
+		}
+
+		for i, o := range xbrSubpixels {
+			u, v := rotate(o[0], o[1], r)
+			xbrCorners[r][i] = (v+1)/2*2 + (u+1)/2
+		}
+	}
+}
+
+func (scaler *XBRScaler) Apply(frame *image.RGBA) *image.RGBA {
+	p := newPixels(frame)
+	yuv := p.yuv()
+	scaled := image.NewRGBA(image.Rect(0, 0, p.width*2, p.height*2))
+
+	distance := func(a, b int) int {
+		return abs(yuv[a][0]-yuv[b][0]) + abs(yuv[a][1]-yuv[b][1]) + abs(yuv[a][2]-yuv[b][2])
+	}
+
+	similar := func(a, b int) bool {
+		return distance(a, b) < 155
+	}
+
+	var n [xbrNeighbours]int
+
+	// the subpixels from the top left across each row
+	var out [4]uint32
+
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			e := p.index(x, y)
+
+			for i := range out {
+				out[i] = p.pix[e]
+			}
+
+			// the bottom right corner, then the neighbourhood rotated
+			// so that each of the others is at the bottom right
+			for r := range xbrRotations {
+				rotation := &xbrRotations[r]
+				f, h := p.index(x+rotation[xbrF][0], y+rotation[xbrF][1]), p.index(x+rotation[xbrH][0], y+rotation[xbrH][1])
+
+				if p.pix[e] == p.pix[h] || p.pix[e] == p.pix[f] {
+					continue
+				}
+
+				for i, o := range rotation {
+					n[i] = p.index(x+o[0], y+o[1])
+				}
+
+				b, c, d, g, i := n[xbrB], n[xbrC], n[xbrD], n[xbrG], n[xbrI]
+				f4, i4, h5, i5 := n[xbrF4], n[xbrI4], n[xbrH5], n[xbrI5]
+
+				across := distance(e, c) + distance(e, g) + distance(i, h5) + distance(i, f4) + 4*distance(h, f)
+				along := distance(h, d) + distance(h, i5) + distance(f, i4) + distance(f, b) + 4*distance(e, i)
+
+				if across > along {
+					continue
+				}
+
+				px := p.pix[h]
+
+				if distance(e, f) <= distance(e, h) {
+					px = p.pix[f]
+				}
+
+				corner, below, beside := xbrCorners[r][0], xbrCorners[r][1], xbrCorners[r][2]
+
+				if across == along ||
+					!(!similar(f, b) && !similar(h, d) ||
+						similar(e, i) && !similar(f, i4) && !similar(h, i5) ||
+						similar(e, g) || similar(e, c)) {
+					out[corner] = mixPixels(out[corner], px, 128)
+					continue
+				}
+
+				ke, ki := distance(f, g), distance(h, c)
+
+				// the edge runs shallow towards G or steep towards C
+				left := 2*ke <= ki && p.pix[e] != p.pix[g] && p.pix[d] != p.pix[g]
+				up := ke >= 2*ki && p.pix[e] != p.pix[c] && p.pix[b] != p.pix[c]
+
+				switch {
+				case left && up:
+					out[corner] = mixPixels(out[corner], px, 224)
+					out[below] = mixPixels(out[below], px, 64)
+					out[beside] = out[below]
+				case left:
+					out[corner] = mixPixels(out[corner], px, 192)
+					out[below] = mixPixels(out[below], px, 64)
+				case up:
+					out[corner] = mixPixels(out[corner], px, 192)
+					out[beside] = mixPixels(out[beside], px, 64)
+				default:
+					out[corner] = mixPixels(out[corner], px, 128)
+				}
+			}
+
+			o := scaled.PixOffset(x*2, y*2)
+
+			for i, c := range out {
+				putPixel(scaled.Pix[o+(i>>1)*scaled.Stride+(i&0x01)*4:], c)
+			}
+		}
+	}
+
+	return scaled
+}
@@ -0,0 +1,40 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestXBRScaler(t *testing.T) {
+	scaler := &XBRScaler{}
+
+	// the corners either side of a diagonal edge are blended halfway
+	checkSubpixels(t, "Diagonal", scaler.Apply(diagonalFrame(6)), map[image.Point]color.RGBA{
+		{4, 5}: grey(0x7f), {4, 4}: black, {5, 4}: black, {5, 5}: black,
+		{3, 4}: grey(0x7f), {2, 4}: white, {2, 5}: white, {3, 5}: white,
+	})
+
+	// a shallow edge, white below the line through the bottom right of
+	// the pixel at 3, 3 falling one pixel every two to the left, is
+	// followed into the subpixel beside the corner
+	frame := image.NewRGBA(image.Rect(0, 0, 8, 8))
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if 2*(y-3)+(x-3) >= 1 {
+				frame.SetRGBA(x, y, white)
+			} else {
+				frame.SetRGBA(x, y, black)
+			}
+		}
+	}
+
+	checkSubpixels(t, "Shallow", scaler.Apply(frame), map[image.Point]color.RGBA{
+		{6, 6}: black, {7, 6}: black, {6, 7}: grey(0x3f), {7, 7}: grey(0xbf),
+	})
+}
+
+func BenchmarkXBRScaler(b *testing.B) {
+	benchmarkScaler(b, "xbr2x")
+}
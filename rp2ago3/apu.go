@@ -1,5 +1,7 @@
 package rp2ago3
 
+import "math"
+
 type Control uint8
 type Status uint8
 
@@ -118,21 +120,40 @@ type APU struct {
 	DMC          DMC
 	FrameCounter FrameCounter
 
-	Cycles       uint64
-	TargetCycles uint64
+	// mono output, or the left and right outputs with Stereo
+	Outputs      [2]Output
+	cpuFrequency float64
+	sampleRate   int
 
-	HipassStrong int64
-	HipassWeak   int64
-	pulseLUT     [31]float64
-	tndLUT       [203]float64
+	// mix the channels into separate left and right outputs with
+	// the volumes and pans of Channels
+	Stereo   bool                       `json:"-"`
+	Channels [AUDIO_CHANNELS]ChannelMix `json:"-"`
 
-	Interrupt func(state bool) `json:"-"`
-}
+	// the coefficients of the output filters in 16.16 fixed point
+	hipassStrongCoefficient int64
+	hipassWeakCoefficient   int64
+	lowpassCoefficient      int64
 
-func NewAPU(targetCycles uint64, interrupt func(bool)) *APU {
+	pulseLUT [31]float64
+	tndLUT   [203]float64
+
+	Interrupt func(state bool) `json:"-"`
+	// returns the level of a cartridge's expansion audio on the
+	// scale of pulseLUT and tndLUT, where the APU's own channels
+	// together reach about 1
+	Expansion func() float64 `json:"-"`
+	// called with the pre-mix level of each channel, as returned
+	// by Levels, each time Execute produces a sample
+	ChannelLevels func(levels [AUDIO_CHANNELS]float64) `json:"-"`
+}
+
+// Returns a new APU clocked by a CPU running at cpuFrequency and
+// producing sampleRate samples per second.
+func NewAPU(cpuFrequency float64, sampleRate int, interrupt func(bool)) *APU {
 	apu := &APU{
-		TargetCycles: targetCycles,
 		Interrupt:    interrupt,
+		cpuFrequency: cpuFrequency,
 		Pulse1: Pulse{
 			MinusOne: true,
 			Divider: Divider{
@@ -188,11 +209,48 @@ func NewAPU(targetCycles uint64, interrupt func(bool)) *APU {
 		apu.tndLUT[i] = 163.67 / (24329.0/float64(i) + 100.0)
 	}
 
+	for i := range apu.Channels {
+		apu.Channels[i].Volume = 1.0
+	}
+
+	apu.SetSampleRate(sampleRate)
+
 	return apu
 }
 
+// Sets the number of samples per second Execute produces.  The
+// output is filtered like the NES's own audio path, with high-pass
+// filters at 90Hz and 440Hz and a low-pass filter at 14kHz.
+func (apu *APU) SetSampleRate(sampleRate int) {
+	coefficient := func(cutoff float64) int64 {
+		if sampleRate == 0 {
+			return 0
+		}
+
+		return int64(math.Floor((1-math.Exp(-2*math.Pi*cutoff/float64(sampleRate)))*(1<<16) + 0.5))
+	}
+
+	apu.sampleRate = sampleRate
+	apu.AdjustSampleRate(1.0)
+
+	apu.hipassStrongCoefficient = coefficient(440)
+	apu.hipassWeakCoefficient = coefficient(90)
+	apu.lowpassCoefficient = coefficient(14000)
+}
+
+// Makes Execute produce ratio times as many samples per second as
+// the sample rate, to keep pace with an audio device whose clock runs
+// a little faster or slower.
+func (apu *APU) AdjustSampleRate(ratio float64) {
+	for i := range apu.Outputs {
+		apu.Outputs[i].Blip.SetRates(apu.cpuFrequency, float64(apu.sampleRate)*ratio)
+	}
+}
+
 func (apu *APU) Reset() {
-	apu.Cycles = 0
+	for i := range apu.Outputs {
+		apu.Outputs[i].Reset()
+	}
 
 	apu.Registers.Control = 0x00
 	apu.Registers.Status = 0x00
@@ -203,9 +261,6 @@ func (apu *APU) Reset() {
 	apu.Triangle.Reset()
 
 	apu.FrameCounter.Reset()
-
-	apu.HipassStrong = 0.0
-	apu.HipassWeak = 0.0
 }
 
 func (apu *APU) Mappings(which Mapping) (fetch, store []uint16) {
@@ -233,6 +288,32 @@ func (apu *APU) Fetch(address uint16) (value uint8) {
 	return
 }
 
+func (apu *APU) Peek(address uint16) (value uint8) {
+	switch address {
+	// Status
+	case 0x4015:
+		value = uint8(apu.Registers.Status)
+
+		for _, c := range []struct {
+			flag StatusFlag
+			set  bool
+		}{
+			{Pulse1LengthCounterNotZero, apu.Pulse1.LengthCounter > 0},
+			{Pulse2LengthCounterNotZero, apu.Pulse2.LengthCounter > 0},
+			{NoiseLengthCounterNotZero, apu.Noise.LengthCounter > 0},
+			{TriangleLengthCounterNotZero, apu.Triangle.LengthCounter > 0},
+		} {
+			if c.set {
+				value |= uint8(c.flag)
+			} else {
+				value &^= uint8(c.flag)
+			}
+		}
+	}
+
+	return
+}
+
 func (apu *APU) Store(address uint16, value uint8) (oldValue uint8) {
 	switch {
 	// Pulse 1 channel
@@ -307,28 +388,53 @@ func (apu *APU) FetchUpdatedStatus() (value uint8) {
 	return
 }
 
-func (apu *APU) hipassStrong(s int16) int16 {
-	HiPassStrong := int64(225574)
-
-	apu.HipassStrong += (((int64(s) << 16) - (apu.HipassStrong >> 16)) * HiPassStrong) >> 16
-	return int16(int64(s) - (apu.HipassStrong >> 32))
+// Each filter follows the signal by its coefficient's fraction of
+// the distance to it every sample.  The high-pass filters return
+// what the signal has beyond the low-passed part they track.
+func (apu *APU) hipassStrong(out *Output, s int32) int32 {
+	out.HipassStrong += (((int64(s) << 16) - out.HipassStrong) * apu.hipassStrongCoefficient) >> 16
+	return s - int32(out.HipassStrong>>16)
 }
 
-func (apu *APU) hipassWeak(s int16) int16 {
-	HiPassWeak := int64(57593)
+func (apu *APU) hipassWeak(out *Output, s int32) int32 {
+	out.HipassWeak += (((int64(s) << 16) - out.HipassWeak) * apu.hipassWeakCoefficient) >> 16
+	return s - int32(out.HipassWeak>>16)
+}
 
-	apu.HipassWeak += (((int64(s) << 16) - (apu.HipassWeak >> 16)) * HiPassWeak) >> 16
-	return int16(int64(s) - (apu.HipassWeak >> 32))
+func (apu *APU) lowpass(out *Output, s int32) int32 {
+	out.Lowpass += (((int64(s) << 16) - out.Lowpass) * apu.lowpassCoefficient) >> 16
+	return int32(out.Lowpass >> 16)
 }
 
-func (apu *APU) Sample() (sample int16) {
+// Returns the output of the mixer.
+func (apu *APU) Mix() (amplitude int32) {
 	if !apu.Muted {
 		pulse := apu.pulseLUT[apu.Pulse1.Sample()+apu.Pulse2.Sample()]
 		tnd := apu.tndLUT[(3*apu.Triangle.Sample())+(2*apu.Noise.Sample())+apu.DMC.Sample()]
 
-		sample = int16((pulse + tnd) * 40000)
-		sample = apu.hipassStrong(sample)
-		sample = apu.hipassWeak(sample)
+		if apu.Expansion != nil {
+			tnd += apu.Expansion()
+		}
+
+		amplitude = int32((pulse + tnd) * MIXER_SCALE)
+	}
+
+	return
+}
+
+// Filters a sample read from one of the outputs' Blip.
+func (apu *APU) Sample(out *Output, s int32) (sample int16) {
+	s = apu.hipassStrong(out, s)
+	s = apu.hipassWeak(out, s)
+	s = apu.lowpass(out, s)
+
+	switch {
+	case s > math.MaxInt16:
+		sample = math.MaxInt16
+	case s < math.MinInt16:
+		sample = math.MinInt16
+	default:
+		sample = int16(s)
 	}
 
 	return
@@ -420,7 +526,10 @@ func (apu *APU) ExecuteFrameCounter() {
 	}
 }
 
-func (apu *APU) Execute() (sample int16, haveSample bool) {
+// Runs the APU for a CPU cycle and returns the left and right
+// samples, which are the same unless Stereo is set, if the cycle
+// finishes one.
+func (apu *APU) Execute() (left, right int16, haveSample bool) {
 	if apu.control(EnablePulseChannel1) {
 		apu.Pulse1.ClockDivider()
 	}
@@ -443,12 +552,29 @@ func (apu *APU) Execute() (sample int16, haveSample bool) {
 
 	apu.ExecuteFrameCounter()
 
-	if apu.Cycles++; apu.Cycles == apu.TargetCycles {
-		sample = apu.Sample()
-		haveSample = true
+	// feed Blip the mixer's output as it changes each cycle
+	if !apu.Stereo {
+		apu.Outputs[0].Feed(apu.Mix())
+	} else {
+		l, r := apu.MixStereo()
+		apu.Outputs[0].Feed(l)
+		apu.Outputs[1].Feed(r)
+	}
+
+	l, haveSample := apu.Outputs[0].Blip.Clock()
+	r, _ := apu.Outputs[1].Blip.Clock()
+
+	if haveSample {
+		left = apu.Sample(&apu.Outputs[0], l)
+		right = left
 
-		apu.Cycles = 0.0
-		apu.TargetCycles ^= 0x1
+		if apu.Stereo {
+			right = apu.Sample(&apu.Outputs[1], r)
+		}
+
+		if apu.ChannelLevels != nil {
+			apu.ChannelLevels(apu.Levels())
+		}
 	}
 
 	return
@@ -5,7 +5,7 @@ import "testing"
 var apu *APU
 
 func Setup() {
-	apu = NewAPU(0, nil)
+	apu = NewAPU(NTSC_CPU_FREQUENCY, 0, nil)
 	apu.Reset()
 }
 
@@ -0,0 +1,124 @@
+package rp2ago3
+
+import "math"
+
+const (
+	// taps of the band-limited step in output samples
+	BLIP_WIDTH = 16
+	// fractional sample positions the step can start at
+	BLIP_PHASE_BITS = 5
+	BLIP_PHASES     = 1 << BLIP_PHASE_BITS
+	// bits of precision of the band-limited step's taps
+	BLIP_KERNEL_BITS = 15
+	// bits of the fractional part of Blip.Time
+	BLIP_TIME_BITS = 32
+	// fraction of the output's Nyquist frequency passed by the step
+	BLIP_CUTOFF = 0.9
+)
+
+// The band-limited impulses of each phase, summing to 1 <<
+// BLIP_KERNEL_BITS so that a delta is always reached exactly.
+var blipKernel [BLIP_PHASES][BLIP_WIDTH]int32
+
+func init() {
+	for phase := 0; phase < BLIP_PHASES; phase++ {
+		var kernel [BLIP_WIDTH]float64
+		var sum float64
+
+		for i := range kernel {
+			// distance from the centre of the impulse, in output samples
+			x := float64(i) - float64(BLIP_WIDTH/2-1) - float64(phase)/BLIP_PHASES
+
+			sinc := BLIP_CUTOFF
+
+			if x != 0 {
+				sinc = math.Sin(math.Pi*BLIP_CUTOFF*x) / (math.Pi * x)
+			}
+
+			// Blackman window
+			w := 2 * math.Pi * (x + BLIP_WIDTH/2) / BLIP_WIDTH
+			window := 0.42 - 0.5*math.Cos(w) + 0.08*math.Cos(2*w)
+
+			kernel[i] = sinc * window
+			sum += kernel[i]
+		}
+
+		total := int32(0)
+
+		for i := range kernel {
+			blipKernel[phase][i] = int32(math.Floor(kernel[i]/sum*(1<<BLIP_KERNEL_BITS) + 0.5))
+			total += blipKernel[phase][i]
+		}
+
+		// put the rounding error in the centre tap
+		blipKernel[phase][BLIP_WIDTH/2-1] += (1 << BLIP_KERNEL_BITS) - total
+	}
+}
+
+// A band-limited step synthesis buffer in the style of blip_buf.  An
+// amplitude is fed in as the deltas by which it changes at each clock
+// and read out at the output sample rate without the aliasing of
+// point sampling, since each delta is spread over the output samples
+// around it by a band-limited step.
+type Blip struct {
+	// the current clock in output samples, as a fixed point number
+	// with BLIP_TIME_BITS of fraction
+	Time uint64
+	// output samples per clock, in the same format as Time
+	factor uint64
+	// the output level the samples read so far have reached
+	Integrator int32
+	// deltas of the output samples from Time on
+	Deltas [BLIP_WIDTH]int32
+}
+
+// Returns a new Blip resampling from clockRate clocks per second to
+// sampleRate samples per second.
+func NewBlip(clockRate, sampleRate float64) *Blip {
+	blip := &Blip{}
+	blip.SetRates(clockRate, sampleRate)
+
+	return blip
+}
+
+// Sets the clock and output sample rates.
+func (blip *Blip) SetRates(clockRate, sampleRate float64) {
+	blip.factor = uint64(math.Floor(sampleRate/clockRate*(1<<BLIP_TIME_BITS) + 0.5))
+}
+
+func (blip *Blip) Reset() {
+	blip.Time = 0
+	blip.Integrator = 0
+	blip.Deltas = [BLIP_WIDTH]int32{}
+}
+
+// Adds a change of delta to the amplitude at the current clock.
+func (blip *Blip) AddDelta(delta int32) {
+	phase := (blip.Time >> (BLIP_TIME_BITS - BLIP_PHASE_BITS)) & (BLIP_PHASES - 1)
+	remainder := delta
+
+	for i, k := range blipKernel[phase] {
+		d := int32((int64(delta) * int64(k)) >> BLIP_KERNEL_BITS)
+		blip.Deltas[i] += d
+		remainder -= d
+	}
+
+	// keep the rounding error from accumulating in the output
+	blip.Deltas[BLIP_WIDTH/2-1] += remainder
+}
+
+// Advances to the next clock and returns the output sample it
+// finishes, if any.  Deltas added later can no longer reach it.
+func (blip *Blip) Clock() (sample int32, haveSample bool) {
+	if blip.Time += blip.factor; blip.Time>>BLIP_TIME_BITS != 0 {
+		blip.Time -= 1 << BLIP_TIME_BITS
+
+		blip.Integrator += blip.Deltas[0]
+		sample, haveSample = blip.Integrator, true
+
+		copy(blip.Deltas[:], blip.Deltas[1:])
+		blip.Deltas[BLIP_WIDTH-1] = 0
+	}
+
+	return
+}
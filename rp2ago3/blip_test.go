@@ -0,0 +1,153 @@
+package rp2ago3
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBlipKernel(t *testing.T) {
+	for phase, kernel := range blipKernel {
+		sum := int32(0)
+
+		for _, k := range kernel {
+			sum += k
+		}
+
+		if sum != 1<<BLIP_KERNEL_BITS {
+			t.Errorf("Phase %v sums to %v not %v", phase, sum, 1<<BLIP_KERNEL_BITS)
+		}
+	}
+}
+
+func TestBlipRates(t *testing.T) {
+	for _, rate := range []int{44100, 48000, 96000} {
+		blip := NewBlip(NTSC_CPU_FREQUENCY, float64(rate))
+		samples := 0
+
+		for i := 0; i < int(NTSC_CPU_FREQUENCY); i++ {
+			if _, ok := blip.Clock(); ok {
+				samples++
+			}
+		}
+
+		if samples < rate-1 || samples > rate+1 {
+			t.Errorf("%v clocks gave %v samples not %v", NTSC_CPU_FREQUENCY, samples, rate)
+		}
+	}
+}
+
+func TestBlipStep(t *testing.T) {
+	blip := NewBlip(NTSC_CPU_FREQUENCY, 44100)
+	samples := []int32{}
+
+	for i := 0; i < 10000; i++ {
+		if i%997 == 0 {
+			blip.AddDelta(12345)
+		}
+
+		if i%1999 == 0 {
+			blip.AddDelta(-6789)
+		}
+
+		if s, ok := blip.Clock(); ok {
+			samples = append(samples, s)
+		}
+	}
+
+	// wait for the last step to settle
+	for i := 0; i < BLIP_WIDTH*41; i++ {
+		if s, ok := blip.Clock(); ok {
+			samples = append(samples, s)
+		}
+	}
+
+	if s, expected := samples[len(samples)-1], int32(11*12345-6*6789); s != expected {
+		t.Errorf("Output settled at %v not %v", s, expected)
+	}
+
+	// a step overshoots a little on its way
+	for i, s := range samples {
+		if s < -6789-1000 || s > 11*12345+1000 {
+			t.Errorf("Sample %v is %v", i, s)
+		}
+	}
+}
+
+func TestBlipAliasing(t *testing.T) {
+	blip := NewBlip(NTSC_CPU_FREQUENCY, 44100)
+	amplitude := int32(0)
+
+	var sum, pointSum float64
+	var n int
+
+	// a square wave at 31kHz, above the output's Nyquist frequency,
+	// that point sampling would fold back down to 13kHz
+	for i := 0; i < 200000; i++ {
+		next := int32(0)
+
+		if (i/29)%2 == 0 {
+			next = 10000
+		}
+
+		if next != amplitude {
+			blip.AddDelta(next - amplitude)
+			amplitude = next
+		}
+
+		if s, ok := blip.Clock(); ok && i > 10000 {
+			sum += math.Pow(float64(s)-5000, 2)
+			pointSum += math.Pow(float64(amplitude)-5000, 2)
+			n++
+		}
+	}
+
+	rms, pointRMS := math.Sqrt(sum/float64(n)), math.Sqrt(pointSum/float64(n))
+
+	if rms > pointRMS/10 {
+		t.Errorf("RMS of the aliased wave is %v, not much less than %v when point sampled", rms, pointRMS)
+	}
+}
+
+func TestAPUAdjustSampleRate(t *testing.T) {
+	for _, frequency := range []float64{NTSC_CPU_FREQUENCY, PAL_CPU_FREQUENCY} {
+		apu := NewAPU(frequency, 48000, nil)
+		apu.Reset()
+
+		for _, ratio := range []float64{0.995, 1, 1.005} {
+			apu.AdjustSampleRate(ratio)
+			samples := 0
+
+			// a second of the CPU's clock
+			for i := 0; i < int(frequency); i++ {
+				if _, _, ok := apu.Execute(); ok {
+					samples++
+				}
+			}
+
+			if expected := math.Floor(48000*ratio + 0.5); math.Abs(float64(samples)-expected) > 1 {
+				t.Errorf("Ratio %v at %vHz gave %v samples not %v", ratio, frequency, samples, expected)
+			}
+		}
+	}
+}
+
+func TestAPUFilters(t *testing.T) {
+	apu := NewAPU(NTSC_CPU_FREQUENCY, 44100, nil)
+	apu.Reset()
+
+	var sample int16
+
+	// the high-pass filters remove a constant level
+	for i := 0; i < 44100; i++ {
+		sample = apu.Sample(&apu.Outputs[0], 2000)
+	}
+
+	if sample < -1 || sample > 1 {
+		t.Errorf("Filtered constant level is %v not 0", sample)
+	}
+
+	// and the low-pass filter smooths a sudden change
+	if sample = apu.Sample(&apu.Outputs[0], -2000); sample <= -3900 || sample >= -1000 {
+		t.Errorf("Filtered step is %v", sample)
+	}
+}
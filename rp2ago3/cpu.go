@@ -2,6 +2,9 @@ package rp2ago3
 
 import "github.com/nwidger/nintengo/m65go2"
 
+const NTSC_CPU_FREQUENCY float64 = 1789773
+const PAL_CPU_FREQUENCY float64 = 1662607
+
 const NTSC_CPU_CLOCK_DIVISOR float32 = 3
 const PAL_CPU_CLOCK_DIVISOR float32 = 3.2
 
@@ -12,25 +15,24 @@ type RP2A03 struct {
 	Memory *MappedMemory
 }
 
-func NewRP2A03(apuFrequency int) *RP2A03 {
+// Returns a new CPU clocked at cpuFrequency whose APU produces
+// apuFrequency samples per second.
+func NewRP2A03(cpuFrequency float64, apuFrequency int) *RP2A03 {
 	mem := NewMappedMemory(m65go2.NewBasicMemory(m65go2.DEFAULT_MEMORY_SIZE))
-	mirrors := make(map[uint32]uint32)
 
 	// Mirrored 2KB internal RAM
-	for i := uint32(0x0800); i <= 0x1fff; i++ {
-		mirrors[i] = i % 0x0800
-	}
+	mem.MirrorRange(0x0800, 0x1fff, 0x0000, 0x0800)
 
 	// Mirrored PPU registers
-	for i := uint32(0x2008); i <= 0x3fff; i++ {
-		mirrors[i] = 0x2000 + (i & 0x0007)
-	}
+	mem.MirrorRange(0x2008, 0x3fff, 0x2000, 0x0008)
 
-	mem.AddMirrors(mirrors)
+	// Write-only APU and I/O registers and the expansion area.
+	// $6000-$7FFF is left backed by RAM since many iNES headers
+	// don't declare the PRG RAM their cartridges have.
+	mem.MapOpenBus(0x4000, 0x5fff)
 
-	cpu := m65go2.NewM6502(mem)
-	cpu.DisableDecimalMode()
-	apu := NewAPU(uint64(1789773/apuFrequency), cpu.InterruptLine(m65go2.Irq))
+	cpu := m65go2.NewM6502Variant(mem, m65go2.RP2A03)
+	apu := NewAPU(cpuFrequency, apuFrequency, cpu.InterruptLine(m65go2.Irq))
 
 	// APU memory maps
 	mem.AddMappings(apu, CPU)
@@ -60,7 +62,9 @@ func (cpu *RP2A03) Execute() (cycles uint16, err error) {
 		return
 	}
 
-	cycles += cpu.DMA.PerformDMA()
+	dmaCycles := cpu.DMA.PerformDMA()
+	cpu.M6502.Cycles += uint64(dmaCycles)
+	cycles += dmaCycles
 
 	return
 }
@@ -3,7 +3,7 @@ package rp2ago3
 import "testing"
 
 func TestStore(t *testing.T) {
-	cpu := NewRP2A03(1789773)
+	cpu := NewRP2A03(NTSC_CPU_FREQUENCY, 1789773)
 	cpu.Reset()
 
 	cpu.APU.Pulse1.Registers[0] = 0xde
@@ -55,7 +55,7 @@ func (ppu *FakePPU) Store(address uint16, value uint8) (oldValue uint8) {
 }
 
 func TestDMA(t *testing.T) {
-	cpu := NewRP2A03(1789773)
+	cpu := NewRP2A03(NTSC_CPU_FREQUENCY, 1789773)
 	ppu := &FakePPU{}
 
 	cpu.Memory.AddMappings(ppu, CPU)
@@ -73,3 +73,104 @@ func TestDMA(t *testing.T) {
 		}
 	}
 }
+
+func TestMemoryHooks(t *testing.T) {
+	cpu := NewRP2A03(NTSC_CPU_FREQUENCY, 1789773)
+	cpu.Reset()
+
+	reads := []uint16{}
+	writes := []uint16{}
+
+	read := cpu.Memory.OnRead(func(address uint16) {
+		reads = append(reads, address)
+	})
+
+	cpu.Memory.OnWrite(func(address uint16, value uint8) {
+		if value != 0xff {
+			t.Errorf("Write hook received %#02x, expected 0xff", value)
+		}
+
+		writes = append(writes, address)
+	})
+
+	cpu.Memory.Store(0x0801, 0xff)
+	cpu.Memory.Fetch(0x1001)
+
+	// hooks receive mirrored addresses
+	if len(writes) != 1 || writes[0] != 0x0001 {
+		t.Errorf("Write hook received %v, expected [1]", writes)
+	}
+
+	if len(reads) != 1 || reads[0] != 0x0001 {
+		t.Errorf("Read hook received %v, expected [1]", reads)
+	}
+
+	cpu.Memory.RemoveHook(read)
+	cpu.Memory.Fetch(0x0001)
+
+	if len(reads) != 1 {
+		t.Error("Read hook called after being removed")
+	}
+}
+
+func TestOpenBus(t *testing.T) {
+	cpu := NewRP2A03(NTSC_CPU_FREQUENCY, 1789773)
+	cpu.Reset()
+
+	cpu.Memory.Store(0x0010, 0x42)
+
+	// write-only APU register
+	if value := cpu.Memory.Fetch(0x4000); value != 0x42 {
+		t.Errorf("Memory is %#02x, expected 0x42", value)
+	}
+
+	cpu.Memory.Fetch(0x0010)
+	cpu.Memory.Store(0x0011, 0x24)
+	cpu.Memory.Fetch(0x0011)
+
+	// expansion area
+	if value := cpu.Memory.Fetch(0x5123); value != 0x24 {
+		t.Errorf("Memory is %#02x, expected 0x24", value)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	cpu := NewRP2A03(NTSC_CPU_FREQUENCY, 1789773)
+	cpu.Reset()
+
+	reads := 0
+
+	cpu.Memory.OnRead(func(address uint16) {
+		reads++
+	})
+
+	cpu.Memory.Store(0x0010, 0x42)
+	cpu.Memory.Poke(0x0811, 0x24)
+
+	if value := cpu.Memory.Peek(0x1010); value != 0x42 {
+		t.Errorf("Memory is %#02x, expected 0x42", value)
+	}
+
+	if value := cpu.Memory.Peek(0x0011); value != 0x24 {
+		t.Errorf("Memory is %#02x, expected 0x24", value)
+	}
+
+	// open bus is peeked but left alone
+	if value := cpu.Memory.Peek(0x4000); value != 0x42 || cpu.Memory.Bus != 0x42 {
+		t.Errorf("Memory is %#02x with bus %#02x, expected 0x42", value, cpu.Memory.Bus)
+	}
+
+	cpu.APU.status(FrameInterrupt, true)
+
+	if value := cpu.Memory.Peek(0x4015); value&uint8(FrameInterrupt) == 0 {
+		t.Errorf("Status is %#02x, expected frame interrupt", value)
+	}
+
+	if !cpu.APU.status(FrameInterrupt) {
+		t.Error("Peeking status cleared frame interrupt")
+	}
+
+	if reads != 0 {
+		t.Errorf("Read hook called %v times, expected 0", reads)
+	}
+}
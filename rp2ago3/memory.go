@@ -2,6 +2,7 @@ package rp2ago3
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/nwidger/nintengo/m65go2"
 )
@@ -17,25 +18,87 @@ const (
 	UNMIRRORED uint32 = 0x10000
 )
 
+// Memory that registers itself with a MappedMemory by listing every
+// address it handles.  Kept for compatibility, new code should
+// implement RangeMappableMemory instead.
 type MappableMemory interface {
 	m65go2.Memory
 	Mappings(which Mapping) (fetch, store []uint16)
 }
 
+// An inclusive range of addresses.
+type Range struct {
+	Start uint16
+	End   uint16
+}
+
+// Memory that registers itself with a MappedMemory by listing the
+// ranges of addresses it handles.
+type RangeMappableMemory interface {
+	m65go2.Memory
+	Ranges(which Mapping) (fetch, store []Range)
+}
+
+// Memory that can return the value at an address without any of the
+// side effects fetching it would have, such as clearing a status flag
+// or advancing a latch.  Memory whose fetches have side effects should
+// implement it so that a MappedMemory it is mapped into can be peeked.
+type PeekableMemory interface {
+	Peek(address uint16) (value uint8)
+}
+
+type readHook struct {
+	id   m65go2.Hook
+	hook func(address uint16)
+}
+
+type writeHook struct {
+	id   m65go2.Hook
+	hook func(address uint16, value uint8)
+}
+
+// Dispatches fetches and stores to the Memory mapped at each address,
+// falling back to the base Memory for unmapped addresses.  Mirrors are
+// resolved to their final address when they are added and each
+// address holds an index into a table of handlers, so every access
+// takes two table lookups no matter how the address space is mapped
+// and handlers can be swapped at runtime.
+//
+// The tables are kept per address rather than per 256-byte page since
+// the NES maps memory more finely than that: the PPU's registers
+// repeat every 8 bytes, each APU and I/O register at $4000-$4017 has
+// its own handler and the palette mirrors single bytes.  Page tables
+// would need a per-address fallback for those pages and a branch on
+// every access to choose between them.  Holding 16-bit handler indexes
+// instead of a Memory per address keeps the tables to about 700KB.
+//
+// Bus holds the last value fetched or stored, which is what fetches
+// from unmapped addresses in a range added with MapOpenBus return.
 type MappedMemory struct {
-	mirrors [65536]uint32
-	fetch   [65536]m65go2.Memory
-	store   [65536]m65go2.Memory
+	links    [65536]uint32
+	mirrors  [65536]uint16
+	fetch    [65536]uint16
+	store    [65536]uint16
+	openBus  [65536]bool
+	handlers []m65go2.Memory
 	m65go2.Memory
+	Bus uint8
+
+	nextHook   m65go2.Hook
+	readHooks  []readHook
+	writeHooks []writeHook
 }
 
 func NewMappedMemory(base m65go2.Memory) *MappedMemory {
 	mem := &MappedMemory{
 		Memory: base,
+		// index 0 is the base memory
+		handlers: []m65go2.Memory{nil},
 	}
 
-	for i := range mem.mirrors {
-		mem.mirrors[i] = UNMIRRORED
+	for i := range mem.links {
+		mem.links[i] = UNMIRRORED
+		mem.mirrors[i] = uint16(i)
 	}
 
 	return mem
@@ -48,31 +111,181 @@ func (mem *MappedMemory) AddMirrors(mirrors map[uint32]uint32) (err error) {
 			break
 		}
 
-		mem.mirrors[from] = to
+		mem.links[from] = to
+	}
+
+	if e := mem.resolve(); err == nil {
+		err = e
+	}
+
+	return
+}
+
+// Mirrors each address from start to end to target plus its offset
+// from start modulo size.
+func (mem *MappedMemory) MirrorRange(start, end, target uint16, size uint32) (err error) {
+	for i := uint32(start); i <= uint32(end); i++ {
+		to := uint32(target) + (i-uint32(start))%size
+
+		if i == to {
+			err = errors.New("Address cannot be mirrored to itself")
+			break
+		}
+
+		mem.links[i] = to
+	}
+
+	if e := mem.resolve(); err == nil {
+		err = e
+	}
+
+	return
+}
+
+// Follows each address's chain of mirrors to its final address.
+func (mem *MappedMemory) resolve() (err error) {
+	for i := range mem.links {
+		address := uint32(i)
+
+		for n := 0; mem.links[address] != UNMIRRORED; n++ {
+			if n == len(mem.links) {
+				mem.links[i] = UNMIRRORED
+				err = errors.New(fmt.Sprintf("Mirror of address 0x%04x loops", i))
+				break
+			}
+
+			address = mem.links[address]
+		}
+
+		mem.mirrors[i] = uint16(address)
+	}
+
+	return
+}
+
+func (mem *MappedMemory) handler(memory m65go2.Memory) uint16 {
+	if memory == nil {
+		return 0
+	}
+
+	for i, h := range mem.handlers {
+		if h == memory {
+			return uint16(i)
+		}
+	}
+
+	mem.handlers = append(mem.handlers, memory)
+
+	return uint16(len(mem.handlers) - 1)
+}
+
+func (mem *MappedMemory) mapRange(table *[65536]uint16, r Range, memory m65go2.Memory, remap bool) (err error) {
+	index := mem.handler(memory)
+
+	for i := uint32(r.Start); i <= uint32(r.End); i++ {
+		if !remap && table[i] != 0 {
+			return errors.New(fmt.Sprintf("Address 0x%04x is already mapped", i))
+		}
+	}
+
+	for i := uint32(r.Start); i <= uint32(r.End); i++ {
+		table[i] = index
+	}
+
+	return
+}
+
+// Maps fetches from and stores to the addresses from start to end to
+// the given Memory.  A nil fetch or store leaves that direction
+// unmapped.  Returns an error if any address is already mapped.
+func (mem *MappedMemory) MapRange(start, end uint16, fetch, store m65go2.Memory) (err error) {
+	if fetch != nil {
+		if err = mem.mapRange(&mem.fetch, Range{start, end}, fetch, false); err != nil {
+			return
+		}
+	}
+
+	if store != nil {
+		err = mem.mapRange(&mem.store, Range{start, end}, store, false)
+	}
+
+	return
+}
+
+// Maps the addresses from start to end to the given Memory, replacing
+// any existing mappings.  A nil fetch or store unmaps that direction.
+func (mem *MappedMemory) RemapRange(start, end uint16, fetch, store m65go2.Memory) {
+	mem.mapRange(&mem.fetch, Range{start, end}, fetch, true)
+	mem.mapRange(&mem.store, Range{start, end}, store, true)
+}
+
+// Replaces old with replacement at every address old is mapped to.
+func (mem *MappedMemory) Swap(old, replacement m65go2.Memory) {
+	for i, h := range mem.handlers {
+		if h == old && old != nil {
+			mem.handlers[i] = replacement
+		}
+	}
+}
+
+// Makes fetches from the addresses from start to end that are not
+// mapped to a Memory return the value left on the data bus by the
+// previous fetch or store rather than fetching from the base Memory.
+func (mem *MappedMemory) MapOpenBus(start, end uint16) {
+	for i := uint32(start); i <= uint32(end); i++ {
+		mem.openBus[i] = true
+	}
+}
+
+// Maps every range that mappable returns for the given Mapping.
+func (mem *MappedMemory) AddRanges(mappable RangeMappableMemory, which Mapping) (err error) {
+	fetch, store := mappable.Ranges(which)
+
+	for _, r := range fetch {
+		if err = mem.mapRange(&mem.fetch, r, mappable, false); err != nil {
+			return
+		}
+	}
+
+	for _, r := range store {
+		if err = mem.mapRange(&mem.store, r, mappable, false); err != nil {
+			return
+		}
 	}
 
 	return
 }
 
+// Maps every address that mappable returns for the given Mapping.
+// Runs of consecutive addresses are mapped as a single range.
 func (mem *MappedMemory) AddMappings(mappable MappableMemory, which Mapping) (err error) {
 	fetch, store := mappable.Mappings(which)
 
-	for _, address := range fetch {
-		if mmap := mem.fetch[address]; mmap != nil {
-			err = errors.New("Address is already mapped for fetch")
+	for _, r := range Ranges(fetch) {
+		if err = mem.mapRange(&mem.fetch, r, mappable, false); err != nil {
 			return
 		}
-
-		mem.fetch[address] = mappable
 	}
 
-	for _, address := range store {
-		if mmap := mem.store[address]; mmap != nil {
-			err = errors.New("Address is already mapped for store")
+	for _, r := range Ranges(store) {
+		if err = mem.mapRange(&mem.store, r, mappable, false); err != nil {
 			return
 		}
+	}
+
+	return
+}
+
+// Returns the runs of consecutive addresses in addresses as ranges.
+func Ranges(addresses []uint16) (ranges []Range) {
+	ranges = []Range{}
 
-		mem.store[address] = mappable
+	for i, address := range addresses {
+		if n := len(ranges); i > 0 && ranges[n-1].End != 0xffff && address == ranges[n-1].End+1 {
+			ranges[n-1].End = address
+		} else {
+			ranges = append(ranges, Range{address, address})
+		}
 	}
 
 	return
@@ -83,39 +296,120 @@ func (mem *MappedMemory) Reset() {
 	mem.Memory.Reset()
 }
 
-func (mem *MappedMemory) mirror(address uint16) (newAddress uint16) {
-	newAddress = address
+// Registers a hook that is called with the address of each fetch,
+// after mirroring has been applied, before the fetch is performed.
+func (mem *MappedMemory) OnRead(hook func(address uint16)) m65go2.Hook {
+	mem.nextHook++
+	mem.readHooks = append(mem.readHooks, readHook{mem.nextHook, hook})
 
-	for {
-		if mapAddress := mem.mirrors[newAddress]; mapAddress == UNMIRRORED {
-			break
-		} else {
-			newAddress = uint16(mapAddress)
+	return mem.nextHook
+}
+
+// Registers a hook that is called with the address and value of each
+// store, after mirroring has been applied, before the store is
+// performed.
+func (mem *MappedMemory) OnWrite(hook func(address uint16, value uint8)) m65go2.Hook {
+	mem.nextHook++
+	mem.writeHooks = append(mem.writeHooks, writeHook{mem.nextHook, hook})
+
+	return mem.nextHook
+}
+
+// Removes a hook registered with OnRead or OnWrite.
+func (mem *MappedMemory) RemoveHook(id m65go2.Hook) {
+	for i, h := range mem.readHooks {
+		if h.id == id {
+			mem.readHooks = append(mem.readHooks[:i:i], mem.readHooks[i+1:]...)
+			return
 		}
 	}
 
-	return
+	for i, h := range mem.writeHooks {
+		if h.id == id {
+			mem.writeHooks = append(mem.writeHooks[:i:i], mem.writeHooks[i+1:]...)
+			return
+		}
+	}
 }
 
 func (mem *MappedMemory) Fetch(address uint16) (value uint8) {
-	address = mem.mirror(address)
+	address = mem.mirrors[address]
+
+	if len(mem.readHooks) != 0 {
+		for _, h := range mem.readHooks {
+			h.hook(address)
+		}
+	}
 
-	if mmap := mem.fetch[address]; mmap != nil {
+	if mmap := mem.handlers[mem.fetch[address]]; mmap != nil {
 		value = mmap.Fetch(address)
+	} else if mem.openBus[address] {
+		value = mem.Bus
 	} else {
 		value = mem.Memory.Fetch(address)
 	}
 
+	mem.Bus = value
+
+	return
+}
+
+// Returns the value a fetch from address would return without calling
+// read hooks, updating Bus or triggering the side effects of the
+// Memory mapped at address.  Memory that does not implement
+// PeekableMemory is assumed to have side-effect free fetches.
+func (mem *MappedMemory) Peek(address uint16) (value uint8) {
+	address = mem.mirrors[address]
+
+	if mmap := mem.handlers[mem.fetch[address]]; mmap != nil {
+		value = peek(mmap, address)
+	} else if mem.openBus[address] {
+		value = mem.Bus
+	} else {
+		value = peek(mem.Memory, address)
+	}
+
+	return
+}
+
+func peek(memory m65go2.Memory, address uint16) uint8 {
+	if peeker, ok := memory.(PeekableMemory); ok {
+		return peeker.Peek(address)
+	}
+
+	return memory.Fetch(address)
+}
+
+// Stores value to address without calling write hooks or updating Bus.
+// Stores to the registers of a Memory mapped at address still have
+// their usual effects.
+func (mem *MappedMemory) Poke(address uint16, value uint8) (oldValue uint8) {
+	address = mem.mirrors[address]
+
+	if mmap := mem.handlers[mem.store[address]]; mmap != nil {
+		oldValue = mmap.Store(address, value)
+	} else {
+		oldValue = mem.Memory.Store(address, value)
+	}
+
 	return
 }
 
 func (mem *MappedMemory) Store(address uint16, value uint8) (oldValue uint8) {
-	address = mem.mirror(address)
+	address = mem.mirrors[address]
+
+	if len(mem.writeHooks) != 0 {
+		for _, h := range mem.writeHooks {
+			h.hook(address, value)
+		}
+	}
+
+	mem.Bus = value
 
-	if mmap := mem.store[address]; mmap != nil {
-		value = mmap.Store(address, value)
+	if mmap := mem.handlers[mem.store[address]]; mmap != nil {
+		oldValue = mmap.Store(address, value)
 	} else {
-		value = mem.Memory.Store(address, value)
+		oldValue = mem.Memory.Store(address, value)
 	}
 
 	return
@@ -0,0 +1,279 @@
+package rp2ago3
+
+import (
+	"testing"
+
+	"github.com/nwidger/nintengo/m65go2"
+)
+
+type fakeBank struct {
+	offset uint8
+}
+
+func (bank *fakeBank) Reset() {
+
+}
+
+func (bank *fakeBank) Mappings(which Mapping) (fetch, store []uint16) {
+	fetch = []uint16{}
+	store = []uint16{}
+
+	for i := uint32(0x0000); i <= 0x1fff; i++ {
+		fetch = append(fetch, uint16(i))
+		store = append(store, uint16(i))
+	}
+
+	return
+}
+
+func (bank *fakeBank) Ranges(which Mapping) (fetch, store []Range) {
+	fetch = []Range{{0x0000, 0x1fff}}
+	store = []Range{{0x0000, 0x1fff}}
+	return
+}
+
+func (bank *fakeBank) Fetch(address uint16) (value uint8) {
+	return uint8(address) + bank.offset
+}
+
+func (bank *fakeBank) Store(address uint16, value uint8) (oldValue uint8) {
+	return
+}
+
+func newPPUMemory() *MappedMemory {
+	mem := NewMappedMemory(m65go2.NewBasicMemory(m65go2.DEFAULT_MEMORY_SIZE))
+	mirrors := make(map[uint32]uint32)
+
+	for i := uint32(0x3000); i <= 0x3eff; i++ {
+		mirrors[i] = i - 0x1000
+	}
+
+	for _, i := range []uint32{0x3f10, 0x3f14, 0x3f18, 0x3f1c} {
+		mirrors[i] = i - 0x0010
+	}
+
+	for i := uint32(0x3f20); i <= 0x3fff; i++ {
+		mirrors[i] = 0x3f00 + (i & 0x001f)
+	}
+
+	mem.AddMirrors(mirrors)
+
+	return mem
+}
+
+func TestMappedMemoryRanges(t *testing.T) {
+	mem := newPPUMemory()
+	bank1 := &fakeBank{offset: 0x10}
+	bank2 := &fakeBank{offset: 0x20}
+
+	if err := mem.AddMappings(bank1, PPU); err != nil {
+		t.Fatal(err)
+	}
+
+	if mem.Fetch(0x1001) != 0x11 {
+		t.Error("Mapped address was not fetched from bank 1")
+	}
+
+	if err := mem.MapRange(0x1000, 0x1fff, bank2, nil); err == nil {
+		t.Error("No error mapping an address twice")
+	}
+
+	mem.RemapRange(0x1000, 0x1fff, bank2, nil)
+
+	if mem.Fetch(0x0001) != 0x11 || mem.Fetch(0x1001) != 0x21 {
+		t.Error("Remapped range was not fetched from bank 2")
+	}
+
+	mem.Store(0x1001, 0x55)
+
+	if mem.Memory.Fetch(0x1001) != 0x55 {
+		t.Error("Unmapped store did not fall through to base memory")
+	}
+
+	mem.Swap(bank1, bank2)
+
+	if mem.Fetch(0x0001) != 0x21 {
+		t.Error("Swapped handler was not fetched from bank 2")
+	}
+
+	// palette mirrors chain through $3F1C to $3F0C
+	mem.Store(0x3f0c, 0xaa)
+
+	if mem.Fetch(0x3f3c) != 0xaa || mem.Fetch(0x3ffc) != 0xaa {
+		t.Error("Chained mirror was not resolved")
+	}
+
+	if err := mem.MirrorRange(0x4000, 0x4000, 0x4000, 1); err == nil {
+		t.Error("No error mirroring an address to itself")
+	}
+
+	ranges := Ranges([]uint16{0x2000, 0x2001, 0x2003, 0xfffe, 0xffff, 0x0000})
+	expected := []Range{{0x2000, 0x2001}, {0x2003, 0x2003}, {0xfffe, 0xffff}, {0x0000, 0x0000}}
+
+	if len(ranges) != len(expected) {
+		t.Fatalf("Ranges is %v, expected %v", ranges, expected)
+	}
+
+	for i := range ranges {
+		if ranges[i] != expected[i] {
+			t.Errorf("Ranges is %v, expected %v", ranges, expected)
+		}
+	}
+}
+
+func BenchmarkAddMappings(b *testing.B) {
+	bank := &fakeBank{}
+
+	for i := 0; i < b.N; i++ {
+		mem := NewMappedMemory(m65go2.NewBasicMemory(m65go2.DEFAULT_MEMORY_SIZE))
+		mem.AddMappings(bank, PPU)
+	}
+}
+
+func BenchmarkAddRanges(b *testing.B) {
+	bank := &fakeBank{}
+
+	for i := 0; i < b.N; i++ {
+		mem := NewMappedMemory(m65go2.NewBasicMemory(m65go2.DEFAULT_MEMORY_SIZE))
+		mem.AddRanges(bank, PPU)
+	}
+}
+
+func BenchmarkFetch(b *testing.B) {
+	mem := newPPUMemory()
+	mem.AddMappings(&fakeBank{}, PPU)
+
+	for i := 0; i < b.N; i++ {
+		mem.Fetch(uint16(i) & 0x1fff)
+	}
+}
+
+func BenchmarkFetchMirrored(b *testing.B) {
+	mem := newPPUMemory()
+
+	for i := 0; i < b.N; i++ {
+		mem.Fetch(0x3f3c)
+	}
+}
+
+// A copy of MappedMemory as it was before ranges, which walked each
+// address's chain of mirrors and kept a Memory per address, for the
+// benchmarks to compare against.
+type legacyMappedMemory struct {
+	mirrors [65536]uint32
+	fetch   [65536]m65go2.Memory
+	store   [65536]m65go2.Memory
+	m65go2.Memory
+}
+
+func newLegacyMappedMemory() *legacyMappedMemory {
+	mem := &legacyMappedMemory{
+		Memory: m65go2.NewBasicMemory(m65go2.DEFAULT_MEMORY_SIZE),
+	}
+
+	for i := range mem.mirrors {
+		mem.mirrors[i] = UNMIRRORED
+	}
+
+	return mem
+}
+
+func newLegacyPPUMemory() *legacyMappedMemory {
+	mem := newLegacyMappedMemory()
+
+	for i := uint32(0x3000); i <= 0x3eff; i++ {
+		mem.mirrors[i] = i - 0x1000
+	}
+
+	for _, i := range []uint32{0x3f10, 0x3f14, 0x3f18, 0x3f1c} {
+		mem.mirrors[i] = i - 0x0010
+	}
+
+	for i := uint32(0x3f20); i <= 0x3fff; i++ {
+		mem.mirrors[i] = 0x3f00 + (i & 0x001f)
+	}
+
+	return mem
+}
+
+func (mem *legacyMappedMemory) AddMappings(mappable MappableMemory, which Mapping) {
+	fetch, store := mappable.Mappings(which)
+
+	for _, address := range fetch {
+		mem.fetch[address] = mappable
+	}
+
+	for _, address := range store {
+		mem.store[address] = mappable
+	}
+}
+
+func (mem *legacyMappedMemory) mirror(address uint16) (newAddress uint16) {
+	newAddress = address
+
+	for {
+		if mapAddress := mem.mirrors[newAddress]; mapAddress == UNMIRRORED {
+			break
+		} else {
+			newAddress = uint16(mapAddress)
+		}
+	}
+
+	return
+}
+
+func (mem *legacyMappedMemory) Fetch(address uint16) (value uint8) {
+	address = mem.mirror(address)
+
+	if mmap := mem.fetch[address]; mmap != nil {
+		value = mmap.Fetch(address)
+	} else {
+		value = mem.Memory.Fetch(address)
+	}
+
+	return
+}
+
+func TestLegacyMappedMemory(t *testing.T) {
+	mem, legacy := newPPUMemory(), newLegacyPPUMemory()
+
+	mem.AddMappings(&fakeBank{offset: 0x10}, PPU)
+	legacy.AddMappings(&fakeBank{offset: 0x10}, PPU)
+
+	for i := uint32(0); i <= 0x3fff; i++ {
+		mem.Memory.Store(uint16(i), uint8(i*7))
+		legacy.Memory.Store(uint16(i), uint8(i*7))
+	}
+
+	for i := uint32(0); i <= 0x3fff; i++ {
+		if value, expected := mem.Fetch(uint16(i)), legacy.Fetch(uint16(i)); value != expected {
+			t.Fatalf("Fetch of 0x%04x is 0x%02x, the legacy memory's is 0x%02x", i, value, expected)
+		}
+	}
+}
+
+func BenchmarkLegacyAddMappings(b *testing.B) {
+	bank := &fakeBank{}
+
+	for i := 0; i < b.N; i++ {
+		mem := newLegacyMappedMemory()
+		mem.AddMappings(bank, PPU)
+	}
+}
+
+func BenchmarkLegacyFetch(b *testing.B) {
+	mem := newLegacyPPUMemory()
+	mem.AddMappings(&fakeBank{}, PPU)
+
+	for i := 0; i < b.N; i++ {
+		mem.Fetch(uint16(i) & 0x1fff)
+	}
+}
+
+func BenchmarkLegacyFetchMirrored(b *testing.B) {
+	mem := newLegacyPPUMemory()
+
+	for i := 0; i < b.N; i++ {
+		mem.Fetch(0x3f3c)
+	}
+}
@@ -0,0 +1,144 @@
+package rp2ago3
+
+// The amplitude fed to Blip for a mixer output of 1.
+const MIXER_SCALE float64 = 40000
+
+// A channel mixed into the APU's output.
+type AudioChannel int
+
+const (
+	Pulse1Channel AudioChannel = iota
+	Pulse2Channel
+	TriangleChannel
+	NoiseChannel
+	DMCChannel
+	ExpansionChannel
+	AUDIO_CHANNELS
+)
+
+func (channel AudioChannel) String() string {
+	switch channel {
+	case Pulse1Channel:
+		return "pulse1"
+	case Pulse2Channel:
+		return "pulse2"
+	case TriangleChannel:
+		return "triangle"
+	case NoiseChannel:
+		return "noise"
+	case DMCChannel:
+		return "dmc"
+	case ExpansionChannel:
+		return "expansion"
+	}
+
+	return "unknown"
+}
+
+// How the stereo mixer mixes a channel.  Volume scales the channel's
+// level and Pan moves it from the left, at -1, to the right, at 1.  A
+// channel panned to the centre is mixed into both outputs at full
+// volume.
+type ChannelMix struct {
+	Volume float64
+	Pan    float64
+}
+
+// The volumes the channel is mixed into the left and right outputs
+// with.
+func (mix ChannelMix) gains() (left, right float64) {
+	left, right = mix.Volume, mix.Volume
+
+	if mix.Pan > 0 {
+		left *= 1 - mix.Pan
+	} else {
+		right *= 1 + mix.Pan
+	}
+
+	return
+}
+
+// One of the APU's outputs, mono or the left or right output of the
+// stereo mixer.
+type Output struct {
+	// the mixer's output as last fed to Blip
+	Amplitude int32
+	Blip      Blip
+
+	// the states of the output filters, in 16.16 fixed point
+	HipassStrong int64
+	HipassWeak   int64
+	Lowpass      int64
+}
+
+func (out *Output) Reset() {
+	out.Amplitude = 0
+	out.Blip.Reset()
+
+	out.HipassStrong = 0
+	out.HipassWeak = 0
+	out.Lowpass = 0
+}
+
+// Feeds Blip the mixer's output if it has changed since the last
+// clock.
+func (out *Output) Feed(amplitude int32) {
+	if amplitude != out.Amplitude {
+		out.Blip.AddDelta(amplitude - out.Amplitude)
+		out.Amplitude = amplitude
+	}
+}
+
+// Returns each channel's level before mixing: the 4-bit outputs of
+// the pulse, triangle and noise channels, the 7-bit output of the DMC
+// and the level of the expansion audio.
+func (apu *APU) Levels() (levels [AUDIO_CHANNELS]float64) {
+	levels[Pulse1Channel] = float64(apu.Pulse1.Sample())
+	levels[Pulse2Channel] = float64(apu.Pulse2.Sample())
+	levels[TriangleChannel] = float64(apu.Triangle.Sample())
+	levels[NoiseChannel] = float64(apu.Noise.Sample())
+	levels[DMCChannel] = float64(apu.DMC.Sample())
+
+	if apu.Expansion != nil {
+		levels[ExpansionChannel] = apu.Expansion()
+	}
+
+	return
+}
+
+// Returns the left and right outputs of the stereo mixer, which
+// mixes each side with the same formulas as pulseLUT and tndLUT but
+// with each channel's level scaled by its volume and pan.
+func (apu *APU) MixStereo() (left, right int32) {
+	var l, r [AUDIO_CHANNELS]float64
+
+	if apu.Muted {
+		return
+	}
+
+	levels := apu.Levels()
+
+	for i, level := range levels {
+		gainLeft, gainRight := apu.Channels[i].gains()
+
+		l[i] = level * gainLeft
+		r[i] = level * gainRight
+	}
+
+	left = int32(mixLevels(l) * MIXER_SCALE)
+	right = int32(mixLevels(r) * MIXER_SCALE)
+
+	return
+}
+
+func mixLevels(levels [AUDIO_CHANNELS]float64) (output float64) {
+	if pulse := levels[Pulse1Channel] + levels[Pulse2Channel]; pulse > 0 {
+		output += 95.52 / (8128.0/pulse + 100.0)
+	}
+
+	if tnd := 3*levels[TriangleChannel] + 2*levels[NoiseChannel] + levels[DMCChannel]; tnd > 0 {
+		output += 163.67 / (24329.0/tnd + 100.0)
+	}
+
+	return output + levels[ExpansionChannel]
+}
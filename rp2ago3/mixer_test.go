@@ -0,0 +1,115 @@
+package rp2ago3
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMixLevels(t *testing.T) {
+	apu := NewAPU(NTSC_CPU_FREQUENCY, 44100, nil)
+
+	for pulse := 0; pulse < len(apu.pulseLUT); pulse++ {
+		var levels [AUDIO_CHANNELS]float64
+		levels[Pulse1Channel] = float64(pulse / 2)
+		levels[Pulse2Channel] = float64(pulse - pulse/2)
+
+		if output := mixLevels(levels); math.Abs(output-apu.pulseLUT[pulse]) > 1e-12 {
+			t.Errorf("Pulse level %v mixes to %v not %v", pulse, output, apu.pulseLUT[pulse])
+		}
+	}
+
+	for triangle := 0; triangle < 16; triangle++ {
+		for noise := 0; noise < 16; noise++ {
+			for _, dmc := range []int{0, 64, 127} {
+				var levels [AUDIO_CHANNELS]float64
+				levels[TriangleChannel] = float64(triangle)
+				levels[NoiseChannel] = float64(noise)
+				levels[DMCChannel] = float64(dmc)
+
+				expected := apu.tndLUT[3*triangle+2*noise+dmc]
+
+				if output := mixLevels(levels); math.Abs(output-expected) > 1e-12 {
+					t.Errorf("Triangle %v, noise %v and DMC %v mix to %v not %v", triangle, noise, dmc, output, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestChannelMixGains(t *testing.T) {
+	for _, test := range []struct {
+		mix         ChannelMix
+		left, right float64
+	}{
+		{ChannelMix{1.0, 0.0}, 1.0, 1.0},
+		{ChannelMix{0.5, 0.0}, 0.5, 0.5},
+		{ChannelMix{1.0, -1.0}, 1.0, 0.0},
+		{ChannelMix{1.0, 1.0}, 0.0, 1.0},
+		{ChannelMix{0.8, -0.5}, 0.8, 0.4},
+		{ChannelMix{0.8, 0.25}, 0.6, 0.8},
+	} {
+		if left, right := test.mix.gains(); math.Abs(left-test.left) > 1e-12 || math.Abs(right-test.right) > 1e-12 {
+			t.Errorf("%+v gives gains %v, %v not %v, %v", test.mix, left, right, test.left, test.right)
+		}
+	}
+}
+
+func TestStereo(t *testing.T) {
+	var levels []float64
+
+	expansion := 0.0
+
+	apu := NewAPU(NTSC_CPU_FREQUENCY, 44100, nil)
+	apu.Reset()
+
+	apu.Stereo = true
+	apu.Channels[ExpansionChannel].Pan = -1.0
+	apu.Expansion = func() float64 { return expansion }
+	apu.ChannelLevels = func(l [AUDIO_CHANNELS]float64) {
+		levels = append(levels, l[ExpansionChannel])
+	}
+
+	if left, right := apu.MixStereo(); left != 0 || right != 0 {
+		t.Errorf("Silence mixes to %v, %v", left, right)
+	}
+
+	expansion = 0.25
+
+	if left, right := apu.MixStereo(); left != int32(0.25*MIXER_SCALE) || right != 0 {
+		t.Errorf("Expansion panned left mixes to %v, %v", left, right)
+	}
+
+	samples, loud := 0, 0
+
+	// a 1kHz square wave on the expansion audio is only heard on
+	// the left
+	for i := 0; i < 44100; i++ {
+		expansion = 0.0
+
+		if (i/895)%2 == 0 {
+			expansion = 0.25
+		}
+
+		left, right, ok := apu.Execute()
+
+		if !ok {
+			continue
+		}
+
+		if samples++; right != 0 {
+			t.Fatalf("Right sample %v is %v not 0", samples, right)
+		}
+
+		if left > 2000 || left < -2000 {
+			loud++
+		}
+	}
+
+	if loud < samples/2 {
+		t.Errorf("Only %v of %v left samples are loud", loud, samples)
+	}
+
+	if len(levels) != samples {
+		t.Errorf("Levels were reported %v times for %v samples", len(levels), samples)
+	}
+}
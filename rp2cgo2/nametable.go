@@ -13,16 +13,14 @@ func NewNametable() *Nametable {
 	return nametable
 }
 
-func (nametable *Nametable) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
-	fetch = []uint16{}
-	store = []uint16{}
+func (nametable *Nametable) Ranges(which rp2ago3.Mapping) (fetch, store []rp2ago3.Range) {
+	fetch = []rp2ago3.Range{}
+	store = []rp2ago3.Range{}
 
 	switch which {
 	case rp2ago3.PPU:
-		for i := uint16(0x2000); i <= 0x2fff; i++ {
-			fetch = append(fetch, i)
-			store = append(store, i)
-		}
+		fetch = append(fetch, rp2ago3.Range{Start: 0x2000, End: 0x2fff})
+		store = append(store, rp2ago3.Range{Start: 0x2000, End: 0x2fff})
 	}
 
 	return
@@ -17,6 +17,16 @@ const (
 	FAIL_COPY_Y_POSITION
 )
 
+// The sprites sprite evaluation found on a scanline, to be drawn on
+// the next.
+type Evaluation struct {
+	// the index in OAM of each sprite copied to Buffer
+	Sprites [8]uint8
+	Count   int
+	// the OAM address at which SpriteOverflow was set, or -1
+	Overflow int
+}
+
 type OAM struct {
 	*m65go2.BasicMemory
 	Address            uint16
@@ -26,6 +36,10 @@ type OAM struct {
 	Index              uint16
 	cycleFuncs         []CycleFunc
 	WriteCycle         int
+
+	// the sprites evaluated on each visible scanline of the current
+	// or last frame
+	Evaluations [240]Evaluation `json:"-"`
 }
 
 func NewOAM() *OAM {
@@ -79,6 +93,11 @@ func (oam *OAM) SpriteEvaluation(scanline uint16, cycle uint16, size uint16) (sp
 
 			oam.DisableReads = false
 			oam.WriteCycle = COPY_Y_POSITION
+
+			if scanline < 240 {
+				oam.Evaluations[scanline].Count = 0
+				oam.Evaluations[scanline].Overflow = -1
+			}
 		}
 
 		switch cycle & 0x1 {
@@ -92,6 +111,47 @@ func (oam *OAM) SpriteEvaluation(scanline uint16, cycle uint16, size uint16) (sp
 	return
 }
 
+// Stores the sprites on scanline after the first 8, which
+// SpriteEvaluation leaves out of Buffer, into sprites and returns how
+// many there are.  Unlike SpriteEvaluation it does not change OAM.
+func (oam *OAM) ExtraSprites(scanline uint16, size uint16, sprites []uint32) (n int) {
+	found := 0
+
+	for address := 0; address < 0x100 && n < len(sprites); address += 4 {
+		if scanline-uint16(oam.M[address]) >= size {
+			continue
+		}
+
+		if found++; found <= 8 {
+			continue
+		}
+
+		sprites[n] = uint32(oam.M[address])<<24 |
+			uint32(oam.M[address+1])<<16 |
+			uint32(oam.M[address+2])<<8 |
+			uint32(oam.M[address+3])
+		n++
+	}
+
+	return
+}
+
+// Returns the value OAMAddress is left with when rendering is
+// disabled at cycle of a rendered scanline.  Sprite evaluation drives
+// the OAM address while it scans OAM and clears it while sprites are
+// fetched, so disabling rendering part way through leaves it pointing
+// wherever evaluation had reached.
+func (oam *OAM) DisableRendering(cycle uint16, address uint8) uint8 {
+	switch {
+	case cycle >= 65 && cycle <= 256:
+		address = uint8(oam.Address)
+	case cycle >= 257 && cycle <= 320:
+		address = 0
+	}
+
+	return address
+}
+
 func (oam *OAM) incrementAddress(mask uint16) uint16 {
 	oam.Address = (oam.Address + 1) & mask
 	return oam.Address
@@ -111,6 +171,12 @@ func clearBuffer(oam *OAM, scanline uint16, cycle uint16, size uint16) (spriteOv
 
 func copyYPosition(oam *OAM, scanline uint16, cycle uint16, size uint16) (spriteOverflow bool) {
 	if scanline-uint16(oam.Latch) < size {
+		if scanline < 240 {
+			e := &oam.Evaluations[scanline]
+			e.Sprites[e.Count] = uint8(oam.Address >> 2)
+			e.Count++
+		}
+
 		oam.Buffer.Store(oam.Index+0, oam.Latch)
 		oam.WriteCycle = COPY_INDEX
 		oam.incrementAddress(0x00ff)
@@ -165,6 +231,10 @@ func copyXPosition(oam *OAM, scanline uint16, cycle uint16, size uint16) (sprite
 
 func evaluateYPosition(oam *OAM, scanline uint16, cycle uint16, size uint16) (spriteOverflow bool) {
 	if scanline-uint16(uint32(oam.Latch)) < size {
+		if scanline < 240 && oam.Evaluations[scanline].Overflow < 0 {
+			oam.Evaluations[scanline].Overflow = int(oam.Address)
+		}
+
 		spriteOverflow = true
 		oam.Address = (oam.Address + 1) & 0x00ff
 		oam.WriteCycle = EVALUATE_INDEX
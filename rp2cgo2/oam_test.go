@@ -563,3 +563,79 @@ func TestOAMSprite(t *testing.T) {
 	}
 
 }
+
+func TestEvaluations(t *testing.T) {
+	oam := NewOAM()
+
+	// sprites 3 and 5-13 are on scanline 10, the rest far below
+	for i := uint16(0); i < 64; i++ {
+		y := uint8(0xf0)
+
+		if i == 3 || (i >= 5 && i <= 13) {
+			y = 5
+		}
+
+		oam.Store(i<<2, y)
+	}
+
+	for cycle := uint16(1); cycle <= 256; cycle++ {
+		oam.SpriteEvaluation(10, cycle, 8)
+	}
+
+	e := oam.Evaluations[10]
+
+	if e.Count != 8 {
+		t.Fatalf("Evaluated %v sprites, expected 8", e.Count)
+	}
+
+	for i, sprite := range []uint8{3, 5, 6, 7, 8, 9, 10, 11} {
+		if e.Sprites[i] != sprite {
+			t.Errorf("Sprite %v is %v not %v", i, e.Sprites[i], sprite)
+		}
+	}
+
+	// sprite 12's Y position triggers the overflow
+	if e.Overflow != 12<<2 {
+		t.Errorf("Overflow is at %02X not %02X", e.Overflow, 12<<2)
+	}
+
+	for cycle := uint16(1); cycle <= 256; cycle++ {
+		oam.SpriteEvaluation(100, cycle, 8)
+	}
+
+	if e := oam.Evaluations[100]; e.Count != 0 || e.Overflow != -1 {
+		t.Errorf("Evaluated %v sprites with overflow at %v, expected none", e.Count, e.Overflow)
+	}
+}
+
+func TestExtraSprites(t *testing.T) {
+	oam := NewOAM()
+
+	// sprites 3 and 5-13 are on scanline 10, the rest far below
+	for i := uint16(0); i < 64; i++ {
+		y := uint8(0xf0)
+
+		if i == 3 || (i >= 5 && i <= 13) {
+			y = 5
+		}
+
+		oam.Store(i<<2, y)
+		oam.Store(i<<2+3, uint8(i))
+	}
+
+	sprites := make([]uint32, 56)
+
+	if n := oam.ExtraSprites(10, 8, sprites); n != 2 {
+		t.Fatalf("Found %v extra sprites, expected 2", n)
+	}
+
+	for i, sprite := range []uint32{0x0500000c, 0x0500000d} {
+		if sprites[i] != sprite {
+			t.Errorf("Extra sprite %v is %08X not %08X", i, sprites[i], sprite)
+		}
+	}
+
+	if n := oam.ExtraSprites(20, 8, sprites); n != 0 {
+		t.Errorf("Found %v extra sprites on scanline 20, expected none", n)
+	}
+}
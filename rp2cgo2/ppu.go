@@ -1,13 +1,6 @@
 package rp2cgo2
 
 import (
-	"bufio"
-	"fmt"
-	"image"
-	"image/color"
-	"image/jpeg"
-	"os"
-
 	"github.com/nwidger/nintengo/m65go2"
 	"github.com/nwidger/nintengo/rp2ago3"
 )
@@ -146,6 +139,10 @@ const (
 	CYCLES_PER_SCANLINE uint16 = 341
 	NUM_SCANLINES              = 262
 	POWERUP_SCANLINE           = 241
+
+	// frames after which a bit of the open bus latch decays to 0,
+	// about 600ms
+	LATCH_DECAY_FRAMES = 36
 )
 
 type TileData struct {
@@ -163,6 +160,27 @@ type Sprite struct {
 	Priority uint8
 
 	TileData [8]TileData
+
+	Tile PixelTile `json:"-"`
+}
+
+// Identifies the tile a pixel was drawn from so that tiles can be
+// replaced with higher resolution art.
+type PixelTile struct {
+	// TileKey's result for the tile
+	Key uint32
+	// the backdrop colour and the tile's 3 palette colours, from
+	// the high byte to the low byte
+	Palette uint32
+	// the pixel's position in the tile as stored in the pattern
+	// table, before flipping
+	Row    uint8
+	Column uint8
+	HFlip  bool
+	VFlip  bool
+	// neither is set if the pixel is not drawn from a tile
+	Background bool
+	Sprite     bool
 }
 
 type RP2C02 struct {
@@ -172,7 +190,7 @@ type RP2C02 struct {
 	Scanline uint16
 	Cycle    uint16
 
-	colors    []uint8
+	colors    []uint16
 	Registers Registers
 	Memory    *rp2ago3.MappedMemory
 	Palette   [32]uint8
@@ -180,10 +198,34 @@ type RP2C02 struct {
 	Interrupt func(state bool) `json:"-"`
 	OAM       *OAM
 
+	// Called with the address of each tile row the PPU fetches from
+	// the pattern tables while rendering, before it is fetched
+	PatternFetch func(address uint16) `json:"-"`
+
+	// Called with each address the PPU reads or writes, after the
+	// access, and the number of cycles the PPU had run, so that
+	// cartridges can watch the PPU's address bus
+	AddressBus func(address uint16, cycles uint64) `json:"-"`
+	Cycles     uint64
+
+	// Called with the pattern table address of each tile the PPU
+	// fetches while rendering when set.  The result is recorded
+	// for each pixel drawn from the tile in Tiles.
+	TileKey func(address uint16) uint32 `json:"-"`
+	Tiles   []PixelTile                 `json:"-"`
+
+	bgTile      PixelTile
+	bgTileLatch PixelTile
+	bgTiles     [2]PixelTile
+
 	Latch        bool
 	LatchAddress uint16
 	LatchValue   uint8
 
+	// the frame in which each bit of LatchValue was last refreshed
+	// with a 1
+	latchRefreshed [8]uint16
+
 	AddressLine    uint16
 	PatternAddress uint16
 
@@ -202,6 +244,15 @@ type RP2C02 struct {
 	ShowBackground bool `json:"-"`
 	ShowSprites    bool `json:"-"`
 
+	// Draws every sprite on a scanline instead of only the first 8,
+	// leaving sprite evaluation and SpriteOverflow as they are
+	NoSpriteLimit bool `json:"-"`
+
+	// the sprites after the first 8 on the scanline being drawn,
+	// loaded when NoSpriteLimit is set
+	ExtraSprites     [56]Sprite `json:"-"`
+	ExtraSpriteCount int        `json:"-"`
+
 	cycleJumpTable [CYCLES_PER_SCANLINE]func(*RP2C02)
 }
 
@@ -210,26 +261,22 @@ func NewRP2C02(interrupt func(bool)) *RP2C02 {
 	mirrors := make(map[uint32]uint32)
 
 	// Mirrored nametables
-	for i := uint32(0x3000); i <= 0x3eff; i++ {
-		mirrors[i] = i - 0x1000
-	}
+	mem.MirrorRange(0x3000, 0x3eff, 0x2000, 0x1000)
 
 	// Mirrored palette
 	for _, i := range []uint32{0x3f10, 0x3f14, 0x3f18, 0x3f1c} {
 		mirrors[i] = i - 0x0010
 	}
 
-	for i := uint32(0x3f20); i <= 0x3fff; i++ {
-		mirrors[i] = 0x3f00 + (i & 0x001f)
-	}
+	mem.AddMirrors(mirrors)
+	mem.MirrorRange(0x3f20, 0x3fff, 0x3f00, 0x0020)
 
 	nametable := NewNametable()
 
-	mem.AddMappings(nametable, rp2ago3.PPU)
-	mem.AddMirrors(mirrors)
+	mem.AddRanges(nametable, rp2ago3.PPU)
 
 	ppu := &RP2C02{
-		colors:         make([]uint8, 0xf000),
+		colors:         make([]uint16, 0xf000),
 		Memory:         mem,
 		Nametable:      nametable,
 		Interrupt:      interrupt,
@@ -240,22 +287,17 @@ func NewRP2C02(interrupt func(bool)) *RP2C02 {
 
 	ppu.initCycleJumpTable()
 
-	mem.AddMappings(ppu, rp2ago3.PPU)
+	mem.AddRanges(ppu, rp2ago3.PPU)
 
 	return ppu
 }
 
-func (ppu *RP2C02) TriggerScanlineCounter() (trigger bool) {
-	if ppu.Scanline >= 0 && ppu.Scanline <= 239 && ppu.rendering() {
-		spriteAddress := ppu.controller(SpritePatternAddress)
-		bgAddress := ppu.controller(BackgroundPatternAddress)
-
-		if ppu.Cycle == 262 && bgAddress == 0x0000 && spriteAddress == 0x1000 {
-			trigger = true
-		}
+// Passes an address the PPU has put on its address bus to
+// AddressBus.
+func (ppu *RP2C02) observe(address uint16) {
+	if ppu.AddressBus != nil {
+		ppu.AddressBus(address, ppu.Cycles)
 	}
-
-	return
 }
 
 func (ppu *RP2C02) ToggleDecode() bool {
@@ -385,39 +427,50 @@ func (ppu *RP2C02) sprite(sprite uint32, flag SpriteFlag) (value uint8) {
 	return
 }
 
-func (ppu *RP2C02) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
-	fetch = []uint16{}
-	store = []uint16{}
+func (ppu *RP2C02) Ranges(which rp2ago3.Mapping) (fetch, store []rp2ago3.Range) {
+	fetch = []rp2ago3.Range{}
+	store = []rp2ago3.Range{}
 
 	switch which {
 	case rp2ago3.PPU:
-		for i := uint16(0x3f00); i <= 0x3f1f; i++ {
-			fetch = append(fetch, i)
-			store = append(store, i)
-		}
+		// Palette
+		fetch = append(fetch, rp2ago3.Range{Start: 0x3f00, End: 0x3f1f})
+		store = append(store, rp2ago3.Range{Start: 0x3f00, End: 0x3f1f})
 	case rp2ago3.CPU:
-		for i := uint16(0x2000); i <= 0x2007; i++ {
-			switch i {
-			case 0x2000:
-				store = append(store, i)
-			case 0x2001:
-				fetch = append(fetch, i)
-				store = append(store, i)
-			case 0x2002:
-				fetch = append(fetch, i)
-			case 0x2003:
-				store = append(store, i)
-			case 0x2004:
-				fetch = append(fetch, i)
-				store = append(store, i)
-			case 0x2005:
-				store = append(store, i)
-			case 0x2006:
-				store = append(store, i)
-			case 0x2007:
-				fetch = append(fetch, i)
-				store = append(store, i)
-			}
+		// every register, including the write-only ones and
+		// PPUSTATUS, drives the open bus latch
+		fetch = append(fetch, rp2ago3.Range{Start: 0x2000, End: 0x2007})
+		store = append(store, rp2ago3.Range{Start: 0x2000, End: 0x2007})
+	}
+
+	return
+}
+
+// Refreshes the bits of LatchValue that are set in mask with those of
+// value.
+func (ppu *RP2C02) refreshLatch(value uint8, mask uint8) {
+	ppu.LatchValue = (ppu.LatchValue &^ mask) | (value & mask)
+
+	for i := range ppu.latchRefreshed {
+		if bit := uint8(1) << uint(i); mask&value&bit != 0 {
+			ppu.latchRefreshed[i] = ppu.Frame
+		}
+	}
+}
+
+// Returns LatchValue after decaying to 0 any bit that hasn't been
+// refreshed with a 1 for LATCH_DECAY_FRAMES frames.
+func (ppu *RP2C02) decayLatch() uint8 {
+	ppu.LatchValue = ppu.decayedLatch()
+	return ppu.LatchValue
+}
+
+func (ppu *RP2C02) decayedLatch() (value uint8) {
+	value = ppu.LatchValue
+
+	for i := range ppu.latchRefreshed {
+		if ppu.Frame-ppu.latchRefreshed[i] >= LATCH_DECAY_FRAMES {
+			value &^= uint8(1) << uint(i)
 		}
 	}
 
@@ -426,29 +479,74 @@ func (ppu *RP2C02) Mappings(which rp2ago3.Mapping) (fetch, store []uint16) {
 
 func (ppu *RP2C02) Fetch(address uint16) (value uint8) {
 	switch address {
-	// Mask
-	case 0x2001:
-		value = ppu.LatchValue
+	// Controller, Mask, OAMAddress, Scroll and Address are
+	// write-only
+	case 0x2000, 0x2001, 0x2003, 0x2005, 0x2006:
+		value = ppu.decayLatch()
 	// Status
 	case 0x2002:
-		value = (ppu.Registers.Status & 0xe0) | (ppu.LatchValue & 0x1f)
+		value = (ppu.Registers.Status & 0xe0) | (ppu.decayLatch() & 0x1f)
+		ppu.refreshLatch(value, 0xe0)
 		ppu.Registers.Status &^= uint8(VBlankStarted)
 		ppu.Latch = false
 	// OAMData
 	case 0x2004:
 		value = ppu.OAM.Fetch(uint16(ppu.Registers.OAMAddress))
+
+		// bits 2-4 of sprite attributes are unimplemented
+		if ppu.Registers.OAMAddress&0x03 == 0x02 {
+			value &= 0xe3
+		}
+
+		ppu.refreshLatch(value, 0xff)
 	// Data
 	case 0x2007:
 		value = ppu.Registers.Data
 
 		vramAddress := ppu.Registers.Address & 0x3fff
 		ppu.Registers.Data = ppu.Memory.Fetch(vramAddress)
+		ppu.observe(vramAddress)
 
 		if vramAddress&0x3f00 == 0x3f00 {
-			value = ppu.Registers.Data
+			// palette entries are only 6 bits wide
+			value = (ppu.Registers.Data & 0x3f) | (ppu.decayLatch() & 0xc0)
+			ppu.refreshLatch(value, 0x3f)
+		} else {
+			ppu.refreshLatch(value, 0xff)
 		}
 
 		ppu.incrementAddress()
+		ppu.observe(ppu.Registers.Address & 0x3fff)
+	}
+
+	if (address & 0x3f00) == 0x3f00 {
+		index := address & 0x00ff
+		value = ppu.Palette[index]
+	}
+
+	return
+}
+
+// Returns the value Fetch would return without clearing VBlankStarted,
+// reloading the read buffer or incrementing the VRAM address.
+func (ppu *RP2C02) Peek(address uint16) (value uint8) {
+	switch address {
+	case 0x2000, 0x2001, 0x2003, 0x2005, 0x2006:
+		value = ppu.decayedLatch()
+	case 0x2002:
+		value = (ppu.Registers.Status & 0xe0) | (ppu.decayedLatch() & 0x1f)
+	case 0x2004:
+		value = ppu.OAM.Fetch(uint16(ppu.Registers.OAMAddress))
+
+		if ppu.Registers.OAMAddress&0x03 == 0x02 {
+			value &= 0xe3
+		}
+	case 0x2007:
+		value = ppu.Registers.Data
+
+		if vramAddress := ppu.Registers.Address & 0x3fff; vramAddress&0x3f00 == 0x3f00 {
+			value = (ppu.Memory.Peek(vramAddress) & 0x3f) | (ppu.decayedLatch() & 0xc0)
+		}
 	}
 
 	if (address & 0x3f00) == 0x3f00 {
@@ -460,7 +558,9 @@ func (ppu *RP2C02) Fetch(address uint16) (value uint8) {
 }
 
 func (ppu *RP2C02) Store(address uint16, value uint8) (oldValue uint8) {
-	ppu.LatchValue = value
+	if address <= 0x2007 {
+		ppu.refreshLatch(value, 0xff)
+	}
 
 	switch address {
 	// Controller
@@ -472,7 +572,12 @@ func (ppu *RP2C02) Store(address uint16, value uint8) (oldValue uint8) {
 	// Mask
 	case 0x2001:
 		oldValue = ppu.Registers.Mask
+		rendering := ppu.rendering()
 		ppu.Registers.Mask = value
+
+		if rendering && !ppu.rendering() && (ppu.Scanline <= 239 || ppu.Scanline == 261) {
+			ppu.Registers.OAMAddress = ppu.OAM.DisableRendering(ppu.Cycle, ppu.Registers.OAMAddress)
+		}
 	// OAMAddress
 	case 0x2003:
 		oldValue = ppu.Registers.OAMAddress
@@ -506,6 +611,7 @@ func (ppu *RP2C02) Store(address uint16, value uint8) (oldValue uint8) {
 			// v                   = t
 			ppu.LatchAddress = (ppu.LatchAddress & 0x7f00) | uint16(value)
 			ppu.Registers.Address = ppu.LatchAddress
+			ppu.observe(ppu.Registers.Address & 0x3fff)
 		}
 
 		ppu.Latch = !ppu.Latch
@@ -513,7 +619,9 @@ func (ppu *RP2C02) Store(address uint16, value uint8) (oldValue uint8) {
 	case 0x2007:
 		oldValue = ppu.Registers.Data
 		ppu.Memory.Store(ppu.Registers.Address&0x3fff, value)
+		ppu.observe(ppu.Registers.Address & 0x3fff)
 		ppu.incrementAddress()
+		ppu.observe(ppu.Registers.Address & 0x3fff)
 	}
 
 	if (address & 0x3f00) == 0x3f00 {
@@ -632,6 +740,13 @@ func (ppu *RP2C02) fetchBackground() {
 		ppu.TilesLow = ppu.TilesLatchLow
 		ppu.TilesHigh = ppu.TilesLatchHigh
 
+		if ppu.TileKey != nil {
+			ppu.bgTiles[0], ppu.bgTiles[1] = ppu.bgTile, ppu.bgTileLatch
+			ppu.bgTiles[0].Palette = ppu.tilePalette(ppu.Attributes)
+			ppu.bgTiles[1].Palette = ppu.tilePalette(uint16(ppu.AttributeLatch))
+			ppu.bgTile = ppu.bgTileLatch
+		}
+
 		ppu.Attributes = uint16(ppu.AttributeLatch)
 	}
 }
@@ -666,34 +781,145 @@ func (ppu *RP2C02) fetchSprites() {
 		s.XPosition = ppu.sprite(sprite, XPosition)
 
 		address := ppu.spriteAddress(sprite)
-		s.TileLow = ppu.Memory.Fetch(address)
-		s.TileHigh = ppu.Memory.Fetch(address | 0x0008)
 
-		if ppu.sprite(sprite, FlipHorizontally) != 0 {
-			s.TileLow = reverseSprite(s.TileLow)
-			s.TileHigh = reverseSprite(s.TileHigh)
+		if ppu.PatternFetch != nil {
+			ppu.PatternFetch(address)
 		}
 
-		attribute := uint16(ppu.sprite(s.Sprite, SpritePalette)) << 2
+		ppu.spriteTile(s, address)
 
-		s.Address = uint16(0x3f10 | attribute)
-		s.Priority = ppu.sprite(s.Sprite, Priority)
+		tileLow := ppu.Memory.Fetch(address)
+		ppu.observe(address)
+		tileHigh := ppu.Memory.Fetch(address | 0x0008)
+		ppu.observe(address | 0x0008)
 
-		tileLow := s.TileLow
-		tileHigh := s.TileHigh
+		ppu.loadSprite(s, tileLow, tileHigh)
+	}
+}
 
-		for i := 0; i < 8; i++ {
-			high := tileHigh & 0x80
-			low := tileLow & 0x80
+// Loads the sprites on the next scanline after the 8 loaded by
+// fetchSprites when NoSpriteLimit is set.  Their tiles are peeked so
+// that mappers watching the PPU's pattern fetches see the same
+// fetches as without it.
+func (ppu *RP2C02) fetchExtraSprites() {
+	var sprites [56]uint32
+
+	ppu.ExtraSpriteCount = 0
+
+	if !ppu.NoSpriteLimit || ppu.Scanline == 261 {
+		return
+	}
+
+	n := ppu.OAM.ExtraSprites(ppu.Scanline, ppu.controller(SpriteSize), sprites[:])
+
+	for i := 0; i < n; i++ {
+		s := &ppu.ExtraSprites[i]
+
+		s.Sprite = sprites[i]
+		s.XPosition = ppu.sprite(s.Sprite, XPosition)
+
+		address := ppu.spriteAddress(s.Sprite)
+
+		ppu.spriteTile(s, address)
+		ppu.loadSprite(s, ppu.Memory.Peek(address), ppu.Memory.Peek(address|0x0008))
+	}
+
+	ppu.ExtraSpriteCount = n
+}
+
+// Decodes the fetched tile row of s.Sprite into s.TileData.
+func (ppu *RP2C02) loadSprite(s *Sprite, tileLow, tileHigh uint8) {
+	s.TileLow = tileLow
+	s.TileHigh = tileHigh
+
+	if ppu.sprite(s.Sprite, FlipHorizontally) != 0 {
+		s.TileLow = reverseSprite(s.TileLow)
+		s.TileHigh = reverseSprite(s.TileHigh)
+	}
+
+	attribute := uint16(ppu.sprite(s.Sprite, SpritePalette)) << 2
+
+	s.Address = uint16(0x3f10 | attribute)
+	s.Priority = ppu.sprite(s.Sprite, Priority)
+
+	tileLow = s.TileLow
+	tileHigh = s.TileHigh
+
+	for i := 0; i < 8; i++ {
+		high := tileHigh & 0x80
+		low := tileLow & 0x80
 
-			pindex := s.Address | uint16((high>>6)|(low>>7))
+		pindex := s.Address | uint16((high>>6)|(low>>7))
 
-			s.TileData[i].Pixel = ppu.Palette[pindex&0x001f]
-			s.TileData[i].Index = uint8(pindex & 0x0003)
+		s.TileData[i].Pixel = ppu.Palette[pindex&0x001f]
+		s.TileData[i].Index = uint8(pindex & 0x0003)
 
-			tileLow <<= 1
-			tileHigh <<= 1
+		tileLow <<= 1
+		tileHigh <<= 1
+	}
+}
+
+// Records the tile s is fetched from at address in s.Tile when
+// TileKey is set.
+func (ppu *RP2C02) spriteTile(s *Sprite, address uint16) {
+	if ppu.TileKey == nil {
+		return
+	}
+
+	s.Tile = PixelTile{
+		Key:     ppu.TileKey(address &^ 0x0007),
+		Palette: ppu.tilePalette(0x10 | uint16(ppu.sprite(s.Sprite, SpritePalette))<<2),
+		Row:     uint8(address & 0x0007),
+		HFlip:   ppu.sprite(s.Sprite, FlipHorizontally) != 0,
+		VFlip:   ppu.sprite(s.Sprite, FlipVertically) != 0,
+		Sprite:  true,
+	}
+}
+
+// Packs the backdrop colour and the 3 colours of the palette at
+// index for PixelTile.Palette.
+func (ppu *RP2C02) tilePalette(index uint16) uint32 {
+	return uint32(ppu.Palette[0]&0x3f)<<24 |
+		uint32(ppu.Palette[index+1]&0x3f)<<16 |
+		uint32(ppu.Palette[index+2]&0x3f)<<8 |
+		uint32(ppu.Palette[index+3]&0x3f)
+}
+
+// Records the tile the pixel at the current cycle is drawn from in
+// Tiles, choosing between the background and sprite tiles as
+// priorityMultiplexer chooses between their pixels.
+func (ppu *RP2C02) recordTile(bgIndex, spriteIndex, spritePriority uint8, spriteUnit int) {
+	if ppu.Tiles == nil {
+		ppu.Tiles = make([]PixelTile, len(ppu.colors))
+	}
+
+	tile := &ppu.Tiles[(ppu.Scanline<<8)+(ppu.Cycle-1)]
+
+	if !ppu.ShowBackground {
+		bgIndex = 0
+	}
+
+	switch {
+	case ppu.ShowSprites && spriteIndex != 0 && (bgIndex == 0 || spritePriority == 0):
+		s := &ppu.Sprites[spriteUnit&0x07]
+
+		if spriteUnit >= 8 {
+			s = &ppu.ExtraSprites[spriteUnit-8]
+		}
+
+		*tile = s.Tile
+		tile.Column = uint8(ppu.Cycle - 1 - uint16(s.XPosition))
+
+		if tile.HFlip {
+			tile.Column = 7 - tile.Column
 		}
+	case ppu.ShowBackground && ppu.mask(ShowBackground) && (ppu.mask(ShowBackgroundLeft) || ppu.Cycle > 8):
+		i := ((ppu.Cycle - 1) & 0x0007) + ppu.Registers.Scroll
+
+		*tile = ppu.bgTiles[i>>3]
+		tile.Column = uint8(i & 0x0007)
+	default:
+		*tile = PixelTile{}
 	}
 }
 
@@ -711,9 +937,12 @@ func (ppu *RP2C02) openName(address uint16) uint16 {
 }
 
 func (ppu *RP2C02) fetchName(address uint16) uint16 {
+	name := ppu.Memory.Fetch(address)
+	ppu.observe(address)
+
 	// 000p NNNN NNNN vvvv
 	return ppu.controller(BackgroundPatternAddress) |
-		uint16(ppu.Memory.Fetch(address))<<4 | ppu.address(FineYScroll)
+		uint16(name)<<4 | ppu.address(FineYScroll)
 }
 
 func (ppu *RP2C02) openAttribute(address uint16) uint16 {
@@ -737,7 +966,10 @@ func (ppu *RP2C02) fetchAttribute(address uint16) uint8 {
 	//         Y..   010 = 2
 	//               100 = 4
 	//               110 = 6
-	return (ppu.Memory.Fetch(address) >>
+	attribute := ppu.Memory.Fetch(address)
+	ppu.observe(address)
+
+	return (attribute >>
 		((ppu.Registers.Address & 0x2) | (ppu.Registers.Address >> 4 & 0x4))) & 0x03
 }
 
@@ -828,7 +1060,24 @@ func (ppu *RP2C02) renderSprites() (spritePixel, spriteIndex, spritePriority uin
 					spritePixel = td.Pixel
 					spritePriority = s.Priority
 					spriteUnit = i
-					break
+					return
+				}
+			}
+		}
+
+		for i := 0; i < ppu.ExtraSpriteCount; i++ {
+			s = &ppu.ExtraSprites[i]
+			x = c - uint16(s.XPosition)
+
+			if x <= 7 {
+				td := &s.TileData[x]
+
+				if td.Index != 0x00 {
+					spriteIndex = td.Index
+					spritePixel = td.Pixel
+					spritePriority = s.Priority
+					spriteUnit = 8 + i
+					return
 				}
 			}
 		}
@@ -860,7 +1109,20 @@ func openLowBGTileByte(ppu *RP2C02) {
 
 func fetchLowBGTileByte(ppu *RP2C02) {
 	// Fetch color bit 0 for next 8 dots
+	if ppu.PatternFetch != nil {
+		ppu.PatternFetch(ppu.AddressLine)
+	}
+
 	ppu.TilesLatchLow = ppu.Memory.Fetch(ppu.AddressLine)
+	ppu.observe(ppu.AddressLine)
+
+	if ppu.TileKey != nil {
+		ppu.bgTileLatch = PixelTile{
+			Key:        ppu.TileKey(ppu.AddressLine &^ 0x0007),
+			Row:        uint8(ppu.AddressLine & 0x0007),
+			Background: true,
+		}
+	}
 }
 
 func openHighBGTileByte(ppu *RP2C02) {
@@ -871,6 +1133,7 @@ func openHighBGTileByte(ppu *RP2C02) {
 func fetchHighBGTileByte(ppu *RP2C02) {
 	// Fetch color bit 1 for next 8 dots
 	ppu.TilesLatchHigh = ppu.Memory.Fetch(ppu.AddressLine)
+	ppu.observe(ppu.AddressLine)
 
 	// inc hori(v)
 	ppu.incrementX()
@@ -948,6 +1211,15 @@ func (ppu *RP2C02) initCycleJumpTable() {
 	}
 }
 
+// Corrupts OAM as the PPU does when it starts rendering a frame: if
+// OAMAddress is 8 or more the 8 byte row it points to is copied over
+// the first row.
+func (ppu *RP2C02) startRendering() {
+	if address := int(ppu.Registers.OAMAddress) & 0xf8; address >= 8 {
+		copy(ppu.OAM.M[0:8], ppu.OAM.M[address:address+8])
+	}
+}
+
 func (ppu *RP2C02) renderVisibleScanline() {
 	ppu.fetchBackground()
 
@@ -968,7 +1240,11 @@ func (ppu *RP2C02) renderVisibleScanline() {
 		}
 
 		if ppu.Scanline >= 0 && ppu.Scanline <= 239 {
-			ppu.colors[(ppu.Scanline<<8)+(ppu.Cycle-1)] = color
+			ppu.colors[(ppu.Scanline<<8)+(ppu.Cycle-1)] = ppu.pixel(color)
+
+			if ppu.TileKey != nil {
+				ppu.recordTile(bgIndex, spriteIndex, spritePriority, spriteUnit)
+			}
 		}
 
 		if ppu.OAM.SpriteEvaluation(ppu.Scanline, ppu.Cycle, ppu.controller(SpriteSize)) {
@@ -978,10 +1254,41 @@ func (ppu *RP2C02) renderVisibleScanline() {
 
 	ppu.fetchSprites()
 
+	// OAMAddress is cleared while sprites are fetched
+	if ppu.Cycle >= 257 && ppu.Cycle <= 320 {
+		ppu.Registers.OAMAddress = 0
+	}
+
+	if ppu.Cycle == 320 {
+		ppu.fetchExtraSprites()
+	}
+
 	return
 }
 
-func (ppu *RP2C02) Execute() (colors []uint8) {
+// Returns the 9-bit pixel output for a colour fetched from the
+// palette: the colour's 6-bit index in bits 0-5, reduced to its
+// luminance when Grayscale is set, and the IntensifyReds,
+// IntensifyGreens and IntensifyBlues flags in bits 6-8.
+func (ppu *RP2C02) pixel(color uint8) uint16 {
+	color &= 0x3f
+
+	if ppu.mask(Grayscale) {
+		color &= 0x30
+	}
+
+	return uint16(color) | uint16(ppu.Registers.Mask&0xe0)<<1
+}
+
+// Returns the 9-bit pixels, as described by pixel, of the frame being
+// rendered.  Scanlines not yet rendered still hold the last frame.
+func (ppu *RP2C02) Colors() []uint16 {
+	return ppu.colors
+}
+
+// Returns a frame of 9-bit pixels, as described by pixel, once the
+// last scanline of a frame has been rendered.
+func (ppu *RP2C02) Execute() (colors []uint16) {
 	switch {
 	// visible scanlines (0-239), pre-render scanline (261)
 	case (ppu.Scanline >= 0 && ppu.Scanline <= 239) || ppu.Scanline == 261:
@@ -990,6 +1297,10 @@ func (ppu *RP2C02) Execute() (colors []uint8) {
 		}
 
 		if ppu.rendering() {
+			if ppu.Scanline == 261 && ppu.Cycle == 1 {
+				ppu.startRendering()
+			}
+
 			ppu.renderVisibleScanline()
 
 			if (ppu.Frame&0x01) == 0x01 && ppu.Scanline == 261 && ppu.Cycle == 339 {
@@ -1010,6 +1321,8 @@ func (ppu *RP2C02) Execute() (colors []uint8) {
 		}
 	}
 
+	ppu.Cycles++
+
 	if ppu.Cycle++; ppu.Cycle == CYCLES_PER_SCANLINE {
 		ppu.Cycle = 0
 
@@ -1025,61 +1338,3 @@ func (ppu *RP2C02) Execute() (colors []uint8) {
 
 	return
 }
-
-func (ppu *RP2C02) GetPatternTables() (left, right *image.RGBA) {
-	left = image.NewRGBA(image.Rect(0, 0, 128, 128))
-	right = image.NewRGBA(image.Rect(0, 0, 128, 128))
-
-	colors := [4]color.RGBA{
-		color.RGBA{0, 0, 0, 255},
-		color.RGBA{203, 79, 15, 255},
-		color.RGBA{255, 155, 59, 255},
-		color.RGBA{255, 231, 163, 255},
-	}
-
-	x_base := 0
-	y_base := 0
-
-	ptimg := left
-
-	for address := uint16(0x0000); address <= 0x1fff; address += 0x0010 {
-		if address < 0x1000 {
-			ptimg = left
-		} else {
-			ptimg = right
-		}
-
-		for row := uint16(0); row <= 7; row++ {
-			low := ppu.Memory.Fetch(address + row)
-			high := ppu.Memory.Fetch(address + row + 8)
-
-			for i := int16(7); i >= 0; i-- {
-				b := ((low >> uint16(i)) & 0x0001) | (((high >> uint16(i)) & 0x0001) << 1)
-				ptimg.Set(x_base+(8-int(i+1)), y_base+int(row), colors[b])
-			}
-		}
-
-		x_base += 8
-
-		if x_base == 128 {
-			x_base = 0
-			y_base = (y_base + 8) % 128
-		}
-	}
-
-	return
-}
-
-func (ppu *RP2C02) SavePatternTables() (left, right *image.RGBA) {
-	left, right = ppu.GetPatternTables()
-
-	fo, _ := os.Create(fmt.Sprintf("left.jpg"))
-	w := bufio.NewWriter(fo)
-	jpeg.Encode(w, left, &jpeg.Options{Quality: 100})
-
-	fo, _ = os.Create(fmt.Sprintf("right.jpg"))
-	w = bufio.NewWriter(fo)
-	jpeg.Encode(w, right, &jpeg.Options{Quality: 100})
-
-	return
-}
@@ -1,6 +1,9 @@
 package rp2cgo2
 
-import "testing"
+import (
+	"image"
+	"testing"
+)
 
 func TestController(t *testing.T) {
 	ppu := NewRP2C02(nil)
@@ -478,8 +481,10 @@ func TestDataIncrement1(t *testing.T) {
 	ppu.Memory.Store(0x3f01, 0xff)
 	ppu.Memory.Store(0x3f02, 0xff)
 
-	if ppu.Fetch(0x2007) != 0xff {
-		t.Error("Memory is not 0xff")
+	// the high 2 bits of palette reads come from the open bus
+	// latch, which the write to $2006 cleared
+	if ppu.Fetch(0x2007) != 0x3f {
+		t.Error("Memory is not 0x3f")
 	}
 
 	if ppu.Registers.Address != 0x3f01 {
@@ -690,3 +695,446 @@ func TestTransferY(t *testing.T) {
 		t.Error("Registers is not 0x7be0")
 	}
 }
+
+func TestOpenBusLatch(t *testing.T) {
+	ppu := NewRP2C02(nil)
+
+	ppu.Store(0x2002, 0xff)
+
+	if value := ppu.Fetch(0x2000); value != 0xff {
+		t.Errorf("Memory is %02X not 0xff", value)
+	}
+
+	ppu.Registers.Status = 0x00
+
+	// only the high 3 bits of status refresh the latch
+	if value := ppu.Fetch(0x2002); value != 0x1f {
+		t.Errorf("Memory is %02X not 0x1f", value)
+	}
+
+	if ppu.LatchValue != 0x1f {
+		t.Errorf("LatchValue is %02X not 0x1f", ppu.LatchValue)
+	}
+
+	ppu.Frame += LATCH_DECAY_FRAMES - 1
+
+	if value := ppu.Fetch(0x2005); value != 0x1f {
+		t.Errorf("Memory is %02X not 0x1f before decaying", value)
+	}
+
+	ppu.Frame++
+
+	if value := ppu.Fetch(0x2005); value != 0x00 {
+		t.Errorf("Memory is %02X not 0x00 after decaying", value)
+	}
+
+	ppu.OAM.Store(0x02, 0xff)
+	ppu.Store(0x2003, 0x02)
+
+	if value := ppu.Fetch(0x2004); value != 0xe3 {
+		t.Errorf("Sprite attribute is %02X not 0xe3", value)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	ppu := NewRP2C02(nil)
+
+	ppu.Registers.Status = uint8(VBlankStarted)
+	ppu.Registers.Address = 0x3f01
+	ppu.Registers.Data = 0x12
+	ppu.Palette[1] = 0x2a
+
+	if value := ppu.Peek(0x2002); value&uint8(VBlankStarted) == 0 {
+		t.Errorf("Status is %02X, expected VBlankStarted", value)
+	}
+
+	if ppu.Registers.Status&uint8(VBlankStarted) == 0 {
+		t.Error("Peeking status cleared VBlankStarted")
+	}
+
+	if value := ppu.Peek(0x2007); value != 0x2a {
+		t.Errorf("Data is %02X not 0x2a", value)
+	}
+
+	if ppu.Registers.Address != 0x3f01 || ppu.Registers.Data != 0x12 {
+		t.Error("Peeking data changed the address or read buffer")
+	}
+}
+
+func TestPixel(t *testing.T) {
+	ppu := NewRP2C02(nil)
+
+	for _, v := range []struct {
+		mask  uint8
+		color uint8
+		pixel uint16
+	}{
+		{0x00, 0x16, 0x016},
+		{0x00, 0xd6, 0x016},
+		{uint8(Grayscale), 0x16, 0x010},
+		{uint8(IntensifyReds), 0x16, 0x056},
+		{uint8(IntensifyGreens | IntensifyBlues | Grayscale), 0x3d, 0x1b0},
+	} {
+		ppu.Registers.Mask = v.mask
+
+		if pixel := ppu.pixel(v.color); pixel != v.pixel {
+			t.Errorf("Pixel for color %02X with mask %02X is %03X not %03X", v.color, v.mask, pixel, v.pixel)
+		}
+	}
+}
+
+func TestNametables(t *testing.T) {
+	ppu := NewRP2C02(nil)
+
+	// vertical mirroring
+	ppu.Nametable.SetTables(0, 1, 0, 1)
+
+	// tile 1 is solid colour 3
+	for row := uint16(0); row < 16; row++ {
+		ppu.Memory.Store(0x0010+row, 0xff)
+	}
+
+	ppu.Palette[0] = 0x0f
+	ppu.Palette[7] = 0x16
+	ppu.Palette[15] = 0x2a
+
+	// tile 1 in the top left quadrant of $2400's first attribute with
+	// palette 1, and in the top right quadrant with palette 3
+	ppu.Memory.Store(0x2400, 0x01)
+	ppu.Memory.Store(0x2402, 0x01)
+	ppu.Memory.Store(0x27c0, 0x0d)
+	ppu.Memory.Bus = 0x00
+
+	colors := ppu.Nametables()
+
+	if len(colors) != 512*480 {
+		t.Fatalf("Nametables are %v pixels, expected %v", len(colors), 512*480)
+	}
+
+	for _, v := range []struct {
+		x, y  int
+		pixel uint16
+	}{
+		{0, 0, 0x0f},
+		{256, 0, 0x16},
+		{263, 7, 0x16},
+		{264, 0, 0x0f},
+		{272, 0, 0x2a},
+		// $2c00 mirrors $2400
+		{256, 240, 0x16},
+		{272, 240, 0x2a},
+	} {
+		if pixel := colors[v.y*512+v.x]; pixel != v.pixel {
+			t.Errorf("Pixel %v,%v is %03X not %03X", v.x, v.y, pixel, v.pixel)
+		}
+	}
+
+	if ppu.Memory.Bus != 0x00 {
+		t.Errorf("Reading the nametables left %02X on the bus", ppu.Memory.Bus)
+	}
+}
+
+func TestScrollRect(t *testing.T) {
+	ppu := NewRP2C02(nil)
+	ppu.Scanline = 241
+
+	// base nametable $2c00, scroll to 13, 42
+	ppu.Store(0x2000, 0x03)
+	ppu.Store(0x2005, 13)
+	ppu.Store(0x2005, 42)
+
+	if rect, expected := ppu.ScrollRect(), image.Rect(269, 282, 525, 522); rect != expected {
+		t.Errorf("Scroll is %v not %v", rect, expected)
+	}
+
+	// rendering scanline 100 of a frame scrolled vertically to 42
+	ppu.Registers.Mask = uint8(ShowBackground)
+	ppu.Scanline = 100
+	ppu.Cycle = 300
+	ppu.Registers.Address = 0x0800 | uint16((142+1)/8)<<5 | uint16((142+1)%8)<<12
+
+	if rect := ppu.ScrollRect(); rect.Min.Y != 282 {
+		t.Errorf("Scroll is %v, expected it to start at 282", rect)
+	}
+}
+
+func TestOAMSprites(t *testing.T) {
+	ppu := NewRP2C02(nil)
+
+	// tile 2 has colour 1 in its top left pixel, tile 3 colour 2 in
+	// its bottom right
+	ppu.Memory.Store(0x1020, 0x80)
+	ppu.Memory.Store(0x103f, 0x01)
+
+	ppu.Palette[0x11] = 0x16
+	ppu.Palette[0x1e] = 0x2a
+
+	// sprite 1 at 10, 20 with tile 2, flipped horizontally
+	ppu.OAM.Store(0x04, 20)
+	ppu.OAM.Store(0x05, 0x02)
+	ppu.OAM.Store(0x06, 0x60)
+	ppu.OAM.Store(0x07, 10)
+
+	// sprite 2 with tiles 2 and 3, flipped vertically with palette 3
+	ppu.OAM.Store(0x09, 0x03)
+	ppu.OAM.Store(0x0a, 0x83)
+
+	ppu.Registers.Controller = uint8(SpritePatternAddress)
+	sprites := ppu.OAMSprites()
+
+	if len(sprites) != 64 {
+		t.Fatalf("Decoded %v sprites, expected 64", len(sprites))
+	}
+
+	s := sprites[1]
+
+	if s.X != 10 || s.Y != 20 || s.Tile != 0x02 || s.Palette != 0 || !s.Behind || !s.FlipHorizontally || s.FlipVertically {
+		t.Errorf("Sprite is %+v", s)
+	}
+
+	if s.Address != 0x1020 || s.Height != 8 {
+		t.Errorf("Sprite is at %04X with height %v, expected 1020 and 8", s.Address, s.Height)
+	}
+
+	if s.Indexes[7] != 1 || s.Colors[7] != 0x16 || s.Indexes[0] != 0 {
+		t.Errorf("Sprite's top row is %v, expected colour 1 at the right", s.Indexes[:8])
+	}
+
+	ppu.Registers.Controller = uint8(SpriteSize)
+	s = ppu.OAMSprites()[2]
+
+	// 8x16 sprites take their bank from the tile number
+	if s.Address != 0x1020 || s.Height != 16 || !s.FlipVertically || s.Palette != 3 {
+		t.Errorf("Sprite is %+v", s)
+	}
+
+	if s.Indexes[7] != 2 || s.Colors[7] != 0x2a || s.Indexes[15*8] != 1 {
+		t.Errorf("Sprite's top row is %v and bottom row %v", s.Indexes[:8], s.Indexes[15*8:])
+	}
+}
+
+func TestPatternTables(t *testing.T) {
+	ppu := NewRP2C02(nil)
+
+	// tile $01 row 0 is colours 1, 2, 3, 0, ... and tile $1ff row 7
+	// is colour 3
+	ppu.Memory.Store(0x0010, 0xa0)
+	ppu.Memory.Store(0x0018, 0x60)
+	ppu.Memory.Store(0x1ff7, 0xff)
+	ppu.Memory.Store(0x1fff, 0xff)
+	ppu.Memory.Bus = 0x00
+
+	indexes := ppu.PatternTables()
+
+	if len(indexes) != 256*128 {
+		t.Fatalf("Pattern tables are %v pixels, expected %v", len(indexes), 256*128)
+	}
+
+	for _, v := range []struct {
+		x, y  int
+		index uint8
+	}{
+		{8, 0, 1},
+		{9, 0, 2},
+		{10, 0, 3},
+		{11, 0, 0},
+		{8, 1, 0},
+		{248, 127, 3},
+		{255, 127, 3},
+		{255, 126, 0},
+	} {
+		if index := indexes[v.y*256+v.x]; index != v.index {
+			t.Errorf("Pixel %v,%v is %v not %v", v.x, v.y, index, v.index)
+		}
+	}
+
+	if ppu.Memory.Bus != 0x00 {
+		t.Errorf("Reading the pattern tables left %02X on the bus", ppu.Memory.Bus)
+	}
+
+	chr := EncodePatternTables(indexes)
+
+	for address := uint16(0x0000); address <= 0x1fff; address++ {
+		if value := ppu.Memory.Fetch(address); chr[address] != value {
+			t.Errorf("Encoded $%04X is %02X not %02X", address, chr[address], value)
+		}
+	}
+}
+
+func TestPaletteColors(t *testing.T) {
+	ppu := NewRP2C02(nil)
+
+	for i := range ppu.Palette {
+		ppu.Palette[i] = uint8(i)
+	}
+
+	if colors := ppu.PaletteColors(1); colors != [4]uint16{0x00, 0x05, 0x06, 0x07} {
+		t.Errorf("Background palette 1 is %v", colors)
+	}
+
+	if colors := ppu.PaletteColors(7); colors != [4]uint16{0x00, 0x1d, 0x1e, 0x1f} {
+		t.Errorf("Sprite palette 3 is %v", colors)
+	}
+}
+
+func TestNoSpriteLimit(t *testing.T) {
+	for _, noSpriteLimit := range []bool{false, true} {
+		ppu := NewRP2C02(nil)
+
+		ppu.NoSpriteLimit = noSpriteLimit
+		ppu.Registers.Mask = 0x1e
+
+		// tile 1 is solid colour 1
+		for row := uint16(0); row < 8; row++ {
+			ppu.Memory.Store(0x0010+row, 0xff)
+		}
+
+		ppu.Palette[0] = 0x0f
+		ppu.Palette[0x11] = 0x16
+
+		// 10 sprites on scanlines 6-13, 16 pixels apart
+		for i := uint16(0); i < 10; i++ {
+			ppu.OAM.Store(i<<2, 5)
+			ppu.OAM.Store(i<<2+1, 0x01)
+			ppu.OAM.Store(i<<2+3, uint8(16+i*16))
+		}
+
+		for i := uint16(10); i < 64; i++ {
+			ppu.OAM.Store(i<<2, 0xf0)
+		}
+
+		ppu.Scanline = 5
+
+		for i := 0; i < 2*int(CYCLES_PER_SCANLINE); i++ {
+			ppu.Execute()
+		}
+
+		for i := 0; i < 10; i++ {
+			expected := uint16(0x16)
+
+			if i >= 8 && !noSpriteLimit {
+				expected = 0x0f
+			}
+
+			if pixel := ppu.colors[6<<8+16+i*16]; pixel != expected {
+				t.Errorf("No sprite limit %v: sprite %v pixel is %03X not %03X", noSpriteLimit, i, pixel, expected)
+			}
+		}
+
+		if !ppu.status(SpriteOverflow) {
+			t.Errorf("No sprite limit %v: SpriteOverflow not set", noSpriteLimit)
+		}
+	}
+}
+
+func TestOAMAddressCorruption(t *testing.T) {
+	ppu := NewRP2C02(nil)
+
+	for i := uint16(0); i < 256; i++ {
+		ppu.OAM.Store(i, uint8(i))
+	}
+
+	// disabling rendering during sprite evaluation leaves OAMAddress
+	// where evaluation had reached
+	ppu.Registers.Mask = 0x18
+	ppu.Registers.OAMAddress = 0x00
+	ppu.Scanline = 100
+	ppu.OAM.Address = 0x42
+	ppu.Cycle = 100
+	ppu.Store(0x2001, 0x00)
+
+	if ppu.Registers.OAMAddress != 0x42 {
+		t.Errorf("OAMAddress is %02X not 0x42", ppu.Registers.OAMAddress)
+	}
+
+	// and clears it while sprites are fetched
+	ppu.Registers.Mask = 0x18
+	ppu.Cycle = 300
+	ppu.Store(0x2001, 0x00)
+
+	if ppu.Registers.OAMAddress != 0x00 {
+		t.Errorf("OAMAddress is %02X not 0x00", ppu.Registers.OAMAddress)
+	}
+
+	// but not during vertical blank
+	ppu.Registers.Mask = 0x18
+	ppu.Registers.OAMAddress = 0x42
+	ppu.Scanline = 250
+	ppu.Store(0x2001, 0x00)
+
+	if ppu.Registers.OAMAddress != 0x42 {
+		t.Errorf("OAMAddress is %02X not 0x42", ppu.Registers.OAMAddress)
+	}
+
+	// starting to render with OAMAddress at 8 or more copies its row
+	// over the first
+	ppu.Registers.Mask = 0x18
+	ppu.Registers.OAMAddress = 0x43
+	ppu.Scanline = 261
+	ppu.Cycle = 1
+	ppu.Execute()
+
+	for i := uint16(0); i < 8; i++ {
+		if value := ppu.OAM.Fetch(i); value != uint8(0x40+i) {
+			t.Errorf("OAM %02X is %02X not %02X", i, value, 0x40+i)
+		}
+	}
+}
+
+func TestPixelTiles(t *testing.T) {
+	ppu := NewRP2C02(nil)
+
+	ppu.TileKey = func(address uint16) uint32 { return uint32(address) }
+	ppu.Registers.Mask = 0x1e
+	ppu.Nametable.SetTables(0, 1, 0, 1)
+
+	// tile 1 is solid colour 1 and is the second tile of the
+	// nametable
+	for row := uint16(0); row < 8; row++ {
+		ppu.Memory.Store(0x0010+row, 0xff)
+	}
+
+	for address := uint16(0x2000); address < 0x2400; address++ {
+		ppu.Memory.Store(address, 0x00)
+	}
+
+	ppu.Memory.Store(0x2001, 0x01)
+
+	for i, color := range []uint8{0x0f, 0x01, 0x02, 0x03} {
+		ppu.Palette[i] = color
+	}
+
+	for i, color := range []uint8{0x16, 0x17, 0x18} {
+		ppu.Palette[0x11+i] = color
+	}
+
+	// a horizontally flipped tile 1 sprite at (16, 6)
+	ppu.OAM.Store(0, 5)
+	ppu.OAM.Store(1, 0x01)
+	ppu.OAM.Store(2, 0x40)
+	ppu.OAM.Store(3, 16)
+
+	for i := uint16(1); i < 64; i++ {
+		ppu.OAM.Store(i<<2, 0xf0)
+	}
+
+	ppu.Scanline = 261
+
+	for i := 0; i < 8*int(CYCLES_PER_SCANLINE); i++ {
+		ppu.Execute()
+	}
+
+	for _, test := range []struct {
+		x, y     int
+		expected PixelTile
+	}{
+		{8, 0, PixelTile{Key: 0x0010, Palette: 0x0f010203, Background: true}},
+		{11, 2, PixelTile{Key: 0x0010, Palette: 0x0f010203, Row: 2, Column: 3, Background: true}},
+		{17, 0, PixelTile{Key: 0x0000, Palette: 0x0f010203, Column: 1, Background: true}},
+		{17, 6, PixelTile{Key: 0x0010, Palette: 0x0f161718, Column: 6, HFlip: true, Sprite: true}},
+	} {
+		if tile := ppu.Tiles[test.y<<8+test.x]; tile != test.expected {
+			t.Errorf("Pixel (%v, %v) tile is %+v not %+v", test.x, test.y, tile, test.expected)
+		}
+	}
+}
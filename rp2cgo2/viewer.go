@@ -0,0 +1,230 @@
+package rp2cgo2
+
+import "image"
+
+// Returns the four nametables as a 512x480 frame of 9-bit pixels, as
+// described by pixel, with $2000 at the top left, $2400 at the top
+// right, $2800 at the bottom left and $2c00 at the bottom right.
+// Tiles are read through the current mirroring and drawn from the
+// current background pattern table with the attribute tables and
+// palette.  Reading them has no side effects.
+func (ppu *RP2C02) Nametables() (colors []uint16) {
+	colors = make([]uint16, 512*480)
+	base := ppu.controller(BackgroundPatternAddress)
+
+	for table := uint16(0); table < 4; table++ {
+		address := 0x2000 | table<<10
+		left, top := int(table&0x01)*256, int(table>>1)*240
+
+		for ty := uint16(0); ty < 30; ty++ {
+			for tx := uint16(0); tx < 32; tx++ {
+				tile := uint16(ppu.Memory.Peek(address | ty<<5 | tx))
+				attribute := ppu.Memory.Peek(address | 0x03c0 | (ty>>2)<<3 | tx>>2)
+				attribute = (attribute >> ((ty&0x02)<<1 | tx&0x02)) & 0x03
+
+				for row := uint16(0); row < 8; row++ {
+					low := ppu.Memory.Peek(base | tile<<4 | row)
+					high := ppu.Memory.Peek(base | tile<<4 | row | 0x08)
+
+					for col := uint(0); col < 8; col++ {
+						index := (low>>(7-col))&0x01 | ((high>>(7-col))&0x01)<<1
+						color := ppu.Palette[0]
+
+						if index != 0 {
+							color = ppu.Palette[attribute<<2|index]
+						}
+
+						x, y := left+int(tx)*8+int(col), top+int(ty)*8+int(row)
+						colors[y*512+x] = ppu.pixel(color)
+					}
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// Returns the 256x240 area of Nametables shown on screen.  While a
+// visible scanline is being rendered the area is found from the
+// scanline and the vertical scroll in the VRAM address, so that it
+// follows scroll changes made during the frame, and otherwise from
+// the scroll the next frame will start with.  The area may extend
+// past the right and bottom of the nametables, in which case it wraps
+// around to the left and top.
+func (ppu *RP2C02) ScrollRect() image.Rectangle {
+	// t: .yyy NN YYYYY XXXXX
+	t := ppu.LatchAddress
+
+	x := int(t&0x001f)<<3 | int(ppu.Registers.Scroll&0x07) | int(t&0x0400)>>2
+	y := int(t&0x03e0)>>2 | int(t&0x7000)>>12 + (int(t&0x0800)>>11)*240
+
+	if ppu.Scanline <= 239 && ppu.rendering() {
+		v := ppu.Registers.Address
+		line := int(ppu.Scanline)
+
+		// the vertical scroll is incremented for the next scanline
+		// at cycle 256
+		if ppu.Cycle > 256 {
+			line++
+		}
+
+		y = (int(v&0x03e0)>>2 | int(v&0x7000)>>12) + (int(v&0x0800)>>11)*240 - line
+
+		if y < 0 {
+			y += 480
+		}
+	}
+
+	// coarse Y scrolls of 30 and 31 start in the attribute table
+	y %= 480
+
+	return image.Rect(x, y, x+256, y+240)
+}
+
+// An entry in OAM decoded for the sprite viewer.
+type OAMSprite struct {
+	Index int
+	X     uint8
+	Y     uint8
+	// the tile number as stored in OAM
+	Tile    uint8
+	Palette uint8
+	// set if the sprite is drawn behind the background
+	Behind           bool
+	FlipHorizontally bool
+	FlipVertically   bool
+	// the pattern table address of the sprite's top tile
+	Address uint16
+	Height  int
+	// the sprite's 8xHeight pixels as 2-bit colour indexes, 0 being
+	// transparent, and as 9-bit pixels as described by pixel, both
+	// flipped as they are drawn
+	Indexes []uint8
+	Colors  []uint16
+}
+
+// Returns the 64 sprites in OAM decoded with the current sprite size,
+// sprite pattern table and palette.  Reading them has no side
+// effects.
+func (ppu *RP2C02) OAMSprites() (sprites []OAMSprite) {
+	size := int(ppu.controller(SpriteSize))
+
+	for i := 0; i < 64; i++ {
+		address := uint16(i) << 2
+
+		sprite := uint32(ppu.OAM.BasicMemory.Fetch(address))<<24 |
+			uint32(ppu.OAM.BasicMemory.Fetch(address+1))<<16 |
+			uint32(ppu.OAM.BasicMemory.Fetch(address+2))<<8 |
+			uint32(ppu.OAM.BasicMemory.Fetch(address+3))
+
+		s := OAMSprite{
+			Index:            i,
+			X:                ppu.sprite(sprite, XPosition),
+			Y:                ppu.sprite(sprite, YPosition),
+			Tile:             uint8(sprite >> 16),
+			Palette:          ppu.sprite(sprite, SpritePalette),
+			Behind:           ppu.sprite(sprite, Priority) != 0,
+			FlipHorizontally: ppu.sprite(sprite, FlipHorizontally) != 0,
+			FlipVertically:   ppu.sprite(sprite, FlipVertically) != 0,
+			Height:           size,
+			Indexes:          make([]uint8, 8*size),
+			Colors:           make([]uint16, 8*size),
+		}
+
+		switch size {
+		case 8:
+			s.Address = ppu.controller(SpritePatternAddress) |
+				(uint16(ppu.sprite(sprite, TileNumber)) << 4)
+		case 16:
+			s.Address = (uint16(ppu.sprite(sprite, TileBank)) << 12) |
+				(uint16(ppu.sprite(sprite, TileNumber)) << 5)
+		}
+
+		for row := 0; row < size; row++ {
+			r := uint16(row)
+
+			if s.FlipVertically {
+				r = uint16(size - 1 - row)
+			}
+
+			// the bottom half of an 8x16 sprite is the next tile
+			address := s.Address | (r&0x08)<<1 | r&0x07
+			low := ppu.Memory.Peek(address)
+			high := ppu.Memory.Peek(address | 0x0008)
+
+			if s.FlipHorizontally {
+				low, high = reverseSprite(low), reverseSprite(high)
+			}
+
+			for col := uint(0); col < 8; col++ {
+				index := (low>>(7-col))&0x01 | ((high>>(7-col))&0x01)<<1
+
+				s.Indexes[row*8+int(col)] = index
+				s.Colors[row*8+int(col)] = ppu.pixel(ppu.Palette[0x10|s.Palette<<2|index])
+			}
+		}
+
+		sprites = append(sprites, s)
+	}
+
+	return
+}
+
+// Returns both pattern tables side by side as 256x128 2-bit colour
+// indexes, $0000 on the left and $1000 on the right, each laid out as
+// 16x16 tiles.  Reading them has no side effects.
+func (ppu *RP2C02) PatternTables() (indexes []uint8) {
+	indexes = make([]uint8, 256*128)
+
+	for address := uint16(0x0000); address <= 0x1fff; address += 0x0010 {
+		tile := int(address >> 4)
+		left, top := (tile&0x0f)*8+(tile>>8)*128, ((tile>>4)&0x0f)*8
+
+		for row := uint16(0); row < 8; row++ {
+			low := ppu.Memory.Peek(address | row)
+			high := ppu.Memory.Peek(address | row | 0x08)
+
+			for col := uint(0); col < 8; col++ {
+				index := (low>>(7-col))&0x01 | ((high>>(7-col))&0x01)<<1
+				indexes[(top+int(row))*256+left+int(col)] = index
+			}
+		}
+	}
+
+	return
+}
+
+// Returns the $2000 bytes of pattern table data that PatternTables
+// would return indexes for.
+func EncodePatternTables(indexes []uint8) (chr []uint8) {
+	chr = make([]uint8, 0x2000)
+
+	for address := 0x0000; address <= 0x1fff; address += 0x0010 {
+		tile := address >> 4
+		left, top := (tile&0x0f)*8+(tile>>8)*128, ((tile>>4)&0x0f)*8
+
+		for row := 0; row < 8; row++ {
+			for col := uint(0); col < 8; col++ {
+				index := indexes[(top+row)*256+left+int(col)]
+				chr[address|row] |= (index & 0x01) << (7 - col)
+				chr[address|row|0x08] |= ((index >> 1) & 0x01) << (7 - col)
+			}
+		}
+	}
+
+	return
+}
+
+// Returns the 9-bit pixels, as described by pixel, of the 4 colours of
+// one of the 8 palettes, 0-3 being the background palettes and 4-7 the
+// sprite palettes.  Colour 0 is always the backdrop colour.
+func (ppu *RP2C02) PaletteColors(palette int) (colors [4]uint16) {
+	colors[0] = ppu.pixel(ppu.Palette[0])
+
+	for i := 1; i < 4; i++ {
+		colors[i] = ppu.pixel(ppu.Palette[(palette&0x07)<<2|i])
+	}
+
+	return
+}